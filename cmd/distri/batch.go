@@ -51,8 +51,13 @@ Build all distri packages.
 
 Packages which are already built (i.e. their .squashfs image exists) are skipped.
 
+Builds can be distributed to remote build servers (see distri builder) in
+addition to local jobs. Builds which fail on one builder are retried on another.
+Credentials for builders are read from builders.d (see distri builder).
+
 Example:
   % distri batch -dry_run
+  % distri batch -jobs=4 -builders=ws:2019=16,laptop:2019=4
 `
 
 func cmdbatch(ctx context.Context, args []string) error {
@@ -71,6 +76,12 @@ func cmdbatch(ctx context.Context, args []string) error {
 		arch = fset.String("cross",
 			"",
 			"If non-empty, cross-build for the specified architecture (e.g. i686)")
+		builders = fset.String("builders",
+			"",
+			"comma-separated list of remote builders (see distri builder) to distribute builds to, each a host:port address optionally followed by =<slots> (number of concurrent builds, default 1). Use -jobs=0 to only build remotely")
+		buildCache = fset.String("build_cache",
+			env.BuildCache,
+			"If non-empty, a directory or HTTP URL of a build cache, passed to distri build")
 	)
 	fset.Usage = usage(fset, batchHelp)
 	fset.Parse(args)
@@ -94,6 +105,11 @@ func cmdbatch(ctx context.Context, args []string) error {
 		return bootstrapFrom(*bootstrapFromPath, *dryRun)
 	}
 
+	remotes, err := batch.ParseBuilders(*builders)
+	if err != nil {
+		return err
+	}
+
 	bctx := &batch.Ctx{
 		Log:        log.New(os.Stdout, "", log.LstdFlags),
 		DistriRoot: env.DistriRoot,
@@ -101,6 +117,8 @@ func cmdbatch(ctx context.Context, args []string) error {
 			Arch: *arch,
 			Repo: env.DefaultRepo,
 		},
+		BuildCache: *buildCache,
+		Builders:   remotes,
 	}
 	return bctx.Build(ctx, *dryRun, *simulate, *rebuild, *jobs)
 }
@@ -173,7 +173,7 @@ func bootstrapFrom(old string, dryRun bool) error {
 			pv := distri.ParseVersion(pkg)
 			oldname := pkg + ".meta.textproto"
 			newname := filepath.Join(env.DefaultRepo, pv.Pkg+"-"+pv.Arch+".meta.textproto")
-			if cur, ok := links[newname]; !ok || pv.DistriRevision > distri.ParseVersion(cur).DistriRevision {
+			if cur, ok := links[newname]; !ok || pv.Compare(distri.ParseVersion(cur)) > 0 {
 				links[newname] = oldname
 			}
 		}
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -20,13 +22,13 @@ import (
 
 	"github.com/distr1/distri"
 	"github.com/distr1/distri/internal/build"
+	"github.com/distr1/distri/internal/buildcache"
 	"github.com/distr1/distri/internal/env"
 	"github.com/distr1/distri/internal/trace"
 	"github.com/distr1/distri/pb"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/renameio"
 	"golang.org/x/xerrors"
-	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/prototext"
@@ -40,6 +42,8 @@ Build a distri package.
 
 Example:
   % distri build -pkg=i3status
+  % distri build -pkg=i3status -build_cache=http://ws:7081
+  % distri build -pkg=i3status -verify_reproducible
 `
 
 const (
@@ -140,7 +144,7 @@ func updateFromDistriroot(builddir string) error {
 	return nil
 }
 
-func buildpkg(ctx context.Context, hermetic bool, debug string, fuse bool, pwd, cross, remote string, artifactFd, jobs int) error {
+func buildpkg(ctx context.Context, hermetic bool, debug string, fuse bool, pwd, cross, remote, buildCache string, artifactFd, jobs int) error {
 	defer trace.Event("buildpkg", tidBuildpkg).Done()
 	buildProto, err := pb.ReadBuildFile("build.textproto")
 	if err != nil {
@@ -201,6 +205,27 @@ func buildpkg(ctx context.Context, hermetic bool, debug string, fuse bool, pwd,
 
 	log.Printf("building %s", b.FullName())
 
+	// Non-hermetic builds depend on the host, which the input digest does not
+	// cover, and debug builds are interactive.
+	var cache *buildcache.Cache
+	var artifacts bytes.Buffer
+	if buildCache != "" && hermetic && debug == "" {
+		cache, err = openBuildCache(buildCache)
+		if err != nil {
+			log.Printf("build cache %s: %v", buildCache, err)
+		}
+	}
+	if cache != nil {
+		hit, err := fetchCached(ctx, cache, b)
+		if err != nil {
+			log.Printf("build cache %s: %v", cache, err)
+		}
+		if hit {
+			return nil
+		}
+		b.ArtifactWriter = io.MultiWriter(b.ArtifactWriter, &artifacts)
+	}
+
 	b.SourceDir = build.TrimArchiveSuffix(filepath.Base(b.Proto.GetSource()))
 
 	u, err := url.Parse(b.Proto.GetSource())
@@ -271,7 +296,7 @@ func buildpkg(ctx context.Context, hermetic bool, debug string, fuse bool, pwd,
 
 		log.Printf("building on %s", remote)
 
-		conn, err := grpc.DialContext(ctx, remote, grpc.WithInsecure(), grpc.WithBlock())
+		conn, err := dialBuilder(ctx, remote)
 		if err != nil {
 			return err
 		}
@@ -330,8 +355,17 @@ func buildpkg(ctx context.Context, hermetic bool, debug string, fuse bool, pwd,
 				}
 				return err
 			}
-			artifacts = append(artifacts, progress.GetOutputPath()...)
-			log.Printf("progress: %+v", progress)
+			if l := progress.GetLog(); len(l) > 0 {
+				multiLog.Write(l)
+			}
+			if paths := progress.GetOutputPath(); len(paths) > 0 {
+				artifacts = append(artifacts, paths...)
+				if progress.GetCached() {
+					log.Printf("artifacts (cached on %s): %v", remote, paths)
+				} else {
+					log.Printf("artifacts: %v", paths)
+				}
+			}
 		}
 		buildEv.Done()
 
@@ -475,6 +509,7 @@ func buildpkg(ctx context.Context, hermetic bool, debug string, fuse bool, pwd,
 			Version:      proto.String(b.Version),
 			RuntimeUnion: unions,
 			InputDigest:  proto.String(b.InputDigest),
+			ExchangeDir:  b.Proto.GetExchangeDir(),
 		})
 		fn := filepath.Join("../distri/pkg/" + fullName + ".meta.textproto")
 		b.ArtifactWriter.Write([]byte("_build/" + strings.TrimPrefix(fn, "../") + "\n"))
@@ -487,9 +522,132 @@ func buildpkg(ctx context.Context, hermetic bool, debug string, fuse bool, pwd,
 		writeEv.Done()
 	}
 
+	if cache != nil {
+		if err := storeCached(ctx, cache, b, artifacts.String()); err != nil {
+			// The build itself succeeded, so only log the error.
+			log.Printf("build cache %s: %v", cache, err)
+		}
+	}
+
+	return nil
+}
+
+// openBuildCache opens the build cache at location, sending the token from
+// env.BuildCacheAuth (if configured) when storing artifacts.
+func openBuildCache(location string) (*buildcache.Cache, error) {
+	var token string
+	if env.BuildCacheAuth != "" {
+		b, err := ioutil.ReadFile(env.BuildCacheAuth)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+		if strings.HasPrefix(location, "http://") {
+			u, err := url.Parse(location)
+			if err != nil {
+				return nil, err
+			}
+			if !isLoopback(u.Host) {
+				return nil, xerrors.Errorf("refusing to send the DISTRIBUILDCACHEAUTH token to %s without TLS, use https://", u.Host)
+			}
+		}
+	}
+	return buildcache.Open(location, token), nil
+}
+
+// cacheableArtifacts returns the paths (relative to the distri root) of all
+// artifacts which building b might produce, i.e. which fetchCached accepts.
+func cacheableArtifacts(b *build.Ctx) map[string]bool {
+	names := []string{b.Pkg}
+	for _, splitpkg := range b.Proto.GetSplitPackage() {
+		names = append(names, splitpkg.GetName())
+	}
+	paths := make(map[string]bool)
+	for _, name := range names {
+		fullName := name + "-" + b.Arch + "-" + b.Version
+		for _, subdir := range []string{"pkg", "debug", "src"} {
+			paths[subdir+"/"+fullName+".squashfs"] = true
+			paths[subdir+"/"+fullName+".meta.textproto"] = true
+		}
+	}
+	return paths
+}
+
+// fetchCached retrieves the artifacts of b from cache (if present) into the
+// package store. The artifacts are retrieved into a temporary directory and
+// only moved into the package store once all of them were verified.
+func fetchCached(ctx context.Context, cache *buildcache.Cache, b *build.Ctx) (hit bool, _ error) {
+	defer trace.Event("build cache lookup", tidBuildpkg).Done()
+	digest, err := b.Digest()
+	if err != nil {
+		return false, err
+	}
+	// Within ../distri, so that the artifacts can be renamed into place:
+	tmp, err := ioutil.TempDir("../distri", ".buildcache-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmp)
+	paths, err := cache.Get(ctx, digest, tmp)
+	if err != nil {
+		if err == buildcache.ErrNotFound {
+			log.Printf("input digest %s not found in build cache %s", digest, cache)
+			return false, nil
+		}
+		return false, err
+	}
+	cacheable := cacheableArtifacts(b)
+	for _, p := range paths {
+		if !cacheable[p] {
+			return false, xerrors.Errorf("input digest %s: unexpected artifact %q for %s", digest, p, b.FullName())
+		}
+	}
+	for _, p := range paths {
+		dest := filepath.Join("../distri", filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return false, err
+		}
+		if err := os.Rename(filepath.Join(tmp, filepath.FromSlash(p)), dest); err != nil {
+			return false, err
+		}
+	}
+	log.Printf("retrieved %s (input digest %s) from build cache %s", b.FullName(), digest, cache)
+	for _, p := range paths {
+		b.ArtifactWriter.Write([]byte("_build/distri/" + p + "\n"))
+		if !strings.HasPrefix(p, "pkg/") || !strings.HasSuffix(p, ".meta.textproto") {
+			continue
+		}
+		// Like a local build, point e.g. hello-amd64.meta.textproto to the
+		// most recently built version:
+		fullName := strings.TrimSuffix(strings.TrimPrefix(p, "pkg/"), ".meta.textproto")
+		pv := distri.ParseVersion(fullName)
+		if err := renameio.Symlink(fullName+".meta.textproto", filepath.Join("../distri/pkg/"+pv.Pkg+"-"+pv.Arch+".meta.textproto")); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// storeCached stores the artifacts of b (file names relative to the distri
+// root, one per line) in cache.
+func storeCached(ctx context.Context, cache *buildcache.Cache, b *build.Ctx, artifacts string) error {
+	defer trace.Event("build cache store", tidBuildpkg).Done()
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(artifacts), "\n") {
+		if !strings.HasPrefix(line, "_build/distri/") {
+			continue
+		}
+		paths = append(paths, strings.TrimPrefix(line, "_build/distri/"))
+	}
+	if err := cache.Put(ctx, b.InputDigest, "../distri", paths); err != nil {
+		return err
+	}
+	log.Printf("stored %s (input digest %s) in build cache %s", b.FullName(), b.InputDigest, cache)
 	return nil
 }
 
+// store uploads fn (relative to the distri root) to the remote builder, unless
+// the builder already has a file with the same contents.
 func store(ctx context.Context, cl bpb.BuildClient, fn string) error {
 	f, err := os.Open(filepath.Join(string(env.DistriRoot), fn))
 	if err != nil {
@@ -497,41 +655,51 @@ func store(ctx context.Context, cl bpb.BuildClient, fn string) error {
 	}
 	defer f.Close()
 
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
 	upcl, err := cl.Store(ctx)
 	if err != nil {
 		return err
 	}
-	path := fn
+	// The first chunk carries the path and digest, even for empty files.
+	chunk := &bpb.Chunk{
+		Path:   fn,
+		Sha256: hex.EncodeToString(h.Sum(nil)),
+	}
 	var buf [4096]byte
-	for {
+	for first := true; ; first = false {
 		n, err := f.Read(buf[:])
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
+		if err != nil && err != io.EOF {
 			return xerrors.Errorf("Read: %v", err)
 		}
-		chunk := buf[:n]
-		if err := upcl.Send(&bpb.Chunk{
-			Path:  path,
-			Chunk: chunk,
-		}); err != nil {
-			if status.Code(err) == codes.AlreadyExists {
-				return nil
-			}
+		if n == 0 && !first {
+			break
+		}
+		chunk.Chunk = buf[:n]
+		if err := upcl.Send(chunk); err != nil {
 			if err == io.EOF {
-				return nil // server closed stream, file already present
+				break // server closed stream, see CloseAndRecv for details
 			}
 			return xerrors.Errorf("Send: %v", err)
 		}
-		path = ""
+		chunk = &bpb.Chunk{}
 	}
-	if _, err := upcl.CloseAndRecv(); err != nil {
+	resp, err := upcl.CloseAndRecv()
+	if err != nil {
 		if status.Code(err) == codes.AlreadyExists {
 			return nil
 		}
 		return xerrors.Errorf("CloseAndRecv: %v", err)
 	}
+	if resp.GetAlreadyPresent() {
+		log.Printf("store(%s): already present", fn)
+	}
 	return nil
 }
 
@@ -620,6 +788,14 @@ func cmdbuild(ctx context.Context, args []string) error {
 		jobs = fset.Int("jobs",
 			runtime.NumCPU(),
 			"Number of parallel jobs, passed to make -j, ninja --jobs, etc.")
+
+		buildCache = fset.String("build_cache",
+			env.BuildCache,
+			"If non-empty, a directory or HTTP URL (see distri buildcache) of a build cache to retrieve the package from instead of building it, and to store the package in after building it")
+
+		verifyReproducible = fset.Bool("verify_reproducible",
+			false,
+			"Build the package twice (ignoring -build_cache), each time in a different temporary directory, and fail with the first difference unless all artifacts are identical")
 	)
 	fset.Usage = usage(fset, buildHelp)
 	fset.Parse(args)
@@ -677,9 +853,116 @@ func cmdbuild(ctx context.Context, args []string) error {
 		}
 	}
 
-	if err := buildpkg(ctx, *hermetic, *debug, *fuse, pwd, *cross, *remote, *artifactFd, *jobs); err != nil {
+	if *verifyReproducible {
+		if *debug != "" || *remote != "" || *artifactFd > -1 {
+			return xerrors.Errorf("-verify_reproducible cannot be combined with -debug, -remote or -artifactfd")
+		}
+		return verifyReproducibleBuild(ctx, pwd, []string{
+			fmt.Sprintf("-hermetic=%v", *hermetic),
+			fmt.Sprintf("-fuse=%v", *fuse),
+			"-cross=" + *cross,
+			fmt.Sprintf("-jobs=%d", *jobs),
+			"-dont_set_governor", // already set
+			"-build_cache=",
+		})
+	}
+
+	if err := buildpkg(ctx, *hermetic, *debug, *fuse, pwd, *cross, *remote, *buildCache, *artifactFd, *jobs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// buildArtifacts builds the package in pwd in a child process, which uses
+// tmpdir for all temporary directories, and returns the artifact paths
+// (relative to the distri root).
+func buildArtifacts(ctx context.Context, pwd, tmpdir string, flags []string) ([]string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	child := exec.CommandContext(ctx, os.Args[0], append(append([]string{"build"}, flags...),
+		"-artifactfd=3")...) // Go dup2()s ExtraFiles to 3 and onwards
+	child.Dir = pwd
+	child.Env = append(os.Environ(), "TMPDIR="+tmpdir)
+	child.ExtraFiles = []*os.File{w}
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	if err := child.Start(); err != nil {
+		w.Close()
+		return nil, err
+	}
+	// Close the write end of the pipe in the parent process.
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := child.Wait(); err != nil {
+		return nil, xerrors.Errorf("%v: %w", child.Args, err)
+	}
+	var artifacts []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		for _, p := range strings.Split(line, "\x00") {
+			if p != "" {
+				artifacts = append(artifacts, p)
+			}
+		}
+	}
+	return artifacts, nil
+}
+
+// verifyReproducibleBuild builds the package in pwd twice and compares the
+// artifacts of both builds. The artifacts of the second build remain in place.
+func verifyReproducibleBuild(ctx context.Context, pwd string, flags []string) error {
+	root := filepath.Join(pwd, "..", "..") // artifact paths are relative to the distri root
+	tmp, err := ioutil.TempDir("", "distri-verify")
+	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(tmp)
 
+	// The first build’s artifacts are moved aside, the second build’s
+	// artifacts remain in place.
+	var builds [2][]string
+	for i := range builds {
+		tmpdir := filepath.Join(tmp, fmt.Sprintf("build%d", i+1))
+		if err := os.Mkdir(tmpdir, 0755); err != nil {
+			return err
+		}
+		log.Printf("verify_reproducible: build %d of 2 (TMPDIR=%s)", i+1, tmpdir)
+		artifacts, err := buildArtifacts(ctx, pwd, tmpdir, flags)
+		if err != nil {
+			return err
+		}
+		builds[i] = artifacts
+		if i > 0 {
+			continue
+		}
+		for _, p := range artifacts {
+			if err := copyFile(filepath.Join(root, p), filepath.Join(tmp, "first", p)); err != nil {
+				return err
+			}
+		}
+	}
+
+	first, second := builds[0], builds[1]
+	if strings.Join(first, "\n") != strings.Join(second, "\n") {
+		return xerrors.Errorf("not reproducible: builds produced different artifacts: %v vs. %v", first, second)
+	}
+	for _, p := range second {
+		diff, err := build.DiffArtifacts(filepath.Join(tmp, "first", p), filepath.Join(root, p))
+		if err != nil {
+			return err
+		}
+		if diff != "" {
+			return xerrors.Errorf("not reproducible: %s: %s", p, diff)
+		}
+	}
+	log.Printf("verify_reproducible: all %d artifacts are identical", len(second))
 	return nil
 }
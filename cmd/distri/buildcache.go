@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/distr1/distri/internal/addrfd"
+	"github.com/distr1/distri/internal/buildcache"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+const buildcacheHelp = `distri buildcache [-flags]
+
+Serve a build cache to others, which distri build consults before building a
+package and populates after building a package.
+
+Unless the build cache only listens on localhost, storing artifacts requires
+the bearer token from -auth_token_file. Clients read the token from the file
+named by DISTRIBUILDCACHEAUTH, and only send it via TLS (see -tls_cert_file)
+or to localhost.
+
+Example:
+  ws % distri buildcache -listen=:7081 -auth_token_file=buildcache.token -tls_cert_file=ws.pem -tls_key_file=ws.key
+  laptop % DISTRIBUILDCACHE=https://ws:7081 DISTRIBUILDCACHEAUTH=buildcache.token distri batch
+`
+
+// isLoopback returns whether addr ([host]:port) only accepts connections from
+// the local machine. An empty host listens on all interfaces.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func cmdbuildcache(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("buildcache", flag.ExitOnError)
+	var (
+		listen = fset.String("listen", "localhost:7081", "[host]:port listen address for serving the build cache")
+		dir    = fset.String("dir", "", "directory in which to store the build cache. defaults to distri/buildcache within the user cache directory")
+
+		authTokenFile = fset.String("auth_token_file",
+			"",
+			"If non-empty, path to a file containing the bearer token which clients must send to store artifacts (see DISTRIBUILDCACHEAUTH). Required unless -listen is a localhost address")
+
+		tlsCertFile = fset.String("tls_cert_file",
+			"",
+			"If non-empty, path to the TLS certificate to serve HTTPS requests with (requires -tls_key_file)")
+
+		tlsKeyFile = fset.String("tls_key_file",
+			"",
+			"If non-empty, path to the private key of -tls_cert_file")
+	)
+	fset.Usage = usage(fset, buildcacheHelp)
+	fset.Parse(args)
+
+	var token string
+	if *authTokenFile != "" {
+		b, err := ioutil.ReadFile(*authTokenFile)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(b))
+		if token == "" {
+			return xerrors.Errorf("%s: empty auth token", *authTokenFile)
+		}
+	} else if !isLoopback(*listen) {
+		return xerrors.Errorf("refusing to accept unauthenticated uploads on %q: specify -auth_token_file", *listen)
+	}
+
+	if *dir == "" {
+		ucd, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		*dir = filepath.Join(ucd, "distri", "buildcache")
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	addr := ln.Addr().String()
+	server := &http.Server{
+		Addr:    addr,
+		Handler: buildcache.Handler(*dir, token),
+	}
+	log.Printf("serving build cache %s on %s", *dir, addr)
+
+	addrfd.MustWrite(addr)
+	var eg errgroup.Group
+	eg.Go(func() error {
+		ln := tcpKeepAliveListener{ln.(*net.TCPListener)}
+		if *tlsCertFile != "" {
+			return server.ServeTLS(ln, *tlsCertFile, *tlsKeyFile)
+		}
+		return server.Serve(ln)
+	})
+	eg.Go(func() error {
+		<-ctx.Done()
+		return server.Shutdown(ctx)
+	})
+	return eg.Wait()
+}
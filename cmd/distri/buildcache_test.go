@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/distr1/distri/internal/build"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestIsLoopback(t *testing.T) {
+	for _, tt := range []struct {
+		addr string
+		want bool
+	}{
+		{"localhost:7081", true},
+		{"127.0.0.1:7081", true},
+		{"[::1]:7081", true},
+		{"localhost", true},
+		{":7081", false},
+		{"0.0.0.0:7081", false},
+		{"ws:7081", false},
+		{"10.0.0.1:7081", false},
+	} {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestCacheableArtifacts(t *testing.T) {
+	b := &build.Ctx{
+		Pkg:     "hello",
+		Arch:    "amd64",
+		Version: "2.8-3",
+		Proto: &pb.Build{
+			SplitPackage: []*pb.SplitPackage{{Name: proto.String("hello-doc")}},
+		},
+	}
+	cacheable := cacheableArtifacts(b)
+	for _, p := range []string{
+		"pkg/hello-amd64-2.8-3.squashfs",
+		"pkg/hello-amd64-2.8-3.meta.textproto",
+		"pkg/hello-doc-amd64-2.8-3.squashfs",
+		"debug/hello-amd64-2.8-3.squashfs",
+		"src/hello-amd64-2.8-3.squashfs",
+	} {
+		if !cacheable[p] {
+			t.Errorf("%s unexpectedly not cacheable", p)
+		}
+	}
+	for _, p := range []string{
+		"pkg/bash-amd64-5.0-4.squashfs",
+		"pkg/hello-amd64.meta.textproto",
+		"pkg/hello-amd64-2.8-4.squashfs",
+		"../hello-amd64-2.8-3.squashfs",
+		"bin/hello",
+	} {
+		if cacheable[p] {
+			t.Errorf("%s unexpectedly cacheable", p)
+		}
+	}
+}
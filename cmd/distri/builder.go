@@ -3,22 +3,36 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"flag"
-	"hash/fnv"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/distr1/distri/internal/addrfd"
+	"github.com/distr1/distri/internal/buildcache"
 	"github.com/distr1/distri/internal/env"
+	"github.com/google/renameio"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
@@ -29,12 +43,117 @@ const builderHelp = `distri builder [-flags]
 
 builder runs a remote build server. This is useful to leverage additional
 compute capacity, e.g. from a cluster or the public cloud.
+
+Uploaded files are stored content-addressed, so that clients only need to
+upload files which the builder does not have yet. Build results are cached by
+the digest of their inputs.
+
+Unless the builder only listens on localhost, it requires authentication via
+-auth_token_file (over TLS, see -tls_cert_file) and/or mutual TLS via
+-tls_client_ca_file. Clients read their credentials from builders.d in the
+distri config directory, e.g.:
+
+  % echo 'ws:2019 auth=builder.token ca=builder-ca.pem' > /etc/distri/builders.d/ws.builder
 `
 
+// keepaliveInterval is the interval in which empty BuildProgress messages are
+// sent while a build is running, so that idle connection timeouts (e.g. of
+// proxies or NAT gateways) do not interrupt long builds.
+var keepaliveInterval = 30 * time.Second
+
 type buildsrv struct {
 	uploadBaseDir string
 }
 
+// casPath returns the path of the file with the hex-encoded SHA-256 digest
+// within the content-addressed store.
+func (b *buildsrv) casPath(digest string) string {
+	return filepath.Join(b.uploadBaseDir, ".cas", digest)
+}
+
+// link (atomically) makes path refer to the file with the specified digest in
+// the content-addressed store.
+func (b *buildsrv) link(digest, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Reserve a temporary name in the destination directory:
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	if err := os.Remove(tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Link(b.casPath(digest), tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func validSHA256(digest string) bool {
+	b, err := hex.DecodeString(digest)
+	return err == nil && len(b) == sha256.Size
+}
+
+// storeCAS receives the file whose first chunk is first into the
+// content-addressed store and links it to path.
+func (b *buildsrv) storeCAS(srv bpb.Build_StoreServer, first *bpb.Chunk, path string) error {
+	digest := first.GetSha256()
+	if !validSHA256(digest) {
+		return status.Errorf(codes.InvalidArgument, "invalid SHA-256 digest %q", digest)
+	}
+	if _, err := os.Stat(b.casPath(digest)); err == nil {
+		if err := b.link(digest, path); err != nil {
+			return err
+		}
+		// Replying terminates the stream before the client sent the
+		// remaining chunks.
+		return srv.SendAndClose(&bpb.StoreResponse{AlreadyPresent: true})
+	}
+	if err := os.MkdirAll(filepath.Dir(b.casPath(digest)), 0755); err != nil {
+		return err
+	}
+	f, err := renameio.TempFile("", b.casPath(digest))
+	if err != nil {
+		return err
+	}
+	defer f.Cleanup()
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+	for chunk := first; ; {
+		if _, err := w.Write(chunk.GetChunk()); err != nil {
+			return err
+		}
+		chunk, err = srv.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != digest {
+		return status.Errorf(codes.InvalidArgument, "SHA-256 digest mismatch: got %s, want %s", got, digest)
+	}
+	// Files in the store are shared by all paths which link to them:
+	if err := f.Chmod(0444); err != nil {
+		return err
+	}
+	if err := f.CloseAtomicallyReplace(); err != nil {
+		return err
+	}
+	if err := b.link(digest, path); err != nil {
+		return err
+	}
+	return srv.SendAndClose(&bpb.StoreResponse{})
+}
+
 func (b *buildsrv) Store(srv bpb.Build_StoreServer) error {
 	chunk, err := srv.Recv()
 	if err != nil {
@@ -45,6 +164,10 @@ func (b *buildsrv) Store(srv bpb.Build_StoreServer) error {
 		return status.Errorf(codes.InvalidArgument, "path traversal detected")
 	}
 
+	if chunk.GetSha256() != "" {
+		return b.storeCAS(srv, chunk, path)
+	}
+
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
@@ -75,30 +198,77 @@ func (b *buildsrv) Store(srv bpb.Build_StoreServer) error {
 	return srv.SendAndClose(&bpb.StoreResponse{})
 }
 
-func (b *buildsrv) Build(req *bpb.BuildRequest, srv bpb.Build_BuildServer) error {
-	// TODO: enforce minimum request deadline before starting a build
+// progressWriter sends everything written to it as build log in
+// BuildProgress messages. It is safe for concurrent use.
+type progressWriter struct {
+	mu  sync.Mutex
+	srv bpb.Build_BuildServer
+}
+
+func (p *progressWriter) send(progress *bpb.BuildProgress) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.srv.Send(progress)
+}
 
-	for _, p := range req.GetInputPath() {
+func (p *progressWriter) Write(b []byte) (int, error) {
+	// Send copies b, as gRPC serializes the message before returning.
+	if err := p.send(&bpb.BuildProgress{Log: b}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// inputDigest returns the hex-encoded SHA-256 digest of the build in
+// workingDirectory with the specified inputs (relative to b.uploadBaseDir).
+func (b *buildsrv) inputDigest(workingDirectory string, inputs []string) (string, error) {
+	sorted := append([]string{}, inputs...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", workingDirectory)
+	for _, p := range sorted {
 		path := filepath.Join(b.uploadBaseDir, p)
 		if !strings.HasPrefix(path, filepath.Clean(b.uploadBaseDir)+"/") {
-			return status.Errorf(codes.InvalidArgument, "path traversal detected")
+			return "", status.Errorf(codes.InvalidArgument, "path traversal detected")
 		}
 
 		f, err := os.Open(path)
 		if err != nil {
 			if os.IsNotExist(err) {
-				return status.Errorf(codes.NotFound, "%v", err)
+				return "", status.Errorf(codes.NotFound, "%v", err)
 			}
-			return err
+			return "", err
 		}
-		defer f.Close()
-		h := fnv.New64()
-		if _, err := io.Copy(h, f); err != nil {
-			return err
+		fh := sha256.New()
+		_, err = io.Copy(fh, f)
+		f.Close()
+		if err != nil {
+			return "", err
 		}
-		log.Printf("sum(%s) = %v", path, h.Sum64())
+		fmt.Fprintf(h, "%x  %s\n", fh.Sum(nil), p)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (b *buildsrv) Build(req *bpb.BuildRequest, srv bpb.Build_BuildServer) error {
+	// TODO: enforce minimum request deadline before starting a build
+
+	digest, err := b.inputDigest(req.GetWorkingDirectory(), req.GetInputPath())
+	if err != nil {
+		return err
+	}
+	results := buildcache.Open(filepath.Join(b.uploadBaseDir, ".results"), "")
+	paths, err := results.Get(srv.Context(), digest, b.uploadBaseDir)
+	if err == nil {
+		log.Printf("build of %s (input digest %s) cached", req.GetWorkingDirectory(), digest)
+		return srv.Send(&bpb.BuildProgress{
+			OutputPath: paths,
+			Cached:     true,
+		})
+	}
+	if err != buildcache.ErrNotFound {
+		log.Printf("result cache: %v", err) // build instead
 	}
-	// TODO: use the hash of hashes as cache key, store <hash>→<artifacts> in a file
 
 	// TODO: enforce inputs can only be read
 
@@ -125,9 +295,9 @@ func (b *buildsrv) Build(req *bpb.BuildRequest, srv bpb.Build_BuildServer) error
 		"DISTRIROOT=" + b.uploadBaseDir,
 		"PATH=" + os.Getenv("PATH"), // for unshare
 	}
-	// TODO: write to durable storage, send as artifact in BuildProgress
-	build.Stderr = os.Stderr
-	build.Stdout = os.Stdout
+	progress := &progressWriter{srv: srv}
+	build.Stderr = progress
+	build.Stdout = progress
 	if err := build.Start(); err != nil {
 		return err
 	}
@@ -135,23 +305,49 @@ func (b *buildsrv) Build(req *bpb.BuildRequest, srv bpb.Build_BuildServer) error
 	if err := w.Close(); err != nil {
 		return err
 	}
-	var eg errgroup.Group
+	var (
+		eg        errgroup.Group
+		artifacts []string
+		done      = make(chan struct{})
+	)
 	eg.Go(func() error {
 		scanner := bufio.NewScanner(r)
 		for scanner.Scan() {
-			if err := srv.Send(&bpb.BuildProgress{
-				OutputPath: strings.Split(scanner.Text(), "\x00"),
+			outputPath := strings.Split(scanner.Text(), "\x00")
+			artifacts = append(artifacts, outputPath...)
+			if err := progress.send(&bpb.BuildProgress{
+				OutputPath: outputPath,
 			}); err != nil {
 				return err
 			}
 		}
 		return scanner.Err()
 	})
-	eg.Go(build.Wait)
-	// TODO: send keepalive build progress messages
+	eg.Go(func() error {
+		defer close(done)
+		return build.Wait()
+	})
+	eg.Go(func() error {
+		ticker := time.NewTicker(keepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return nil
+			case <-ticker.C:
+				if err := progress.send(&bpb.BuildProgress{}); err != nil {
+					return err
+				}
+			}
+		}
+	})
 	if err := eg.Wait(); err != nil {
 		return err
 	}
+	if err := results.Put(srv.Context(), digest, b.uploadBaseDir, artifacts); err != nil {
+		// The build itself succeeded, so only log the error.
+		log.Printf("result cache: %v", err)
+	}
 	return nil
 }
 
@@ -188,16 +384,129 @@ func (b *buildsrv) Retrieve(req *bpb.RetrieveRequest, srv bpb.Build_RetrieveServ
 	return nil
 }
 
+// tokenAuth rejects requests which do not carry token as bearer token.
+type tokenAuth struct {
+	token string
+}
+
+func (a *tokenAuth) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(v), []byte("Bearer "+a.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Errorf(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+func (a *tokenAuth) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *tokenAuth) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.authorize(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// tokenCredentials sends a bearer token with each request.
+type tokenCredentials struct {
+	token string
+	// insecure is true if the token may be sent without TLS, which is only the
+	// case for builders on localhost (e.g. reached via SSH tunnels).
+	insecure bool
+}
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool { return !t.insecure }
+
+func loadCertPool(fn string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, xerrors.Errorf("%s: no PEM certificates found", fn)
+	}
+	return pool, nil
+}
+
+// dialBuilder connects to the remote builder at addr, using the credentials
+// configured in builders.d (see env.Builders).
+func dialBuilder(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	builders, err := env.Builders()
+	if err != nil {
+		return nil, err
+	}
+	cfg := builders[addr]
+	opts := []grpc.DialOption{grpc.WithBlock()}
+	useTLS := cfg.CACert != "" || cfg.Cert != ""
+	if cfg.AuthToken != "" && !useTLS && !isLoopback(addr) {
+		return nil, xerrors.Errorf("builder %s: refusing to send the auth= token without TLS, configure ca= in builders.d", addr)
+	}
+	if useTLS {
+		tlsConfig := &tls.Config{}
+		if cfg.CACert != "" {
+			pool, err := loadCertPool(cfg.CACert)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if cfg.Cert != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if cfg.AuthToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{
+			token:    cfg.AuthToken,
+			insecure: !useTLS,
+		}))
+	}
+	return grpc.DialContext(ctx, addr, opts...)
+}
+
 func builder(ctx context.Context, args []string) error {
 	fset := flag.NewFlagSet("builder", flag.ExitOnError)
 	var (
 		listenAddr = fset.String("listen",
 			"localhost:2019",
-			"[host]:port to serve gRPC requests on (unauthenticated)")
+			"[host]:port to serve gRPC requests on. Addresses other than localhost require -auth_token_file (with -tls_cert_file) or -tls_client_ca_file")
 
 		uploadBaseDir = fset.String("upload_base_dir",
 			"",
 			"directory in which to store uploaded files")
+
+		authTokenFile = fset.String("auth_token_file",
+			"",
+			"If non-empty, path to a file containing the bearer token which clients must send (see auth= in builders.d)")
+
+		tlsCertFile = fset.String("tls_cert_file",
+			"",
+			"If non-empty, path to the TLS certificate to serve gRPC requests with (requires -tls_key_file)")
+
+		tlsKeyFile = fset.String("tls_key_file",
+			"",
+			"If non-empty, path to the private key of -tls_cert_file")
+
+		tlsClientCAFile = fset.String("tls_client_ca_file",
+			"",
+			"If non-empty, path to the certificate authority which must have signed client certificates (mutual TLS, requires -tls_cert_file)")
 	)
 	addrfd := addrfd.RegisterFlags(fset)
 	fset.Usage = usage(fset, builderHelp)
@@ -205,12 +514,55 @@ func builder(ctx context.Context, args []string) error {
 
 	log.Printf("distriroot %q, listenAddr %q", env.DistriRoot, *listenAddr)
 
+	if !isLoopback(*listenAddr) {
+		if *authTokenFile == "" && *tlsClientCAFile == "" {
+			return xerrors.Errorf("refusing to serve unauthenticated requests on %q: specify -auth_token_file or -tls_client_ca_file", *listenAddr)
+		}
+		if *authTokenFile != "" && *tlsCertFile == "" {
+			return xerrors.Errorf("refusing to accept -auth_token_file tokens in cleartext on %q: specify -tls_cert_file", *listenAddr)
+		}
+	}
+
+	var opts []grpc.ServerOption
+	if *authTokenFile != "" {
+		b, err := ioutil.ReadFile(*authTokenFile)
+		if err != nil {
+			return err
+		}
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return xerrors.Errorf("%s: empty auth token", *authTokenFile)
+		}
+		auth := &tokenAuth{token: token}
+		opts = append(opts,
+			grpc.UnaryInterceptor(auth.unary),
+			grpc.StreamInterceptor(auth.stream))
+	}
+	if *tlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCertFile, *tlsKeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if *tlsClientCAFile != "" {
+			pool, err := loadCertPool(*tlsClientCAFile)
+			if err != nil {
+				return err
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else if *tlsClientCAFile != "" {
+		return xerrors.Errorf("-tls_client_ca_file requires -tls_cert_file")
+	}
+
 	ln, err := net.Listen("tcp", *listenAddr)
 	if err != nil {
 		return err
 	}
 	addrfd.MustWrite(ln.Addr().String())
-	srv := grpc.NewServer()
+	srv := grpc.NewServer(opts...)
 	bpb.RegisterBuildServer(srv, &buildsrv{
 		uploadBaseDir: *uploadBaseDir,
 	})
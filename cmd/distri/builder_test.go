@@ -2,6 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,6 +15,8 @@ import (
 	"testing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/prototext"
 
 	"github.com/google/go-cmp/cmp"
@@ -195,3 +200,189 @@ func TestBuilder(t *testing.T) {
 		// TODO: open buf as a squashfs file
 	})
 }
+
+func startBuilder(ctx context.Context, t *testing.T, args ...string) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go func() {
+		defer w.Close()
+		if err := builder(ctx, append(args,
+			"-listen=localhost:0",
+			fmt.Sprintf("-addrfd=%d", w.Fd()),
+		)); err != nil {
+			t.Error(err)
+		}
+	}()
+	addrb, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(addrb)
+}
+
+func TestBuilderListen(t *testing.T) {
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+	tmp, err := ioutil.TempDir("", "distri-test-builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tokenFile := filepath.Join(tmp, "builder.token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-listen=:0"},
+		{"-listen=:0", "-auth_token_file=" + tokenFile},
+	} {
+		if err := builder(ctx, append(args, "-upload_base_dir="+tmp)); err == nil {
+			t.Errorf("builder(%v) unexpectedly succeeded", args)
+		}
+	}
+}
+
+func TestBuilderStore(t *testing.T) {
+	ctx, canc := distri.InterruptibleContext()
+	defer canc()
+	tmp, err := ioutil.TempDir("", "distri-test-builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer distritest.RemoveAll(t, tmp)
+
+	uploadDir := filepath.Join(tmp, "upload")
+	tokenFile := filepath.Join(tmp, "builder.token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	addr := startBuilder(ctx, t,
+		"-upload_base_dir="+uploadDir,
+		"-auth_token_file="+tokenFile)
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		upcl, err := bpb.NewBuildClient(conn).Store(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upcl.Send(&bpb.Chunk{Path: "unauthenticated"})
+		if _, err := upcl.CloseAndRecv(); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Store without token: got %v, want code %v", err, codes.Unauthenticated)
+		}
+	})
+
+	// Configure the token like an administrator would in builders.d:
+	cfg := filepath.Join(tmp, "config")
+	if err := os.MkdirAll(filepath.Join(cfg, "builders.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg, "builders.d", "test.builder"), []byte(addr+" auth="+tokenFile+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	// Tokens must not be sent to remote builders without TLS:
+	if err := ioutil.WriteFile(filepath.Join(cfg, "builders.d", "remote.builder"), []byte("ws:2019 auth="+tokenFile+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialBuilder(ctx, "ws:2019"); err == nil {
+		t.Errorf("dialBuilder(ws:2019) unexpectedly succeeded without TLS")
+	}
+
+	conn, err := dialBuilder(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cl := bpb.NewBuildClient(conn)
+
+	contents := []byte("first-chunk\nsecond-chunk\n")
+	sum := sha256.Sum256(contents)
+	digest := hex.EncodeToString(sum[:])
+	storeChunks := func(path, digest string, chunks ...string) (*bpb.StoreResponse, error) {
+		upcl, err := cl.Store(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for idx, chunk := range chunks {
+			c := &bpb.Chunk{Chunk: []byte(chunk)}
+			if idx == 0 {
+				c.Path = path
+				c.Sha256 = digest
+			}
+			if err := upcl.Send(c); err != nil {
+				if err == io.EOF {
+					break // server replied early
+				}
+				return nil, err
+			}
+		}
+		return upcl.CloseAndRecv()
+	}
+	readFile := func(path string) string {
+		b, err := ioutil.ReadFile(filepath.Join(uploadDir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	resp, err := storeChunks("a/src.tar.gz", digest, "first-chunk\n", "second-chunk\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetAlreadyPresent() {
+		t.Errorf("first Store: unexpectedly already present")
+	}
+	if got, want := readFile("a/src.tar.gz"), string(contents); got != want {
+		t.Errorf("a/src.tar.gz: got %q, want %q", got, want)
+	}
+
+	// The same contents under a different path must not be transferred again:
+	resp, err = storeChunks("b/src.tar.gz", digest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.GetAlreadyPresent() {
+		t.Errorf("second Store: not already present")
+	}
+	if got, want := readFile("b/src.tar.gz"), string(contents); got != want {
+		t.Errorf("b/src.tar.gz: got %q, want %q", got, want)
+	}
+
+	if _, err := storeChunks("c/src.tar.gz", strings.Repeat("0", 64), "corrupt"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Store with wrong digest: got %v, want code %v", err, codes.InvalidArgument)
+	}
+
+	// Changed files replace previously stored files:
+	oldRoot := env.DistriRoot
+	env.DistriRoot = env.DistriRootDir(filepath.Join(tmp, "distriroot"))
+	defer func() { env.DistriRoot = oldRoot }()
+	fn := filepath.Join(string(env.DistriRoot), "a", "src.tar.gz")
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fn, []byte("updated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store(ctx, cl, "a/src.tar.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile("a/src.tar.gz"), "updated\n"; got != want {
+		t.Errorf("a/src.tar.gz after update: got %q, want %q", got, want)
+	}
+	if got, want := readFile("b/src.tar.gz"), string(contents); got != want {
+		t.Errorf("b/src.tar.gz after update: got %q, want %q", got, want)
+	}
+}
@@ -7,12 +7,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/distr1/distri/internal/extract"
 	"github.com/distr1/distri/internal/squashfs"
 	"golang.org/x/sys/unix"
 	"golang.org/x/xerrors"
@@ -117,12 +117,23 @@ func cp(w *squashfs.Directory, dir string) error {
 
 func convert(ctx context.Context, args []string) error {
 	fset := flag.NewFlagSet("convert", flag.ExitOnError)
-	var pkg = fset.String("pkg", "", "path to tar.gz package to convert to squashfs")
+	var (
+		pkg         = fset.String("pkg", "", "path to tar.gz package to convert to squashfs")
+		compression = fset.String("compression", "", "if non-empty, compression algorithm for data blocks (zlib or zstd)")
+	)
 	fset.Usage = usage(fset, convertHelp)
 	fset.Parse(args)
 	if *pkg == "" {
 		return xerrors.Errorf("required: -pkg")
 	}
+	var opts []squashfs.WriterOption
+	if *compression != "" {
+		c, err := squashfs.ParseCompression(*compression)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, squashfs.WithCompression(c))
+	}
 	log.Printf("converting %s to SquashFS", *pkg)
 	tmp, err := ioutil.TempDir("", "convert")
 	if err != nil {
@@ -131,11 +142,8 @@ func convert(ctx context.Context, args []string) error {
 	defer os.RemoveAll(tmp)
 
 	log.Printf("extracting")
-	cmd := exec.Command("tar", "xf", *pkg, "--strip-components=1")
-	cmd.Dir = tmp
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return xerrors.Errorf("%v: %v", cmd.Args, err)
+	if err := extract.Archive(*pkg, tmp, 1); err != nil {
+		return err
 	}
 
 	log.Printf("packing")
@@ -144,7 +152,7 @@ func convert(ctx context.Context, args []string) error {
 		return err
 	}
 
-	w, err := squashfs.NewWriter(out, time.Now())
+	w, err := squashfs.NewWriter(out, time.Now(), opts...)
 	if err != nil {
 		return err
 	}
@@ -137,22 +137,25 @@ func funcmain() error {
 			}
 			return nil
 		}},
-		"fusectl": {fusectl},
-		"export":  {export},
-		"env":     {printenv},
-		"mirror":  {mirror},
-		"batch":   {cmdbatch},
-		"log":     {showlog},
-		"unpack":  {unpack},
-		"update":  {update},
-		"gc":      {gc},
-		"patch":   {patch},
-		"bump":    {bump},
-		"builder": {builder},
-		"reset":   {reset},
-		"run":     {run},
-		"initrd":  {initrd},
-		"list":    {cmdlist},
+		"fusectl":     {fusectl},
+		"export":      {export},
+		"buildcache":  {cmdbuildcache},
+		"env":         {printenv},
+		"mirror":      {mirror},
+		"keygen":      {keygen},
+		"batch":       {cmdbatch},
+		"log":         {showlog},
+		"unpack":      {unpack},
+		"update":      {update},
+		"gc":          {gc},
+		"patch":       {patch},
+		"bump":        {bump},
+		"builder":     {builder},
+		"reset":       {reset},
+		"generations": {generations},
+		"run":         {run},
+		"initrd":      {initrd},
+		"list":        {cmdlist},
 	}
 
 	args := flag.Args()
@@ -170,7 +173,8 @@ func funcmain() error {
 			fmt.Fprintf(os.Stderr, "Installation commands:\n")
 			fmt.Fprintf(os.Stderr, "\tinstall  - install a distri package from a repository\n")
 			fmt.Fprintf(os.Stderr, "\tupdate   - update installed packages\n")
-			fmt.Fprintf(os.Stderr, "\treset    - reset packages to before an update\n")
+			fmt.Fprintf(os.Stderr, "\treset    - reset packages to a previous generation\n")
+			fmt.Fprintf(os.Stderr, "\tgenerations - list package store generations\n")
 			fmt.Fprintf(os.Stderr, "\tgc       - garbage collect unreferenced packages\n")
 			fmt.Fprintf(os.Stderr, "\tpack     - pack a distri system image\n")
 			fmt.Fprintf(os.Stderr, "\tinitrd   - pack a distri initramfs\n")
@@ -186,7 +190,9 @@ func funcmain() error {
 			fmt.Fprintln(os.Stderr)
 			fmt.Fprintf(os.Stderr, "Package store commands:\n")
 			fmt.Fprintf(os.Stderr, "\texport   - serve local package store to others\n")
+			fmt.Fprintf(os.Stderr, "\tbuildcache - serve a build cache to others\n")
 			fmt.Fprintf(os.Stderr, "\tmirror   - make a package store usable as a repository\n")
+			fmt.Fprintf(os.Stderr, "\tkeygen   - generate a key pair for signing repositories\n")
 			os.Exit(2)
 		}
 		verb = args[0]
@@ -28,6 +28,10 @@ func printenv(ctx context.Context, args []string) error {
 			fmt.Println(env.DistriConfig)
 		case "DEFAULTREPO":
 			fmt.Println(env.DefaultRepo)
+		case "DISTRIBUILDCACHE":
+			fmt.Println(env.BuildCache)
+		case "DISTRIBUILDCACHEAUTH":
+			fmt.Println(env.BuildCacheAuth)
 		}
 		return nil
 	}
@@ -35,5 +39,7 @@ func printenv(ctx context.Context, args []string) error {
 	fmt.Printf("DISTRICFG=%q\n", env.DistriConfig)
 	fmt.Printf("DEFAULTREPO=%q\n", env.DefaultRepo)
 	fmt.Printf("DEFAULTREPOROOT=%q\n", env.DefaultRepoRoot)
+	fmt.Printf("DISTRIBUILDCACHE=%q\n", env.BuildCache)
+	fmt.Printf("DISTRIBUILDCACHEAUTH=%q\n", env.BuildCacheAuth)
 	return nil
 }
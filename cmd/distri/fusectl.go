@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 )
 
@@ -18,6 +22,11 @@ Typically only used under the covers, or for debugging.
 
 Example:
   % distri fusectl -scan_packages
+  % distri fusectl -status
+  % distri fusectl -list_packages -opened
+  % distri fusectl -conflicts /bin
+  % distri fusectl -set_view=dev gcc make less
+  % distri fusectl -list_views
 `
 
 func fusectl(ctx context.Context, args []string) error {
@@ -25,6 +34,13 @@ func fusectl(ctx context.Context, args []string) error {
 	var (
 		mkdirAll     = fset.String("mkdirall", "", "if non-empty, sends a MkdirAll request")
 		scanPackages = fset.Bool("scan_packages", false, "sends a ScanPackages request")
+		status       = fset.Bool("status", false, "print the file system status and statistics")
+		listPackages = fset.Bool("list_packages", false, "list packages with their images and statistics")
+		opened       = fset.Bool("opened", false, "with -list_packages, only list packages whose image is opened")
+		conflicts    = fset.Bool("conflicts", false, "list exchange directory entries provided by more than one package, optionally restricted to the exchange directory given as positional argument (e.g. /bin)")
+		setView      = fset.String("set_view", "", "if non-empty, creates or replaces the view of this name (provided in /ro/.views/<name>), consisting of the packages given as positional arguments")
+		deleteView   = fset.String("delete_view", "", "if non-empty, deletes the view of this name")
+		listViews    = fset.Bool("list_views", false, "list views with their packages")
 	)
 	fset.Usage = usage(fset, fusectlHelp)
 	fset.Parse(args)
@@ -48,6 +64,64 @@ func fusectl(ctx context.Context, args []string) error {
 		if _, err := cl.ScanPackages(ctx, &pb.ScanPackagesRequest{}); err != nil {
 			return err
 		}
+	} else if *status {
+		resp, err := cl.Status(ctx, &pb.StatusRequest{})
+		if err != nil {
+			return err
+		}
+		printFUSEStatus(resp)
+	} else if *listPackages {
+		resp, err := cl.ListPackages(ctx, &pb.ListPackagesRequest{OpenedOnly: opened})
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "package\tsize\topened\treads\tread bytes\tdircache hit rate\tstream hit rate\timage\n")
+		for _, p := range resp.GetPackage() {
+			fmt.Fprintf(tw, "%s\t%d\t%v\t%d\t%d\t%s\t%s\t%s\n",
+				p.GetName(),
+				p.GetSize(),
+				p.GetOpened(),
+				p.GetReads(),
+				p.GetReadBytes(),
+				hitRate(p.GetDircacheHits(), p.GetDircacheMisses()),
+				hitRate(p.GetStreamHits(), p.GetStreamMisses()),
+				p.GetImage())
+		}
+		return tw.Flush()
+	} else if *conflicts {
+		resp, err := cl.ListConflicts(ctx, &pb.ListConflictsRequest{Dir: proto.String(fset.Arg(0))})
+		if err != nil {
+			return err
+		}
+		for _, c := range resp.GetConflict() {
+			fmt.Printf("%s → %s\n", c.GetPath(), c.GetTarget())
+			fmt.Printf("\tprovider:    %s (%s)\n", c.GetProvider(), c.GetReason())
+			fmt.Printf("\tprovided by: %s\n", strings.Join(c.GetPackage(), ", "))
+		}
+	} else if *setView != "" {
+		if _, err := cl.SetView(ctx, &pb.SetViewRequest{
+			Name:    setView,
+			Package: fset.Args(),
+		}); err != nil {
+			return err
+		}
+	} else if *deleteView != "" {
+		if _, err := cl.DeleteView(ctx, &pb.DeleteViewRequest{Name: deleteView}); err != nil {
+			return err
+		}
+	} else if *listViews {
+		resp, err := cl.ListViews(ctx, &pb.ListViewsRequest{})
+		if err != nil {
+			return err
+		}
+		for _, v := range resp.GetView() {
+			var configured string
+			if v.GetConfigured() {
+				configured = " (views.d)"
+			}
+			fmt.Printf("%s%s: %s\n", v.GetName(), configured, strings.Join(v.GetPackage(), " "))
+		}
 	} else {
 		resp, err := cl.Ping(ctx, &pb.PingRequest{})
 		if err != nil {
@@ -58,3 +132,31 @@ func fusectl(ctx context.Context, args []string) error {
 
 	return nil
 }
+
+// hitRate formats the cache hit rate of hits and misses as a percentage, or -
+// if the cache was not used.
+func hitRate(hits, misses uint64) string {
+	if hits+misses == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(hits)/float64(hits+misses))
+}
+
+func printFUSEStatus(st *pb.StatusReply) {
+	fmt.Printf("repo:          %s (section %s)\n", st.GetRepo(), st.GetSection())
+	fmt.Printf("autodownload:  %v (stream: %v)\n", st.GetAutodownload(), st.GetStream())
+	fmt.Printf("packages:      %d (%d opened)\n", st.GetPackages(), st.GetOpened())
+	fmt.Printf("reads:         %d (%d bytes)\n", st.GetReads(), st.GetReadBytes())
+	fmt.Printf("dircache:      %s hit rate (%d hits, %d misses)\n",
+		hitRate(st.GetDircacheHits(), st.GetDircacheMisses()),
+		st.GetDircacheHits(),
+		st.GetDircacheMisses())
+	if st.GetStream() {
+		fmt.Printf("stream cache:  %s hit rate (%d hits, %d misses), %d of %d MiB used\n",
+			hitRate(st.GetStreamHits(), st.GetStreamMisses()),
+			st.GetStreamHits(),
+			st.GetStreamMisses(),
+			st.GetStreamCacheUsed()/1024/1024,
+			st.GetStreamCacheBudget()/1024/1024)
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"strings"
 
 	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/roimg"
 	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 )
 
@@ -41,16 +43,27 @@ func gc(ctx context.Context, args []string) error {
 	fset.Usage = usage(fset, gcHelp)
 	fset.Parse(args)
 
-	store := *storeFlag
-	if store == "" {
-		store = filepath.Join(*root, "roimg")
+	storeDir := *storeFlag
+	if storeDir == "" {
+		storeDir = filepath.Join(*root, "roimg")
+	}
+
+	st, err := roimg.Lock(storeDir)
+	if err != nil {
+		return err
+	}
+	defer st.Unlock() // error paths only, see below
+	if *storeFlag == "" && !*dryRun {
+		if err := st.InitGenerations(*root); err != nil {
+			return err
+		}
 	}
 
 	// eligible maps from package (e.g. libudev) to a list of package
 	// versions (e.g. libudev-amd64-239-10) to be garbage collected.
 	eligible := make(map[string]map[string]bool)
 	{
-		matches, err := filepath.Glob(filepath.Join(store, "*.squashfs"))
+		matches, err := filepath.Glob(filepath.Join(storeDir, "*.squashfs"))
 		if err != nil {
 			return err
 		}
@@ -81,9 +94,7 @@ func gc(ctx context.Context, args []string) error {
 				revs = append(revs, distri.ParseVersion(pkg))
 			}
 			sort.Slice(revs, func(i, j int) bool {
-				revI := revs[i].DistriRevision
-				revJ := revs[j].DistriRevision
-				return revI >= revJ // reverse
+				return revs[i].Compare(revs[j]) > 0 // reverse
 			})
 			mostRecent := revs[0].String()
 			delete(eligible[pkg], mostRecent) // keep in store
@@ -94,7 +105,7 @@ func gc(ctx context.Context, args []string) error {
 		// separate pass so that we can clearly attribute which package causes
 		// which other packages to stick around.
 		for _, mostRecent := range kept {
-			meta, err := pb.ReadMetaFile(filepath.Join(store, mostRecent+".meta.textproto"))
+			meta, err := pb.ReadMetaFile(filepath.Join(storeDir, mostRecent+".meta.textproto"))
 			if err != nil {
 				return err
 			}
@@ -106,30 +117,42 @@ func gc(ctx context.Context, args []string) error {
 	}
 
 	// delete all eligible packages (first .meta.textproto, then .squashfs)
+	var removed []string
 	for _, pkgs := range eligible {
 		for pkg := range pkgs {
-			for _, suffix := range []string{".meta.textproto", ".squashfs"} {
-				fn := filepath.Join(store, pkg+suffix)
-				if *dryRun {
-					fmt.Printf("rm '%s'\n", fn)
-				} else {
-					if err := os.Remove(fn); err != nil {
-						return err
-					}
+			if *dryRun {
+				for _, suffix := range []string{".meta.textproto", ".squashfs"} {
+					fmt.Printf("rm '%s'\n", filepath.Join(storeDir, pkg+suffix))
 				}
+				continue
+			}
+			if err := st.Remove(pkg); err != nil {
+				return err
 			}
+			removed = append(removed, pkg)
 		}
 	}
 
-	if *storeFlag != "" {
-		// Not operating on a running system; skip the ScanPackages call.
-		return nil
+	if *storeFlag == "" && st.Modified() {
+		if err := st.RecordGeneration(*root, &pb.Generation{
+			Operation: proto.String("gc"),
+		}); err != nil {
+			return err
+		}
 	}
 
-	// TODO(correctness): delete all .squashfs without corresponding
-	// .meta.textproto (to recover from interruptions)
+	if err := st.Unlock(); err != nil {
+		return err
+	}
+
+	if *storeFlag != "" || len(removed) == 0 {
+		// Not operating on a running system, or nothing to remove; skip the
+		// RemovePackages call.
+		return nil
+	}
 
-	// Make the FUSE daemon update its packages.
+	// Make the FUSE daemon close the images of the removed packages, so that
+	// their disk space is released.
 	ctl, err := os.Readlink(filepath.Join(*root, "ro", "ctl"))
 	if err != nil {
 		log.Printf("not updating FUSE daemon: %v", err)
@@ -142,7 +165,7 @@ func gc(ctx context.Context, args []string) error {
 		return err
 	}
 	cl := pb.NewFUSEClient(conn)
-	if _, err := cl.ScanPackages(ctx, &pb.ScanPackagesRequest{}); err != nil {
+	if _, err := cl.RemovePackages(ctx, &pb.RemovePackagesRequest{Package: removed}); err != nil {
 		return err
 	}
 
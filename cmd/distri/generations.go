@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/distr1/distri/internal/roimg"
+)
+
+const generationsHelp = `distri generations [-flags]
+
+List the recorded generations of the package store, i.e. its contents after
+each install, update, gc and reset operation. Restore a generation using
+distri reset -generation=<N>.
+
+Example:
+  % distri generations
+  % distri generations -generation=3
+`
+
+func generations(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("generations", flag.ExitOnError)
+	var (
+		root = fset.String("root",
+			"/",
+			"root directory for optionally operating on a chroot")
+
+		generation = fset.Int64("generation",
+			0,
+			"if non-zero, list the packages of the specified generation")
+	)
+	fset.Usage = usage(fset, generationsHelp)
+	fset.Parse(args)
+
+	if *generation > 0 {
+		gen, err := roimg.Generation(*root, *generation)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range gen.GetPackage() {
+			fmt.Println(pkg)
+		}
+		return nil
+	}
+
+	gens, err := roimg.Generations(*root)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "GENERATION\tDATE\tOPERATION\tPKGSET\tKERNEL\tPACKAGES\n")
+	for _, gen := range gens {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\n",
+			gen.GetId(),
+			time.Unix(gen.GetTimestamp(), 0).Format("2006-01-02 15:04:05"),
+			gen.GetOperation(),
+			gen.GetPkgset(),
+			gen.GetKernel(),
+			len(gen.GetPackage()))
+	}
+	return tw.Flush()
+}
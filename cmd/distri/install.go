@@ -29,6 +29,8 @@ func cmdinstall(ctx context.Context, args []string) error {
 
 		update = fset.Bool("update", false, "internal flag set by distri update, do not use")
 
+		insecure = fset.Bool("insecure", false, "install packages from repositories for which no trusted keys are configured in keys.d without verifying them")
+
 		//pkg = fset.String("pkg", "", "path to .squashfs package to mount")
 	)
 	fset.Usage = usage(fset, installHelp)
@@ -37,7 +39,7 @@ func cmdinstall(ctx context.Context, args []string) error {
 		return xerrors.Errorf("syntax: install [options] <package> [<package>...]")
 	}
 
-	c := &install.Ctx{}
+	c := &install.Ctx{Insecure: *insecure}
 	if *repo != "" {
 		*repo = *repo + "/pkg"
 	}
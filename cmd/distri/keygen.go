@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const keygenHelp = `distri keygen [-flags] <path/to/key>
+
+Generate an ed25519 key pair for signing repository indexes.
+
+The private key is written to the specified path, the public key to path.pub.
+Install the public key into /etc/distri/keys.d/ on machines which should trust
+repositories signed with the private key (see distri mirror -signing_key).
+
+Example:
+  % distri keygen ~/.config/distri/repo.key
+  % sudo cp ~/.config/distri/repo.key.pub /etc/distri/keys.d/
+`
+
+// readPrivateKey reads a base64-encoded ed25519 private key as written by
+// distri keygen.
+func readPrivateKey(fn string) (ed25519.PrivateKey, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %v", fn, err)
+	}
+	if got, want := len(key), ed25519.PrivateKeySize; got != want {
+		return nil, xerrors.Errorf("%s: invalid key size: got %d, want %d", fn, got, want)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+func keygen(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("keygen", flag.ExitOnError)
+	fset.Usage = usage(fset, keygenHelp)
+	fset.Parse(args)
+	if fset.NArg() != 1 {
+		fset.Usage()
+		os.Exit(2)
+	}
+	fn := fset.Arg(0)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	// O_EXCL: never overwrite an existing private key
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, base64.StdEncoding.EncodeToString(priv)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fn+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0644); err != nil {
+		return err
+	}
+	log.Printf("wrote private key to %s, public key to %s.pub", fn, fn)
+	return nil
+}
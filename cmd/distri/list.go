@@ -54,8 +54,8 @@ func list(ctx context.Context, listRepo string, prefix []string) error {
 		}
 	}
 	// TODO: fetch metadata from repos concurrently
-	metas := make(map[*pb.MirrorMeta]distri.Repo)
-	for _, r := range repos {
+	listed := make(map[string]bool)
+	for _, r := range repos { // ordered by priority
 		rd, err := repo.Reader(context.Background(), r, "meta.binaryproto", true /* cache */)
 		if err != nil {
 			if isNotExist(err) {
@@ -72,13 +72,11 @@ func list(ctx context.Context, listRepo string, prefix []string) error {
 		if err := proto.Unmarshal(b, &pm); err != nil {
 			return err
 		}
-		metas[&pm] = r
-	}
-	for m := range metas {
-		for _, pkg := range m.GetPackage() {
-			if !hasPrefix(pkg.GetName(), prefix) {
+		for _, pkg := range pm.GetPackage() {
+			if listed[pkg.GetName()] || !hasPrefix(pkg.GetName(), prefix) {
 				continue
 			}
+			listed[pkg.GetName()] = true
 			fmt.Println(pkg.GetName())
 		}
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"flag"
 	"io/ioutil"
 	"log"
@@ -9,11 +10,13 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/distr1/distri/internal/fuse"
+	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/internal/repo"
 	"github.com/distr1/distri/internal/squashfs"
 	"github.com/distr1/distri/pb"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/renameio"
+	"golang.org/x/xerrors"
 )
 
 const mirrorHelp = `distri mirror [-flags]
@@ -23,9 +26,13 @@ by bundling metadata from packages into meta.binaryproto.
 
 This is not required for distri install to work, but e.g. for debugfs.
 
+When -signing_key is specified, a signed index (SHA256SUMS) of all packages is
+written as well, which distri install verifies if trusted keys are configured
+in /etc/distri/keys.d.
+
 Example:
   % cd distri/build/distri/pkg
-  % distri mirror
+  % distri mirror -signing_key=$HOME/.config/distri/repo.key
 `
 
 // TODO: have export automatically call mirror
@@ -53,9 +60,28 @@ func walk(rd *squashfs.Reader, dirInode squashfs.Inode, dir string) ([]string, e
 
 func mirror(ctx context.Context, args []string) error {
 	fset := flag.NewFlagSet("mirror", flag.ExitOnError)
+	var (
+		signingKey = fset.String("signing_key",
+			"",
+			"if non-empty, path to an ed25519 private key (see distri keygen) with which to sign the repository index")
+	)
 	fset.Usage = usage(fset, mirrorHelp)
 	fset.Parse(args)
 
+	var key ed25519.PrivateKey
+	if *signingKey != "" {
+		var err error
+		key, err = readPrivateKey(*signingKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	exchangeDirs, err := env.ExchangeDirs()
+	if err != nil {
+		return err
+	}
+
 	var mm pb.MirrorMeta
 
 	fis, err := ioutil.ReadDir(".")
@@ -79,7 +105,20 @@ func mirror(ctx context.Context, args []string) error {
 		if err != nil {
 			return err
 		}
-		for _, wk := range fuse.ExchangeDirs {
+		// Include the exchange directories declared by the package itself:
+		wellKnown := exchangeDirs
+		meta, err := pb.ReadMetaFile(pkg + ".meta.textproto")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, dir := range meta.GetExchangeDir() {
+			cleaned, err := env.CleanExchangeDir(dir)
+			if err != nil {
+				return xerrors.Errorf("%s: %v", pkg, err)
+			}
+			wellKnown = append(wellKnown[:len(wellKnown):len(wellKnown)], cleaned)
+		}
+		for _, wk := range wellKnown {
 			wk = strings.TrimPrefix(wk, "/")
 			inode, err := rd.LookupPath(wk)
 			if err != nil {
@@ -111,5 +150,12 @@ func mirror(ctx context.Context, args []string) error {
 	}
 	log.Printf("wrote %d packages to meta.binaryproto (%d bytes)", len(mm.Package), len(b))
 
+	if key != nil {
+		if err := repo.WriteIndex(".", key); err != nil {
+			return err
+		}
+		log.Printf("wrote signed index %s", repo.IndexFile)
+	}
+
 	return nil
 }
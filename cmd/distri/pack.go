@@ -221,6 +221,10 @@ func pack(ctx context.Context, args []string) error {
 
 		c := &install.Ctx{
 			SkipContentHooks: true,
+			// The local build output (the default -repo) is not signed, but
+			// remote repositories must be verified.
+			Insecure: !strings.HasPrefix(p.repo, "http://") &&
+				!strings.HasPrefix(p.repo, "https://"),
 		}
 		if err := c.Packages([]string{
 			"base",
@@ -427,6 +431,10 @@ HOME_URL=https://distr1.org
 
 	c := &install.Ctx{
 		SkipContentHooks: true,
+		// The local build output (the default -repo) is not signed, but
+		// remote repositories must be verified.
+		Insecure: !strings.HasPrefix(p.repo, "http://") &&
+			!strings.HasPrefix(p.repo, "https://"),
 	}
 	if err := c.Packages(basePkgs, root, p.repo, false); err != nil {
 		return err
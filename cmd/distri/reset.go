@@ -3,21 +3,33 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+
+	"github.com/distr1/distri/internal/install"
+	"github.com/distr1/distri/internal/roimg"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
 )
 
-const resetHelp = `distri reset [-flags] <path/to/files.before.txt>
+const resetHelp = `distri reset [-flags] -generation=<N>
+distri reset [-flags] <path/to/files.before.txt>
+
+Reset your package store to the contents of the specified generation (see
+distri generations). Packages which were deleted in the meantime (e.g. by
+distri gc) are re-installed from the configured repositories, regardless of
+pins and holds in pins.d. If re-installing fails, no packages are deleted.
 
-Reset your package store to the contents specified by the provided
-files.before.txt, which distri updates writes.
+For compatibility, the file listings which older versions of distri update wrote
+are accepted, too.
 
 Example:
-  % distri reset /var/log/distri/update-1561126278/files.before.txt
+  % distri generations
+  % distri reset -generation=3 -w
 `
 
 func reset(ctx context.Context, args []string) error {
@@ -29,48 +41,130 @@ func reset(ctx context.Context, args []string) error {
 		write = fset.Bool("w",
 			false,
 			"write changes (default is dry run)")
+		generation = fset.Int64("generation",
+			0,
+			"generation to restore (see distri generations)")
+		repo = fset.String("repo", "", "repository from which to re-install deleted packages. path (default TODO) or HTTP URL (e.g. TODO)")
+
+		insecure = fset.Bool("insecure", false, "install packages from repositories for which no trusted keys are configured in keys.d without verifying them")
 	)
 	fset.Usage = usage(fset, resetHelp)
 	fset.Parse(args)
 
-	if fset.NArg() != 1 {
+	var (
+		pkgs []string
+		from string
+	)
+	switch {
+	case *generation > 0 && fset.NArg() == 0:
+		gen, err := roimg.Generation(*root, *generation)
+		if err != nil {
+			return err
+		}
+		pkgs = gen.GetPackage()
+		from = fmt.Sprintf("generation %d", gen.GetId())
+
+	case *generation == 0 && fset.NArg() == 1:
+		before := fset.Arg(0)
+		b, err := ioutil.ReadFile(before)
+		if err != nil {
+			return err
+		}
+		for _, n := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			if strings.HasSuffix(n, ".squashfs") {
+				pkgs = append(pkgs, strings.TrimSuffix(n, ".squashfs"))
+			}
+		}
+		from = "contents " + before
+
+	default:
 		fset.Usage()
 		os.Exit(2)
 	}
-	before := fset.Arg(0)
-	b, err := ioutil.ReadFile(before)
-	if err != nil {
-		return err
-	}
-	pkgs := strings.Split(strings.TrimSpace(string(b)), "\n")
 	keep := make(map[string]bool, len(pkgs))
 	for _, pkg := range pkgs {
 		keep[pkg] = true
 	}
-	roimg := filepath.Join(*root, "roimg")
-	log.Printf("resetting package store %s to contents %s", roimg, before)
-	f, err := os.Open(roimg)
+
+	storeDir := filepath.Join(*root, "roimg")
+	log.Printf("resetting package store %s to %s", storeDir, from)
+	// remove deletes all packages which are not part of the target state.
+	remove := func(st *roimg.Store) error {
+		present, err := st.Packages()
+		if err != nil {
+			return err
+		}
+		for _, pkg := range present {
+			if keep[pkg] {
+				continue
+			}
+			log.Printf("deleting %s", pkg)
+			if !*write {
+				continue
+			}
+			if err := st.Remove(pkg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	st, err := roimg.Lock(storeDir)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	names, err := f.Readdirnames(-1)
+	present, err := st.Packages()
 	if err != nil {
+		st.Unlock()
 		return err
 	}
-	sort.Strings(names)
-	for _, n := range names {
-		if keep[n] {
+	isPresent := make(map[string]bool, len(present))
+	for _, pkg := range present {
+		isPresent[pkg] = true
+	}
+	var missing []string
+	for _, pkg := range pkgs {
+		if isPresent[pkg] {
 			continue
 		}
-		log.Printf("deleting %s", n)
-		if !*write {
-			continue
+		log.Printf("re-installing %s", pkg)
+		missing = append(missing, pkg)
+	}
+	if !*write || len(missing) == 0 {
+		defer st.Unlock() // error paths only, see below
+		if *write {
+			if err := st.InitGenerations(*root); err != nil {
+				return err
+			}
 		}
-		if err := os.Remove(filepath.Join(roimg, n)); err != nil {
+		if err := remove(st); err != nil {
 			return err
 		}
+		if st.Modified() {
+			if err := st.RecordGeneration(*root, &pb.Generation{
+				Operation: proto.String("reset"),
+			}); err != nil {
+				return err
+			}
+		}
+		return st.Unlock()
+	}
+	if err := st.Unlock(); err != nil {
+		return err
 	}
 
-	return nil
+	// Re-install the missing packages first, so that a failed download does not
+	// leave behind a half-reset store. Packages are deleted afterwards, and the
+	// resulting generation is recorded, while still holding the store lock.
+	c := &install.Ctx{
+		Operation: "reset",
+		// Restore exactly the package versions of the generation:
+		IgnorePins: true,
+		Modify:     remove,
+		Insecure:   *insecure,
+	}
+	if *repo != "" {
+		*repo = *repo + "/pkg"
+	}
+	return c.Packages(missing, *root, *repo, false)
 }
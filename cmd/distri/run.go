@@ -31,12 +31,14 @@ Requires the distri binary to have capability CAP_SYS_ADMIN.
 Example:
   % distri run i3status --version
   % distri run -pkgs=coreutils ls
+  % distri run -view=dev make
 `
 
 func run(ctx context.Context, args []string) error {
 	fset := flag.NewFlagSet("run", flag.ExitOnError)
 	var (
 		pkgs = fset.String("pkgs", "", "comma-separated list of packages to make available in the namespace. defaults to cmd[0]")
+		view = fset.String("view", "", "if non-empty, the name of a view of the system-wide FUSE file system (see distri fusectl -set_view) whose exchange directories to make available in the namespace, instead of mounting a FUSE file system")
 	)
 	fset.Usage = usage(fset, runHelp)
 	fset.Parse(args)
@@ -45,6 +47,22 @@ func run(ctx context.Context, args []string) error {
 		return xerrors.Errorf("syntax: distri run [-flags] <cmd>")
 	}
 	cmd := fset.Args()
+	if *view != "" && *pkgs != "" {
+		return xerrors.Errorf("-view and -pkgs are mutually exclusive")
+	}
+	// root is the directory (within the namespace) which contains the
+	// exchange directories:
+	root := "/ro"
+	if *view != "" {
+		var err error
+		root, err = viewRoot(*view)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(root); err != nil {
+			return xerrors.Errorf("view %q: %w", *view, err)
+		}
+	}
 
 	p := &build.Ctx{
 		Arch: runtime.GOARCH, // TODO: -cross flag
@@ -61,7 +79,9 @@ func run(ctx context.Context, args []string) error {
 	if err := os.MkdirAll(origdir, 0755); err != nil {
 		return err
 	}
-	if err := syscall.Mount("/", origdir, "none", syscall.MS_BIND /*|syscall.MS_RDONLY*/, ""); err != nil {
+	// MS_REC makes submounts (e.g. the system-wide FUSE file system on /ro,
+	// which -view uses) available underneath origdir, too.
+	if err := syscall.Mount("/", origdir, "none", syscall.MS_BIND|syscall.MS_REC /*|syscall.MS_RDONLY*/, ""); err != nil {
 		return xerrors.Errorf("mount: %w", err)
 	}
 	// TODO: don’t run os.RemoveAll if this fails! wipes out homedir
@@ -106,11 +126,11 @@ func run(ctx context.Context, args []string) error {
 	}
 	for _, link := range []symlink{
 		{"/", "usr"},
-		{"/ro/bin", "bin"},
-		{"/ro/share", "share"},
-		{"/ro/lib", "lib"},
-		{"/ro/include", "include"},
-		{"/ro/sbin", "sbin"},
+		{root + "/bin", "bin"},
+		{root + "/share", "share"},
+		{root + "/lib", "lib"},
+		{root + "/include", "include"},
+		{root + "/sbin", "sbin"},
 		{"/init", "entrypoint"},
 	} {
 		if err := os.Symlink(link.oldname, filepath.Join(chrootDir, link.newname)); err != nil {
@@ -118,6 +138,24 @@ func run(ctx context.Context, args []string) error {
 		}
 	}
 
+	const pad = 0
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 1, pad, pad, pad); err != nil {
+		return fmt.Errorf("prctl: %v", err)
+	}
+
+	if *view != "" {
+		// Use the system-wide FUSE file system, which provides the view:
+		if err := os.Symlink("/ORIG/ro", filepath.Join(chrootDir, "ro")); err != nil {
+			return err
+		}
+		os.Setenv("PATH", filepath.Join(root, "bin"))
+		lp, err := exec.LookPath(cmd[0])
+		if err != nil {
+			return err
+		}
+		return runChroot(chrootDir, lp, cmd[1:])
+	}
+
 	// mount fuse
 	deps := []string{
 		"bash",
@@ -153,33 +191,41 @@ func run(ctx context.Context, args []string) error {
 	}
 	defer fuse.Unmount(depsdir)
 
-	const pad = 0
-	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 1, pad, pad, pad); err != nil {
-		return fmt.Errorf("prctl: %v", err)
+	os.Setenv("PATH", filepath.Join(depsdir, "bin"))
+	lp, err := exec.LookPath(cmd[0])
+	if err != nil {
+		return err
 	}
-	{
-		os.Setenv("PATH", filepath.Join(depsdir, "bin"))
-		lp, err := exec.LookPath(cmd[0])
-		if err != nil {
-			return err
-		}
-		rel, err := filepath.Rel(chrootDir, lp)
-		if err != nil {
-			return err
-		}
-		cmd := exec.Command("/"+rel, cmd[1:]...)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Cloneflags:                 unix.CLONE_NEWNS | unix.CLONE_NEWUSER,
-			Chroot:                     chrootDir,
-			GidMappingsEnableSetgroups: false,
-		}
-		if err := cmd.Run(); err != nil {
-			return xerrors.Errorf("%v: %v", cmd.Args, err)
-		}
+	rel, err := filepath.Rel(chrootDir, lp)
+	if err != nil {
+		return err
 	}
+	return runChroot(chrootDir, "/"+rel, cmd[1:])
+}
 
+// viewRoot returns the directory which contains the exchange directories of
+// the specified view of the system-wide FUSE file system.
+func viewRoot(view string) (string, error) {
+	if err := cmdfuse.ValidViewName(view); err != nil {
+		return "", err
+	}
+	return "/ro/.views/" + view, nil
+}
+
+// runChroot runs the program at path (within chrootDir) in a new mount and user
+// namespace, chrooted into chrootDir.
+func runChroot(chrootDir, path string, args []string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 unix.CLONE_NEWNS | unix.CLONE_NEWUSER,
+		Chroot:                     chrootDir,
+		GidMappingsEnableSetgroups: false,
+	}
+	if err := cmd.Run(); err != nil {
+		return xerrors.Errorf("%v: %v", cmd.Args, err)
+	}
 	return nil
 }
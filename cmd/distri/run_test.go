@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestViewRoot(t *testing.T) {
+	for _, tt := range []struct {
+		view    string
+		want    string
+		wantErr bool
+	}{
+		{view: "dev", want: "/ro/.views/dev"},
+		{view: "", wantErr: true},
+		{view: ".", wantErr: true},
+		{view: "..", wantErr: true},
+		{view: "../../etc", wantErr: true},
+		{view: "dev/bin", wantErr: true},
+	} {
+		t.Run(tt.view, func(t *testing.T) {
+			got, err := viewRoot(tt.view)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("viewRoot(%q) = %v, want error %v", tt.view, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("viewRoot(%q) = %q, want %q", tt.view, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,30 +3,62 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/distr1/distri/internal/install"
+	"github.com/distr1/distri/internal/roimg"
 	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
 	"golang.org/x/xerrors"
 )
 
 const updateHelp = `distri update [-flags]
 
-Update installed packages.
+Update installed packages. The resulting package store contents are recorded
+as a new generation, see distri generations and distri reset.
+
+Packages can be pinned to versions matching a constraint or pattern, or held
+at their installed version, in /etc/distri/pins.d/*.pins files:
+
+  % cat /etc/distri/pins.d/production.pins
+  linux >=5.4, <5.6
+  systemd 245-*
+  glibc hold
 
 Example:
   % distri update
 `
 
-func update(ctx context.Context, args []string) error {
+// recordUpdate records the packages which all install.Ctx.Packages calls of
+// one distri update installed as a single generation.
+func recordUpdate(root, pkgset string) error {
+	st, err := roimg.Lock(filepath.Join(root, "roimg"))
+	if err != nil {
+		return err
+	}
+	defer st.Unlock() // error paths only, see below
+	changed, err := st.Changed(root)
+	if err != nil {
+		return err
+	}
+	if changed {
+		gen := &pb.Generation{Operation: proto.String("update")}
+		if pkgset != "" {
+			gen.Pkgset = proto.String(pkgset)
+		}
+		if err := st.RecordGeneration(root, gen); err != nil {
+			return err
+		}
+	}
+	return st.Unlock()
+}
+
+func update(ctx context.Context, args []string) (err error) {
 	fset := flag.NewFlagSet("update", flag.ExitOnError)
 	var (
 		root = fset.String("root",
@@ -35,6 +67,8 @@ func update(ctx context.Context, args []string) error {
 
 		repo   = fset.String("repo", "", "repository from which to install packages from. path (default TODO) or HTTP URL (e.g. TODO)")
 		pkgset = fset.String("pkgset", "", "if non-empty, a package set to update")
+
+		insecure = fset.Bool("insecure", false, "install packages from repositories for which no trusted keys are configured in keys.d without verifying them")
 	)
 	fset.Usage = usage(fset, updateHelp)
 	fset.Parse(args)
@@ -43,17 +77,14 @@ func update(ctx context.Context, args []string) error {
 		*repo = *repo + "/pkg"
 	}
 
-	updateStart := time.Now()
-	if v, err := strconv.ParseInt(os.Getenv("UPDATE_START"), 0, 64); err == nil {
-		updateStart = time.Unix(v, 0)
-	}
-
+	// Every modification of the package store is recorded as a generation, see
+	// distri generations and distri reset. All packages installed by one update
+	// (including by the re-executed process) are recorded as one generation.
 	if os.Getenv("DISTRI_REEXEC") != "1" {
-		if err := persistFileListing(fileListingFileName(*root, updateStart, "files.before.txt"), filepath.Join(*root, "roimg")); err != nil {
-			return err
+		c := &install.Ctx{
+			SkipGeneration: true,
+			Insecure:       *insecure,
 		}
-
-		c := &install.Ctx{}
 		if err := c.Packages([]string{"distri1"}, *root, *repo, false); err != nil {
 			return err
 		}
@@ -62,8 +93,7 @@ func update(ctx context.Context, args []string) error {
 		log.Printf("re-executing %v", cmd.Args)
 		// TODO: clean the environment
 		cmd.Env = append(os.Environ(),
-			"DISTRI_REEXEC=1",
-			fmt.Sprintf("UPDATE_START=%d", updateStart.Unix()))
+			"DISTRI_REEXEC=1")
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
@@ -72,7 +102,17 @@ func update(ctx context.Context, args []string) error {
 		return nil
 	}
 
-	c := &install.Ctx{}
+	defer func() {
+		// Record the packages installed so far even if the update failed.
+		if rerr := recordUpdate(*root, *pkgset); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+
+	c := &install.Ctx{
+		SkipGeneration: true,
+		Insecure:       *insecure,
+	}
 	if err := c.Packages([]string{"base"}, *root, *repo, false); err != nil {
 		return err
 	}
@@ -108,41 +148,9 @@ func update(ctx context.Context, args []string) error {
 		return nil
 	}
 
-	c = &install.Ctx{}
-	if err := c.Packages(pkgs, *root, *repo, true); err != nil {
-		// try to persist an after file listing (best effort)
-		if err := persistFileListing(fileListingFileName(*root, updateStart, "files.after.txt"), filepath.Join(*root, "roimg")); err != nil {
-			log.Println(err)
-		}
-		return err
-	}
-
-	if err := persistFileListing(fileListingFileName(*root, updateStart, "files.after.txt"), filepath.Join(*root, "roimg")); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func fileListingFileName(root string, timestamp time.Time, basename string) string {
-	return filepath.Join(root, "var", "log", "distri", fmt.Sprintf("update-%v", timestamp.Unix()), basename)
-}
-
-func persistFileListing(destfn string, dir string) error {
-	if err := os.MkdirAll(filepath.Dir(destfn), 0755); err != nil {
-		return err
-	}
-	d, err := os.Open(dir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return ioutil.WriteFile(destfn, nil, 0644)
-		}
-		return err
-	}
-	defer d.Close()
-	names, err := d.Readdirnames(-1)
-	if err != nil {
-		return err
+	c = &install.Ctx{
+		SkipGeneration: true,
+		Insecure:       *insecure,
 	}
-	return ioutil.WriteFile(destfn, []byte(strings.Join(names, "\n")+"\n"), 0644)
+	return c.Packages(pkgs, *root, *repo, true)
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distr1/distri/internal/roimg"
+)
+
+func TestRecordUpdate(t *testing.T) {
+	root, err := ioutil.TempDir("", "distritest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Two packages installed by separate install contexts, neither of which
+	// recorded a generation:
+	for _, pkg := range []string{"distri1-amd64-1", "hello-amd64-1"} {
+		st, err := roimg.Lock(filepath.Join(root, "roimg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		staging := filepath.Join(root, "roimg", "tmp", "."+pkg)
+		if err := os.MkdirAll(staging, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, fn := range []string{pkg + ".meta.textproto", pkg + ".squashfs"} {
+			if err := ioutil.WriteFile(filepath.Join(staging, fn), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := st.Install(pkg, staging); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Recording again without modifying the store must not add a generation:
+	for i := 0; i < 2; i++ {
+		if err := recordUpdate(root, "dev"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gens, err := roimg.Generations(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(gens), 1; got != want {
+		t.Fatalf("unexpected number of generations: got %d, want %d", got, want)
+	}
+	gen := gens[0]
+	if got, want := gen.GetOperation(), "update"; got != want {
+		t.Errorf("unexpected operation: got %q, want %q", got, want)
+	}
+	if got, want := gen.GetPkgset(), "dev"; got != want {
+		t.Errorf("unexpected pkgset: got %q, want %q", got, want)
+	}
+	if got, want := len(gen.GetPackage()), 2; got != want {
+		t.Errorf("unexpected number of packages: got %d (%v), want %d", got, gen.GetPackage(), want)
+	}
+}
@@ -1,5 +1,7 @@
 package distri
 
+import "crypto/ed25519"
+
 type Repo struct {
 	// Path is a file system path (e.g. /home/michael/distri/build/distri) or
 	// HTTP URL (e.g. http://repo.distr1.org/).
@@ -7,4 +9,30 @@ type Repo struct {
 
 	// PkgPath is Path/pkg (e.g. /home/michael/distri/build/distri/pkg).
 	PkgPath string
+
+	// Priority orders repositories which offer the same package: the version
+	// from the repository with the highest priority is used, even if other
+	// repositories offer newer versions. Defaults to 0.
+	Priority int
+
+	// Keys, if non-empty, are the only keys trusted to sign the index of this
+	// repository, overriding the globally trusted keys.
+	Keys []ed25519.PublicKey
+
+	// Sections overrides the path or URL of repository sections (pkg, debug,
+	// src), which are located within Path by default.
+	Sections map[string]string
+
+	// AuthToken, if non-empty, is sent as bearer token in HTTP requests to
+	// the host of Path.
+	AuthToken string
+}
+
+// Section returns the path or URL of the specified repository section (one of
+// pkg, debug, src).
+func (r Repo) Section(name string) string {
+	if p, ok := r.Sections[name]; ok {
+		return p
+	}
+	return r.Path + "/" + name
 }
@@ -15,6 +15,7 @@ require (
 	github.com/orcaman/writerseeker v0.0.0-20180723184025-774071c66cec
 	github.com/protocolbuffers/txtpbfmt v0.0.0-20191018194151-ab9b9b21328a
 	github.com/s-urbaniak/uevent v1.0.0
+	github.com/ulikunitz/xz v0.5.12
 	golang.org/x/exp v0.0.0-20190221220918-438050ddec5e
 	golang.org/x/mod v0.2.0
 	golang.org/x/net v0.0.0-20200425230154-ff2c4b7c35a0
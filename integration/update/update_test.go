@@ -17,8 +17,8 @@ import (
 	"github.com/distr1/distri"
 	"github.com/distr1/distri/internal/distritest"
 	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/internal/roimg"
 	"github.com/distr1/distri/pb"
-	"github.com/google/go-cmp/cmp"
 )
 
 func resolve1(imgDir, pkg string) ([]string, error) {
@@ -143,29 +143,32 @@ func TestUpdate(t *testing.T) {
 		t.Errorf("strace was not upgraded (via base-full)")
 	}
 
-	t.Run("VerifyBeforeAfterLog", func(t *testing.T) {
-		matches, err := filepath.Glob(filepath.Join(tmpdir, "var", "log", "distri", "*"))
+	t.Run("VerifyGenerations", func(t *testing.T) {
+		gens, err := roimg.Generations(tmpdir)
 		if err != nil {
 			t.Fatal(err)
 		}
-		updateDir := matches[0]
-
-		b, err := ioutil.ReadFile(filepath.Join(updateDir, "files.before.txt"))
-		if err != nil {
-			t.Fatal(err)
+		if len(gens) == 0 {
+			t.Fatalf("no generations recorded")
 		}
-		got := string(b)
-		if diff := cmp.Diff("", got); diff != "" {
-			t.Errorf("files.before.txt: unexpected content: diff (-want +got):\n%s", diff)
+		last := gens[len(gens)-1]
+		if got, want := last.GetId(), int64(len(gens)); got != want {
+			t.Errorf("last generation: unexpected id: got %d, want %d", got, want)
 		}
-
-		b, err = ioutil.ReadFile(filepath.Join(updateDir, "files.after.txt"))
-		if err != nil {
-			t.Fatal(err)
+		if got, want := last.GetOperation(), "update"; got != want {
+			t.Errorf("last generation: unexpected operation: got %q, want %q", got, want)
+		}
+		if got, want := last.GetPkgset(), "extrabase"; got != want {
+			t.Errorf("last generation: unexpected pkgset: got %q, want %q", got, want)
+		}
+		var strace bool
+		for _, pkg := range last.GetPackage() {
+			if strings.HasPrefix(pkg, "strace-amd64-") {
+				strace = true
+			}
 		}
-		got = string(b)
-		if diff := cmp.Diff("", got); diff == "" {
-			t.Errorf("files.after.txt: unexpectedly empty")
+		if !strace {
+			t.Errorf("last generation does not contain strace (via base-full)")
 		}
 	})
 }
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -43,6 +44,43 @@ type Ctx struct {
 	DistriRoot      env.DistriRootDir
 	DefaultBuildCtx *build.Ctx
 	Arch            string
+	// BuildCache is passed to distri build, see its -build_cache flag.
+	BuildCache string
+	// Builders are remote build servers (see distri builder) to which builds
+	// are dispatched in addition to local build jobs.
+	Builders []Builder
+}
+
+// Builder is a remote build server.
+type Builder struct {
+	Addr  string // host:port, see distri build -remote
+	Slots int    // number of concurrent builds
+}
+
+// ParseBuilders parses a comma-separated list of builders, each of which is a
+// host:port address, optionally followed by =<slots> (default 1), e.g.
+// ws:2019=16,laptop:2019=4.
+func ParseBuilders(spec string) ([]Builder, error) {
+	var builders []Builder
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		b := Builder{Addr: field, Slots: 1}
+		if idx := strings.LastIndexByte(field, '='); idx > -1 {
+			slots, err := strconv.Atoi(field[idx+1:])
+			if err != nil || slots < 1 {
+				return nil, xerrors.Errorf("builder %q: invalid number of slots %q", field, field[idx+1:])
+			}
+			b.Addr, b.Slots = field[:idx], slots
+		}
+		if b.Addr == "" {
+			return nil, xerrors.Errorf("builder %q: empty address", field)
+		}
+		builders = append(builders, b)
+	}
+	return builders, nil
 }
 
 func (c *Ctx) Build(ctx context.Context, dryRun, simulate, rebuild bool, jobs int) error {
@@ -237,6 +275,18 @@ func (c *Ctx) Build(ctx context.Context, dryRun, simulate, rebuild bool, jobs in
 		return nil
 	}
 
+	// Every worker builds on the builder in its slot, with "" meaning a local
+	// build:
+	slots := make([]string, jobs)
+	for _, b := range c.Builders {
+		for i := 0; i < b.Slots; i++ {
+			slots = append(slots, b.Addr)
+		}
+	}
+	if len(slots) == 0 {
+		return xerrors.Errorf("no build slots: specify at least one local job or builder")
+	}
+
 	logDir, err := ioutil.TempDir("", "distri-batch")
 	if err != nil {
 		return err
@@ -246,12 +296,15 @@ func (c *Ctx) Build(ctx context.Context, dryRun, simulate, rebuild bool, jobs in
 		log:        c.Log,
 		logDir:     logDir,
 		simulate:   simulate,
-		workers:    jobs,
+		workers:    len(slots),
+		slots:      slots,
 		g:          g,
 		byFullname: byFullname,
 		built:      make(map[string]error),
-		status:     make([]string, jobs+1),
+		tried:      make(map[string]map[string]bool),
+		status:     make([]string, len(slots)+1),
 		arch:       arch,
+		buildCache: c.BuildCache,
 	}
 	if err := s.run(ctx); err != nil {
 		return err
@@ -261,20 +314,28 @@ func (c *Ctx) Build(ctx context.Context, dryRun, simulate, rebuild bool, jobs in
 }
 
 type buildResult struct {
-	node *node
-	err  error
+	node    *node
+	builder string // see scheduler.slots
+	err     error
 }
 
+// maxAttempts is the number of builders on which a package is built before
+// its build is considered failed.
+const maxAttempts = 2
+
 type scheduler struct {
 	distriRoot env.DistriRootDir
 	log        *log.Logger
 	logDir     string
 	simulate   bool
 	workers    int
+	slots      []string // builder address per worker, "" for local builds
 	g          graph.Directed
 	byFullname map[string]*node
 	built      map[string]error
+	tried      map[string]map[string]bool // builders which failed to build a package
 	arch       string
+	buildCache string
 
 	statusMu   sync.Mutex
 	status     []string
@@ -342,16 +403,33 @@ func (s *scheduler) buildDry(ctx context.Context, pkg string) bool {
 	return pkg != "libx11"
 }
 
-func (s *scheduler) build(ctx context.Context, pkg string) error {
-	logFile, err := os.Create(filepath.Join(s.logDir, pkg+".log"))
+func builderName(builder string) string {
+	if builder == "" {
+		return "local"
+	}
+	return builder
+}
+
+func (s *scheduler) build(ctx context.Context, pkg, builder string) error {
+	// Append to the log file so that it covers all attempts to build pkg:
+	logFile, err := os.OpenFile(filepath.Join(s.logDir, pkg+".log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		return err
 	}
 	defer logFile.Close()
+	fmt.Fprintf(logFile, "building %s on %s\n", pkg, builderName(builder))
 	build := exec.CommandContext(ctx, "distri", "build")
+	if builder != "" {
+		// distri build stores the inputs on the builder and retrieves the
+		// artifacts into the local repository.
+		build.Args = append(build.Args, "-remote="+builder)
+	}
 	if s.arch != "" {
 		build.Args = append(build.Args, "-cross="+s.arch)
 	}
+	if s.buildCache != "" {
+		build.Args = append(build.Args, "-build_cache="+s.buildCache)
+	}
 	build.Dir = s.distriRoot.PkgDir(pkg)
 	build.Stdout = logFile
 	build.Stderr = logFile
@@ -364,6 +442,13 @@ func (s *scheduler) build(ctx context.Context, pkg string) error {
 func (s *scheduler) run(ctx context.Context) error {
 	numNodes := s.g.Nodes().Len()
 	work := make(chan *node, numNodes)
+	// retry contains packages to build on a specific builder:
+	retry := make(map[string]chan *node)
+	for _, builder := range s.slots {
+		if _, ok := retry[builder]; !ok {
+			retry[builder] = make(chan *node, numNodes)
+		}
+	}
 	done := make(chan buildResult)
 	eg, ctx := errgroup.WithContext(ctx)
 	const freq = 1 * time.Second
@@ -382,10 +467,20 @@ func (s *scheduler) run(ctx context.Context) error {
 
 	for i := 0; i < s.workers; i++ {
 		i := i // copy
+		builder := s.slots[i]
 		eg.Go(func() error {
 			ticker := time.NewTicker(100 * time.Millisecond) // TODO: 1*time.Second
 			defer ticker.Stop()
-			for n := range work {
+			for {
+				var n *node
+				select {
+				case n = <-retry[builder]:
+				case next, ok := <-work:
+					if !ok {
+						return nil
+					}
+					n = next
+				}
 				if err := ctx.Err(); err != nil {
 					return err
 				}
@@ -395,7 +490,7 @@ func (s *scheduler) run(ctx context.Context) error {
 					ev.Type = "B" // begin
 					ev.Done()
 				}
-				s.updateStatus(i+1, "building "+n.pkg)
+				s.updateStatus(i+1, "building "+n.pkg+" on "+builderName(builder))
 				start := time.Now()
 				result := make(chan error)
 				if s.simulate {
@@ -408,7 +503,7 @@ func (s *scheduler) run(ctx context.Context) error {
 					}()
 				} else {
 					go func() {
-						err := s.build(ctx, n.pkg)
+						err := s.build(ctx, n.pkg, builder)
 						result <- err
 					}()
 				}
@@ -421,12 +516,12 @@ func (s *scheduler) run(ctx context.Context) error {
 					case err = <-result:
 						break Build
 					case <-ticker.C:
-						s.updateStatus(i+1, fmt.Sprintf("building %s since %v", n.pkg, time.Since(start)))
+						s.updateStatus(i+1, fmt.Sprintf("building %s on %s since %v", n.pkg, builderName(builder), time.Since(start)))
 					}
 				}
 
 				select {
-				case done <- buildResult{node: n, err: err}:
+				case done <- buildResult{node: n, builder: builder, err: err}:
 				case <-ctx.Done():
 					return ctx.Err()
 				}
@@ -437,7 +532,6 @@ func (s *scheduler) run(ctx context.Context) error {
 				}
 				s.updateStatus(i+1, "idle")
 			}
-			return nil
 		})
 	}
 
@@ -461,6 +555,14 @@ func (s *scheduler) run(ctx context.Context) error {
 			case result := <-done:
 				//s.log.Printf("build %s completed", result.name)
 				n := s.byFullname[result.node.fullname]
+				if result.err != nil {
+					if builder, ok := s.retryBuilder(result.node, result.builder); ok {
+						s.log.Printf("build of %s failed on %s (%v), retrying on %s", result.node.pkg, builderName(result.builder), result.err, builderName(builder))
+						s.refreshStatus()
+						retry[builder] <- result.node
+						continue
+					}
+				}
 				s.built[result.node.fullname] = result.err
 				s.updateStatus(0, fmt.Sprintf("%d of %d packages: %d built, %d failed", len(s.built), numNodes, succeeded, failed))
 
@@ -498,6 +600,26 @@ func (s *scheduler) run(ctx context.Context) error {
 	return nil
 }
 
+// retryBuilder records that building n failed on builder failedOn and returns
+// the builder on which to retry the build, if any.
+func (s *scheduler) retryBuilder(n *node, failedOn string) (string, bool) {
+	tried, ok := s.tried[n.fullname]
+	if !ok {
+		tried = make(map[string]bool)
+		s.tried[n.fullname] = tried
+	}
+	tried[failedOn] = true
+	if len(tried) >= maxAttempts {
+		return "", false
+	}
+	for _, builder := range s.slots {
+		if !tried[builder] {
+			return builder, true
+		}
+	}
+	return "", false
+}
+
 func (s *scheduler) markFailed(n graph.Node) int {
 	failed := 0
 	//s.log.Printf("marking deps of %s as failed", n.(*node).name)
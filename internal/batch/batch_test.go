@@ -0,0 +1,53 @@
+package batch
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseBuilders(t *testing.T) {
+	got, err := ParseBuilders("ws:2019=16, laptop:2019,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Builder{
+		{Addr: "ws:2019", Slots: 16},
+		{Addr: "laptop:2019", Slots: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("ParseBuilders: diff (-want +got):\n%s", diff)
+	}
+
+	for _, spec := range []string{"ws:2019=0", "ws:2019=many", "=4"} {
+		if _, err := ParseBuilders(spec); err == nil {
+			t.Errorf("ParseBuilders(%q) unexpectedly succeeded", spec)
+		}
+	}
+}
+
+func TestRetryBuilder(t *testing.T) {
+	s := &scheduler{
+		slots: []string{"", "", "ws:2019", "laptop:2019"},
+		tried: make(map[string]map[string]bool),
+	}
+	n := &node{pkg: "hello", fullname: "hello-amd64-1"}
+	builder, ok := s.retryBuilder(n, "")
+	if !ok {
+		t.Fatalf("build not retried after local failure")
+	}
+	if got, want := builder, "ws:2019"; got != want {
+		t.Errorf("unexpected retry builder: got %q, want %q", got, want)
+	}
+	if _, ok := s.retryBuilder(n, builder); ok {
+		t.Errorf("build unexpectedly retried after %d attempts", maxAttempts)
+	}
+
+	s = &scheduler{
+		slots: []string{""},
+		tried: make(map[string]map[string]bool),
+	}
+	if _, ok := s.retryBuilder(n, ""); ok {
+		t.Errorf("build unexpectedly retried without other builders")
+	}
+}
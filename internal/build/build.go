@@ -30,6 +30,7 @@ import (
 
 	"github.com/distr1/distri"
 	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/internal/extract"
 	cmdfuse "github.com/distr1/distri/internal/fuse"
 	"github.com/distr1/distri/internal/squashfs"
 	"github.com/distr1/distri/internal/trace"
@@ -113,6 +114,10 @@ func readXattrs(fd int) ([]squashfs.Xattr, error) {
 		}
 		attrs = append(attrs, squashfs.XattrFromAttr(attr, buf))
 	}
+	// The order of flistxattr(2) depends on the file system.
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].FullName < attrs[j].FullName
+	})
 	return attrs, nil
 }
 
@@ -226,6 +231,14 @@ func (cpFi *cpFileInfo) addChild(child *cpFileInfo) {
 	cpFi.byName[child.fi.Name()] = child
 }
 
+// sortChildren sorts the children of cpFi by name, as SquashFS requires (see
+// squashfs.Writer) and addChild does not preserve.
+func (cpFi *cpFileInfo) sortChildren() {
+	sort.Slice(cpFi.children, func(i, j int) bool {
+		return cpFi.children[i].fi.Name() < cpFi.children[j].fi.Name()
+	})
+}
+
 func (cpFi *cpFileInfo) copyTo(w *squashfs.Directory) error {
 	// for convenience:
 	fi := cpFi.fi
@@ -234,7 +247,8 @@ func (cpFi *cpFileInfo) copyTo(w *squashfs.Directory) error {
 	// log.Printf("(%s/%s).copyTo(dir=%s)", cpFi.dir, cpFi.fi.Name(), dir)
 
 	if fi.IsDir() {
-		subdir := w.Directory(fi.Name(), fi.ModTime())
+		subdir := w.Directory(fi.Name(), SourceDateEpoch)
+		cpFi.sortChildren()
 		for _, child := range cpFi.children {
 			if err := child.copyTo(subdir); err != nil {
 				return err
@@ -251,7 +265,7 @@ func (cpFi *cpFileInfo) copyTo(w *squashfs.Directory) error {
 		if err != nil {
 			return err
 		}
-		f, err := w.File(fi.Name(), fi.ModTime(), uint16(fi.Sys().(*syscall.Stat_t).Mode), attrs)
+		f, err := w.File(fi.Name(), SourceDateEpoch, uint16(fi.Sys().(*syscall.Stat_t).Mode), attrs)
 		if err != nil {
 			return err
 		}
@@ -268,14 +282,28 @@ func (cpFi *cpFileInfo) copyTo(w *squashfs.Directory) error {
 		if err != nil {
 			return err
 		}
-		if err := w.Symlink(dest, fi.Name(), fi.ModTime(), fi.Mode().Perm()); err != nil {
+		if err := w.Symlink(dest, fi.Name(), SourceDateEpoch, fi.Mode().Perm()); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// devIno uniquely identifies a file on the local system.
+type devIno struct {
+	dev uint64
+	ino uint64
+}
+
+// cp copies the contents of dir into w, preserving hard links.
 func cp(w *squashfs.Directory, dir string) error {
+	return cp1(w, dir, "", make(map[devIno]string))
+}
+
+// cp1 copies the contents of dir into w, which is located at rel within the
+// image. links maps files with more than one link to the path within the image
+// at which they were first written.
+func cp1(w *squashfs.Directory, dir, rel string, links map[devIno]string) error {
 	//log.Printf("cp(%s)", dir)
 	fis, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -284,11 +312,22 @@ func cp(w *squashfs.Directory, dir string) error {
 	for _, fi := range fis {
 		//log.Printf("file %s, mode %#o (raw %#o)", fi.Name(), fi.Mode(), fi.Sys().(*syscall.Stat_t).Mode)
 		if fi.IsDir() {
-			subdir := w.Directory(fi.Name(), fi.ModTime())
-			if err := cp(subdir, filepath.Join(dir, fi.Name())); err != nil {
+			subdir := w.Directory(fi.Name(), SourceDateEpoch)
+			if err := cp1(subdir, filepath.Join(dir, fi.Name()), filepath.Join(rel, fi.Name()), links); err != nil {
 				return err
 			}
 		} else if fi.Mode().IsRegular() {
+			st := fi.Sys().(*syscall.Stat_t)
+			if st.Nlink > 1 {
+				key := devIno{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+				if oldpath, ok := links[key]; ok {
+					if err := w.Hardlink(oldpath, fi.Name()); err != nil {
+						return err
+					}
+					continue
+				}
+				links[key] = filepath.Join(rel, fi.Name())
+			}
 			in, err := os.Open(filepath.Join(dir, fi.Name()))
 			if err != nil {
 				return err
@@ -298,7 +337,7 @@ func cp(w *squashfs.Directory, dir string) error {
 			if err != nil {
 				return err
 			}
-			f, err := w.File(fi.Name(), fi.ModTime(), uint16(fi.Sys().(*syscall.Stat_t).Mode), attrs)
+			f, err := w.File(fi.Name(), SourceDateEpoch, uint16(st.Mode), attrs)
 			if err != nil {
 				return err
 			}
@@ -314,7 +353,20 @@ func cp(w *squashfs.Directory, dir string) error {
 			if err != nil {
 				return err
 			}
-			if err := w.Symlink(dest, fi.Name(), fi.ModTime(), fi.Mode().Perm()); err != nil {
+			if err := w.Symlink(dest, fi.Name(), SourceDateEpoch, fi.Mode().Perm()); err != nil {
+				return err
+			}
+		} else if fi.Mode()&os.ModeDevice != 0 {
+			rdev := uint64(fi.Sys().(*syscall.Stat_t).Rdev)
+			if err := w.Device(fi.Name(), SourceDateEpoch, fi.Mode(), unix.Major(rdev), unix.Minor(rdev)); err != nil {
+				return err
+			}
+		} else if fi.Mode()&os.ModeNamedPipe != 0 {
+			if err := w.Fifo(fi.Name(), SourceDateEpoch, fi.Mode()); err != nil {
+				return err
+			}
+		} else if fi.Mode()&os.ModeSocket != 0 {
+			if err := w.Socket(fi.Name(), SourceDateEpoch, fi.Mode()); err != nil {
 				return err
 			}
 		} else {
@@ -576,7 +628,7 @@ func (b *Ctx) PkgSource() error {
 		return err
 	}
 	defer f.Cleanup()
-	w, err := squashfs.NewWriter(f, time.Now())
+	w, err := squashfs.NewWriter(f, SourceDateEpoch)
 	if err != nil {
 		return err
 	}
@@ -635,6 +687,7 @@ func (b *Ctx) PkgSource() error {
 		return err
 	}
 
+	wrapped.sortChildren()
 	for _, child := range wrapped.children {
 		if err := child.copyTo(w.Root); err != nil {
 			return err
@@ -700,7 +753,7 @@ func (b *Ctx) Package() error {
 			return err
 		}
 		defer f.Cleanup()
-		w, err := squashfs.NewWriter(f, time.Now())
+		w, err := squashfs.NewWriter(f, SourceDateEpoch)
 		if err != nil {
 			return err
 		}
@@ -822,8 +875,7 @@ func newerRevisionGoesFirst(deps []string) []string {
 		sort.Slice(versions, func(i, j int) bool {
 			vi := distri.ParseVersion(versions[i])
 			vj := distri.ParseVersion(versions[j])
-			less := vi.DistriRevision < vj.DistriRevision
-			return !less // reverse
+			return vi.Compare(vj) > 0 // reverse
 		})
 	}
 	result := make([]string, 0, len(deps))
@@ -904,6 +956,7 @@ func (b *Ctx) env(deps []string, hermetic bool) []string {
 		"PKG_CONFIG_PATH=" + strings.Join(pkgconfigDirs, ":") + ifNotHermetic(":$PKG_CONFIG_PATH"), // for pkg-config
 		"PERL5LIB=" + strings.Join(perl5Dirs, ":") + ifNotHermetic(":$PERL5LIB"),                   // for perl
 		"PYTHONPATH=" + strings.Join(pythonDirs, ":") + ifNotHermetic(":$PYTHONPATH"),
+		sourceDateEpochEnv(), // for reproducible builds
 	}
 	// Exclude LDFLAGS for glibc as per
 	// https://github.com/Linuxbrew/legacy-linuxbrew/issues/126
@@ -2143,7 +2196,7 @@ func (b *Ctx) cherryPick(src, tmp string) error {
 
 // TrimArchiveSuffix removes file extensions such as .tar, .gz, etc.
 func TrimArchiveSuffix(fn string) string {
-	for _, suffix := range []string{"gz", "lz", "xz", "bz2", "tar", "tgz", "deb"} {
+	for _, suffix := range []string{"zst", "gz", "lz", "xz", "bz2", "tar", "tgz", "deb", "zip"} {
 		fn = strings.TrimSuffix(fn, "."+suffix)
 	}
 	return fn
@@ -2183,24 +2236,11 @@ func (b *Ctx) Extract() error {
 		return err
 	}
 	defer os.RemoveAll(tmp)
-	if strings.HasSuffix(fn, ".deb") {
-		abs, err := filepath.Abs(fn)
-		if err != nil {
-			return err
-		}
-		cmd := exec.Command("ar", "x", abs)
-		cmd.Dir = tmp
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return xerrors.Errorf("%v: %v", cmd.Args, err)
-		}
-	} else {
-		// TODO(later): extract in pure Go to avoid tar dependency
-		cmd := exec.Command("tar", "xf", fn, "--strip-components=1", "--no-same-owner", "-C", tmp)
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return xerrors.Errorf("%v: %v", cmd.Args, err)
-		}
+	// Source archives contain a top-level directory (e.g. hello-2.10/),
+	// .deb files contain the members (e.g. data.tar.xz) which build steps
+	// unpack.
+	if err := extract.Archive(fn, tmp, 1); err != nil {
+		return xerrors.Errorf("extract: %v", err)
 	}
 
 	if err := b.applyPatches(tmp); err != nil {
@@ -0,0 +1,172 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distr1/distri/internal/squashfs"
+)
+
+// SourceDateEpoch is the modification time of all files in package images and
+// the creation time of the images. Build steps receive it as SOURCE_DATE_EPOCH
+// (see https://reproducible-builds.org/specs/source-date-epoch/), so that tools
+// embed it instead of the current time. Together with sorted directory entries
+// and extended attributes, and files owned by root, this makes builds of the
+// same inputs produce byte-identical images.
+var SourceDateEpoch = time.Unix(315532800, 0) // 1980-01-01, the earliest time zip files can represent
+
+func sourceDateEpochEnv() string {
+	return "SOURCE_DATE_EPOCH=" + strconv.FormatInt(SourceDateEpoch.Unix(), 10)
+}
+
+// DiffArtifacts compares the build artifacts a and b (e.g. two builds of
+// pkg/hello-amd64-2.10-3.squashfs) and describes their first difference, or
+// returns the empty string if they are identical.
+func DiffArtifacts(a, b string) (string, error) {
+	ba, err := ioutil.ReadFile(a)
+	if err != nil {
+		return "", err
+	}
+	bb, err := ioutil.ReadFile(b)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Equal(ba, bb) {
+		return "", nil
+	}
+	if !strings.HasSuffix(a, ".squashfs") {
+		return "contents differ", nil
+	}
+	ra, err := squashfs.NewReader(bytes.NewReader(ba))
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", a, err)
+	}
+	rb, err := squashfs.NewReader(bytes.NewReader(bb))
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", b, err)
+	}
+	diff, err := diffImages(ra, rb, "/", ra.RootInode(), rb.RootInode())
+	if err != nil {
+		return "", err
+	}
+	if diff == "" {
+		// All files are identical, so the image layout must differ.
+		return "image metadata differs", nil
+	}
+	return diff, nil
+}
+
+// diffImages compares the directory dir, which is inode ia in image a and
+// inode ib in image b, recursively in directory entry order.
+func diffImages(a, b *squashfs.Reader, dir string, ia, ib squashfs.Inode) (string, error) {
+	fisA, err := a.Readdir(ia)
+	if err != nil {
+		return "", err
+	}
+	fisB, err := b.Readdir(ib)
+	if err != nil {
+		return "", err
+	}
+	inA := make(map[string]os.FileInfo, len(fisA))
+	for _, fi := range fisA {
+		inA[fi.Name()] = fi
+	}
+	inB := make(map[string]os.FileInfo, len(fisB))
+	names := make([]string, 0, len(fisA)+len(fisB))
+	for _, fi := range fisB {
+		inB[fi.Name()] = fi
+		if _, ok := inA[fi.Name()]; !ok {
+			names = append(names, fi.Name())
+		}
+	}
+	for name := range inA {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := path.Join(dir, name)
+		fa, okA := inA[name]
+		fb, okB := inB[name]
+		if !okB {
+			return p + ": only in first build", nil
+		}
+		if !okA {
+			return p + ": only in second build", nil
+		}
+		if diff, err := diffFile(a, b, p, fa, fb); diff != "" || err != nil {
+			return diff, err
+		}
+	}
+	return "", nil
+}
+
+func diffFile(a, b *squashfs.Reader, p string, fa, fb os.FileInfo) (string, error) {
+	if fa.Mode() != fb.Mode() {
+		return fmt.Sprintf("%s: mode differs: %v vs. %v", p, fa.Mode(), fb.Mode()), nil
+	}
+	if !fa.ModTime().Equal(fb.ModTime()) {
+		return fmt.Sprintf("%s: modification time differs: %v vs. %v", p, fa.ModTime(), fb.ModTime()), nil
+	}
+	ia, ib := fa.Sys().(*squashfs.FileInfo).Inode, fb.Sys().(*squashfs.FileInfo).Inode
+	switch {
+	case fa.IsDir():
+		return diffImages(a, b, p, ia, ib)
+
+	case fa.Mode()&os.ModeSymlink != 0:
+		ta, err := a.ReadLink(ia)
+		if err != nil {
+			return "", err
+		}
+		tb, err := b.ReadLink(ib)
+		if err != nil {
+			return "", err
+		}
+		if ta != tb {
+			return fmt.Sprintf("%s: symlink target differs: %q vs. %q", p, ta, tb), nil
+		}
+
+	case fa.Mode().IsRegular():
+		ca, err := readImageFile(a, ia)
+		if err != nil {
+			return "", err
+		}
+		cb, err := readImageFile(b, ib)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(ca, cb) {
+			off := 0
+			for off < len(ca) && off < len(cb) && ca[off] == cb[off] {
+				off++
+			}
+			return fmt.Sprintf("%s: contents differ at offset %d", p, off), nil
+		}
+		xa, err := a.ReadXattrs(ia)
+		if err != nil {
+			return "", err
+		}
+		xb, err := b.ReadXattrs(ib)
+		if err != nil {
+			return "", err
+		}
+		if fmt.Sprint(xa) != fmt.Sprint(xb) {
+			return p + ": extended attributes differ", nil
+		}
+	}
+	return "", nil
+}
+
+func readImageFile(rd *squashfs.Reader, inode squashfs.Inode) ([]byte, error) {
+	f, err := rd.FileReader(inode)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(f)
+}
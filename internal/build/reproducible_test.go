@@ -0,0 +1,129 @@
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/internal/squashfs"
+)
+
+// writeImage packages the contents of dir into the SquashFS image fn, like
+// Ctx.Package does.
+func writeImage(t *testing.T, fn, dir string) {
+	t.Helper()
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := squashfs.NewWriter(f, SourceDateEpoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp(w.Root, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "distri-reproducible")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dest := filepath.Join(tmp, "dest")
+	for fn, contents := range map[string]string{
+		"out/bin/hello":         "#!/bin/sh\necho hello\n",
+		"out/share/doc/README":  "hello world\n",
+		"out/share/doc/NEWS":    "2.10: first release\n",
+		"out/lib/libhello.so.1": "\x7fELF",
+	} {
+		fn = filepath.Join(dest, fn)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("libhello.so.1", filepath.Join(dest, "out/lib/libhello.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	first := filepath.Join(tmp, "first.squashfs")
+	writeImage(t, first, dest)
+
+	// A later build results in later modification times:
+	later := time.Now().Add(1 * time.Hour)
+	if err := filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chtimes(path, later, later)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(tmp, "second.squashfs")
+	writeImage(t, second, dest)
+
+	diff, err := DiffArtifacts(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Fatalf("DiffArtifacts(first, second) = %q, want no difference", diff)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dest, "out/share/doc/NEWS"), []byte("2.10: first release (built "+later.String()+")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dest, "out/share/doc/THANKS"), []byte("everyone\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	third := filepath.Join(tmp, "third.squashfs")
+	writeImage(t, third, dest)
+
+	diff, err = DiffArtifacts(first, third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/out/share/doc/NEWS: contents differ at offset 19"; diff != want {
+		t.Fatalf("DiffArtifacts(first, third) = %q, want %q", diff, want)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dest, "out/share/doc/NEWS"), []byte("2.10: first release\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fourth := filepath.Join(tmp, "fourth.squashfs")
+	writeImage(t, fourth, dest)
+	diff, err = DiffArtifacts(first, fourth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/out/share/doc/THANKS: only in second build"; diff != want {
+		t.Fatalf("DiffArtifacts(first, fourth) = %q, want %q", diff, want)
+	}
+
+	meta := filepath.Join(tmp, "hello.meta.textproto")
+	if err := ioutil.WriteFile(meta, []byte("runtime_dep: \"glibc-amd64-2.31-4\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = DiffArtifacts(meta, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "differ") {
+		t.Fatalf("DiffArtifacts(meta, first) = %q, want a difference", diff)
+	}
+}
@@ -0,0 +1,337 @@
+// Package buildcache implements a content-addressed cache of build artifacts,
+// keyed by the input digest of a build (see build.Ctx.Digest).
+//
+// The artifacts of a build are stored underneath a directory named after the
+// input digest, next to a manifest which lists their SHA-256 digests:
+//
+//	<input digest>/MANIFEST
+//	<input digest>/pkg/hello-amd64-2.8-3.squashfs
+//	<input digest>/pkg/hello-amd64-2.8-3.meta.textproto
+//	<input digest>/debug/hello-amd64-2.8-3.squashfs
+//	<input digest>/src/hello-amd64-2.8-3.squashfs
+//
+// The manifest is written last, so that partially stored builds are not used.
+package buildcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/renameio"
+	"golang.org/x/xerrors"
+)
+
+// ManifestFile is the file name of the manifest within a build’s directory.
+// Its format matches the output of sha256sum(1), i.e. one “<hex digest>  <file
+// name>” line per artifact.
+const ManifestFile = "MANIFEST"
+
+// ErrNotFound is returned by Cache.Get if the cache does not contain the
+// artifacts of a build.
+var ErrNotFound = errors.New("not found in build cache")
+
+type backend interface {
+	// read returns the contents of the cache file name, or ErrNotFound.
+	read(ctx context.Context, name string) (io.ReadCloser, error)
+	// write atomically replaces the cache file name with the contents of r.
+	write(ctx context.Context, name string, r io.Reader) error
+}
+
+// Cache is a build cache, stored in a local directory or on an HTTP server
+// (see Handler).
+type Cache struct {
+	location string
+	backend  backend
+}
+
+// Open returns the build cache at location, which is either a directory or an
+// HTTP(S) URL. If non-empty, authToken is sent as bearer token when storing
+// artifacts on an HTTP server (see Handler).
+func Open(location, authToken string) *Cache {
+	var b backend
+	if strings.HasPrefix(location, "http://") ||
+		strings.HasPrefix(location, "https://") {
+		b = &httpBackend{
+			base:      strings.TrimSuffix(location, "/"),
+			authToken: authToken,
+		}
+	} else {
+		b = &dirBackend{dir: location}
+	}
+	return &Cache{location: location, backend: b}
+}
+
+func (c *Cache) String() string { return c.location }
+
+func validDigest(digest string) error {
+	if _, err := hex.DecodeString(digest); err != nil || digest == "" {
+		return xerrors.Errorf("invalid input digest %q", digest)
+	}
+	return nil
+}
+
+// validPath returns an error unless p is a clean, relative path which does not
+// refer to a parent directory.
+func validPath(p string) error {
+	if p == "" ||
+		path.Clean(p) != p ||
+		path.IsAbs(p) ||
+		p == ".." ||
+		strings.HasPrefix(p, "../") {
+		return xerrors.Errorf("invalid artifact path %q", p)
+	}
+	return nil
+}
+
+type manifestEntry struct {
+	digest string // hex-encoded SHA-256
+	path   string // e.g. pkg/hello-amd64-2.8-3.squashfs
+}
+
+func parseManifest(b []byte) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			return nil, xerrors.Errorf("malformed manifest line %q", line)
+		}
+		if b, err := hex.DecodeString(parts[0]); err != nil || len(b) != sha256.Size {
+			return nil, xerrors.Errorf("malformed digest in manifest line %q", line)
+		}
+		if err := validPath(parts[1]); err != nil {
+			return nil, err
+		}
+		entries = append(entries, manifestEntry{digest: parts[0], path: parts[1]})
+	}
+	return entries, scanner.Err()
+}
+
+// Get retrieves the artifacts of the build with the specified input digest
+// into dir and returns their paths (relative to dir). If the cache does not
+// contain the build, Get returns ErrNotFound.
+func (c *Cache) Get(ctx context.Context, digest, dir string) ([]string, error) {
+	if err := validDigest(digest); err != nil {
+		return nil, err
+	}
+	rd, err := c.backend.read(ctx, digest+"/"+ManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	b, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseManifest(b)
+	if err != nil {
+		return nil, xerrors.Errorf("%s/%s: %v", digest, ManifestFile, err)
+	}
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if err := c.get(ctx, digest, dir, e); err != nil {
+			return nil, err
+		}
+		paths = append(paths, e.path)
+	}
+	return paths, nil
+}
+
+func (c *Cache) get(ctx context.Context, digest, dir string, e manifestEntry) error {
+	rd, err := c.backend.read(ctx, digest+"/"+e.path)
+	if err != nil {
+		if err == ErrNotFound {
+			return xerrors.Errorf("%s: listed in %s, but %w", e.path, ManifestFile, err)
+		}
+		return err
+	}
+	defer rd.Close()
+	dest := filepath.Join(dir, filepath.FromSlash(e.path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := renameio.TempFile("", dest)
+	if err != nil {
+		return err
+	}
+	defer f.Cleanup()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), rd); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != e.digest {
+		return xerrors.Errorf("%s: SHA-256 digest mismatch: got %s, want %s", e.path, got, e.digest)
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	return f.CloseAtomicallyReplace()
+}
+
+// Put stores the artifacts at paths (relative to dir) as the build with the
+// specified input digest.
+func (c *Cache) Put(ctx context.Context, digest, dir string, paths []string) error {
+	if err := validDigest(digest); err != nil {
+		return err
+	}
+	var manifest bytes.Buffer
+	for _, p := range paths {
+		if err := validPath(p); err != nil {
+			return err
+		}
+		sum, err := c.put(ctx, digest, dir, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&manifest, "%x  %s\n", sum, p)
+	}
+	return c.backend.write(ctx, digest+"/"+ManifestFile, &manifest)
+}
+
+func (c *Cache) put(ctx context.Context, digest, dir, p string) ([]byte, error) {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(p)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if err := c.backend.write(ctx, digest+"/"+p, io.TeeReader(f, h)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+type dirBackend struct {
+	dir string
+}
+
+func (d *dirBackend) read(ctx context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(d.dir, filepath.FromSlash(name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func (d *dirBackend) write(ctx context.Context, name string, r io.Reader) error {
+	dest := filepath.Join(d.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := renameio.TempFile("", dest)
+	if err != nil {
+		return err
+	}
+	defer f.Cleanup()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	return f.CloseAtomicallyReplace()
+}
+
+var httpClient = &http.Client{Transport: &http.Transport{
+	MaxIdleConnsPerHost: 10,
+	DisableCompression:  true,
+}}
+
+type httpBackend struct {
+	base      string // e.g. http://cache:7081
+	authToken string // sent with PUT requests, if non-empty
+}
+
+func (h *httpBackend) read(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.base+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, xerrors.Errorf("%s: HTTP status %v", req.URL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (h *httpBackend) write(ctx context.Context, name string, r io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", h.base+"/"+name, r)
+	if err != nil {
+		return err
+	}
+	if h.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.authToken)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("%s: HTTP status %v", req.URL, resp.Status)
+	}
+	return nil
+}
+
+// Handler serves the build cache stored in dir via HTTP: GET requests retrieve
+// files, PUT requests store files. If authToken is non-empty, PUT requests must
+// carry it as bearer token.
+func Handler(dir, authToken string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	backend := &dirBackend{dir: dir}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET", "HEAD":
+			files.ServeHTTP(w, r)
+		case "PUT":
+			if authToken != "" &&
+				subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+authToken)) != 1 {
+				http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+			name := strings.TrimPrefix(r.URL.Path, "/")
+			if err := validPath(name); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if idx := strings.IndexByte(name, '/'); idx == -1 || validDigest(name[:idx]) != nil {
+				http.Error(w, "path must start with an input digest", http.StatusBadRequest)
+				return
+			}
+			if err := backend.write(r.Context(), name, r.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
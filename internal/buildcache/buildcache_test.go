@@ -0,0 +1,141 @@
+package buildcache_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distr1/distri/internal/buildcache"
+	"github.com/google/go-cmp/cmp"
+)
+
+const digest = "0123456789abcdef0123456789abcdef"
+
+func writeArtifacts(t *testing.T, dir string, files map[string]string) []string {
+	t.Helper()
+	var paths []string
+	for p, contents := range files {
+		fn := filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+func testCache(t *testing.T, cache *buildcache.Cache) {
+	ctx := context.Background()
+	tmp, err := ioutil.TempDir("", "distri-buildcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := cache.Get(ctx, digest, tmp); err != buildcache.ErrNotFound {
+		t.Fatalf("Get(%s) on empty cache: got err %v, want ErrNotFound", digest, err)
+	}
+
+	files := map[string]string{
+		"pkg/hello-amd64-1.squashfs":       "image",
+		"pkg/hello-amd64-1.meta.textproto": `source_pkg: "hello"`,
+		"debug/hello-amd64-1.squashfs":     "debug image",
+	}
+	src := filepath.Join(tmp, "src")
+	paths := writeArtifacts(t, src, files)
+	if err := cache.Put(ctx, digest, src, paths); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(tmp, "dst")
+	got, err := cache.Get(ctx, digest, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(paths, got); diff != "" {
+		t.Fatalf("Get(%s): unexpected paths: diff (-want +got):\n%s", digest, diff)
+	}
+	for p, want := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dst, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(b); got != want {
+			t.Errorf("%s: got %q, want %q", p, got, want)
+		}
+	}
+
+	if err := cache.Put(ctx, digest, src, []string{"../escape"}); err == nil {
+		t.Errorf("Put unexpectedly succeeded with path outside of dir")
+	}
+	if _, err := cache.Get(ctx, "../"+digest, dst); err == nil {
+		t.Errorf("Get unexpectedly succeeded with invalid digest")
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-buildcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testCache(t, buildcache.Open(dir, ""))
+}
+
+func TestHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-buildcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(buildcache.Handler(dir, ""))
+	defer srv.Close()
+	testCache(t, buildcache.Open(srv.URL, ""))
+}
+
+func TestHTTPAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-buildcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(buildcache.Handler(dir, "secret"))
+	defer srv.Close()
+
+	ctx := context.Background()
+	src := filepath.Join(dir, "src")
+	paths := writeArtifacts(t, src, map[string]string{"pkg/hello-amd64-1.squashfs": "image"})
+	for _, token := range []string{"", "wrong"} {
+		if err := buildcache.Open(srv.URL, token).Put(ctx, digest, src, paths); err == nil {
+			t.Errorf("Put with token %q unexpectedly succeeded", token)
+		}
+	}
+	testCache(t, buildcache.Open(srv.URL, "secret"))
+}
+
+func TestCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-buildcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := buildcache.Open(dir, "")
+	ctx := context.Background()
+	src := filepath.Join(dir, "src")
+	paths := writeArtifacts(t, src, map[string]string{"pkg/hello-amd64-1.squashfs": "image"})
+	if err := cache.Put(ctx, digest, src, paths); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, digest, "pkg/hello-amd64-1.squashfs"), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(ctx, digest, filepath.Join(dir, "dst")); err == nil {
+		t.Fatalf("Get unexpectedly succeeded with corrupt artifact")
+	}
+}
@@ -3,10 +3,15 @@
 package env
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/distr1/distri"
@@ -42,40 +47,486 @@ var DistriConfig = func() string {
 	return "/etc/distri" // default
 }()
 
-// Repos returns all configured repositories by consulting DistriConfig. It is a
-// function to avoid I/O for invocations which don’t need to deal with
-// repositories.
+// Repos returns all configured, enabled repositories by consulting
+// DistriConfig, ordered by descending priority. It is a function to avoid I/O
+// for invocations which don’t need to deal with repositories.
+//
+// Each line of a repos.d/*.repo file contains the path or URL of a repository,
+// optionally followed by key=value options:
+//
+//	priority=<n>      prefer packages from repositories with higher priority
+//	                  (default 0)
+//	enabled=<bool>    set to false to ignore the repository
+//	key=<file>        only trust this public key (as written by distri keygen)
+//	                  to sign the repository index; may be repeated
+//	pkg=<path|URL>    location of the pkg section (similarly debug=, src=)
+//	auth=<file>       send the contents of file as HTTP bearer token
+//
+// Relative file names are interpreted relative to DistriConfig.
 func Repos() ([]distri.Repo, error) {
-	dir := filepath.Join(DistriConfig, "repos.d")
-	fis, err := ioutil.ReadDir(dir)
+	var repos []distri.Repo
+	_, err := readConfigDir("repos.d", ".repo", func(_ string, fields []string) error {
+		r, enabled, err := parseRepo(fields)
+		if err != nil {
+			return err
+		}
+		if enabled {
+			repos = append(repos, r)
+		}
+		return nil
+	})
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []distri.Repo{{Path: DefaultRepoRoot, PkgPath: DefaultRepo}}, nil
 		}
 		return nil, err
 	}
-	var repos []distri.Repo
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].Priority > repos[j].Priority
+	})
+	return repos, nil
+}
+
+// readConfigDir calls fn for each line of the files in subdir of DistriConfig
+// whose name ends in suffix (e.g. pins.d/*.pins), with the file name and the
+// line split into fields. Comments (from # to the end of the line) and empty
+// lines are skipped. Errors returned by fn are prefixed with the file name and
+// line number.
+//
+// readConfigDir returns the names of the files it read (e.g. production.pins),
+// or an error satisfying os.IsNotExist if subdir does not exist.
+func readConfigDir(subdir, suffix string, fn func(file string, fields []string) error) ([]string, error) {
+	dir := filepath.Join(DistriConfig, subdir)
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
 	for _, fi := range fis {
-		if !strings.HasSuffix(fi.Name(), ".repo") {
+		if !strings.HasSuffix(fi.Name(), suffix) {
 			continue
 		}
 		b, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
 		if err != nil {
 			return nil, err
 		}
-		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
-		for _, line := range lines {
-			// We might want to append key=value pairs to a repo line later
-			if idx := strings.Index(line, " "); idx > -1 {
-				line = line[:idx]
+		files = append(files, fi.Name())
+		for idx, line := range strings.Split(string(b), "\n") {
+			if i := strings.IndexByte(line, '#'); i > -1 {
+				line = line[:i]
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			if err := fn(fi.Name(), fields); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", filepath.Join(subdir, fi.Name()), idx+1, err)
 			}
-			repos = append(repos, distri.Repo{
-				Path:    line,
-				PkgPath: line + "/pkg",
-			})
 		}
 	}
-	return repos, nil
+	return files, nil
+}
+
+func configFile(fn string) string {
+	if filepath.IsAbs(fn) {
+		return fn
+	}
+	return filepath.Join(DistriConfig, fn)
+}
+
+// parseRepo parses the fields of a repos.d line, see Repos.
+func parseRepo(fields []string) (r distri.Repo, enabled bool, _ error) {
+	r.Path = fields[0]
+	enabled = true
+	for _, opt := range fields[1:] {
+		parts := strings.SplitN(opt, "=", 2)
+		if len(parts) != 2 {
+			return r, false, fmt.Errorf("malformed option %q: want key=value", opt)
+		}
+		key, val := parts[0], parts[1]
+		switch key {
+		case "priority":
+			prio, err := strconv.Atoi(val)
+			if err != nil {
+				return r, false, fmt.Errorf("priority: %v", err)
+			}
+			r.Priority = prio
+
+		case "enabled":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return r, false, fmt.Errorf("enabled: %v", err)
+			}
+			enabled = b
+
+		case "key":
+			key, err := readPublicKey(configFile(val))
+			if err != nil {
+				return r, false, err
+			}
+			r.Keys = append(r.Keys, key)
+
+		case "pkg", "debug", "src":
+			if r.Sections == nil {
+				r.Sections = make(map[string]string)
+			}
+			r.Sections[key] = val
+
+		case "auth":
+			b, err := ioutil.ReadFile(configFile(val))
+			if err != nil {
+				return r, false, err
+			}
+			r.AuthToken = strings.TrimSpace(string(b))
+
+		default:
+			return r, false, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	r.PkgPath = r.Section("pkg")
+	return r, enabled, nil
+}
+
+// TrustedKeys returns the ed25519 public keys which are trusted to sign
+// repository indexes, by consulting DistriConfig. Each keys.d/*.pub file
+// contains one base64-encoded public key (as printed by distri keygen).
+//
+// If no keys are configured, installing packages fails unless verification is
+// explicitly disabled (see install.Ctx.Insecure).
+func TrustedKeys() ([]ed25519.PublicKey, error) {
+	dir := filepath.Join(DistriConfig, "keys.d")
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []ed25519.PublicKey
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), ".pub") {
+			continue
+		}
+		key, err := readPublicKey(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// readPublicKey reads a base64-encoded ed25519 public key from fn.
+func readPublicKey(fn string) (ed25519.PublicKey, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(fn), err)
+	}
+	if got, want := len(key), ed25519.PublicKeySize; got != want {
+		return nil, fmt.Errorf("%s: invalid key size: got %d, want %d", filepath.Base(fn), got, want)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Pin restricts which versions of a package distri install and distri update
+// consider.
+type Pin struct {
+	Pkg string // e.g. glibc
+
+	// Version is either a version constraint (see distri.ParseConstraint,
+	// e.g. >=5.4, <5.6) or a glob pattern (see path.Match) which package
+	// versions (e.g. 2.31-4) must match. Empty if Hold is true.
+	Version string
+
+	// Hold is true if installed versions of Pkg must not be updated at all.
+	Hold bool
+}
+
+// Allows returns whether version (e.g. 2.31-4) may be installed.
+func (p Pin) Allows(version string) bool {
+	if p.Hold {
+		return true // only restricts updates of installed versions
+	}
+	if isConstraint(p.Version) {
+		c, _ := distri.ParseConstraint(p.Version) // Pins validated the constraint
+		return c.Matches(distri.ParseVersion(version))
+	}
+	matched, _ := path.Match(p.Version, version) // Pins validated the pattern
+	return matched
+}
+
+func isConstraint(version string) bool {
+	return strings.IndexAny(version, "<>=~") == 0
+}
+
+func (p Pin) String() string {
+	if p.Hold {
+		return p.Pkg + " hold"
+	}
+	return p.Pkg + " " + p.Version
+}
+
+// Pins returns all configured pins, keyed by package name, by consulting
+// DistriConfig. Each line of a pins.d/*.pins file either pins a package to
+// versions matching a constraint or glob pattern, or holds the package:
+//
+//	linux >=5.4, <5.6
+//	systemd 245-*
+//	glibc hold
+func Pins() (map[string]Pin, error) {
+	pins := make(map[string]Pin)
+	_, err := readConfigDir("pins.d", ".pins", func(_ string, fields []string) error {
+		const syntax = "syntax error: want <package> <version constraint|pattern|hold>"
+		if len(fields) < 2 {
+			return fmt.Errorf(syntax)
+		}
+		pin := Pin{Pkg: fields[0]}
+		version := strings.Join(fields[1:], " ")
+		switch {
+		case version == "hold":
+			pin.Hold = true
+		case isConstraint(version):
+			if _, err := distri.ParseConstraint(version); err != nil {
+				return err
+			}
+			pin.Version = version
+		default:
+			if len(fields) != 2 {
+				return fmt.Errorf(syntax)
+			}
+			if _, err := path.Match(version, ""); err != nil {
+				return fmt.Errorf("invalid version pattern %q: %v", version, err)
+			}
+			pin.Version = version
+		}
+		pins[pin.Pkg] = pin
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return pins, nil
+}
+
+// Alternative prefers a package for exchange directory entries which multiple
+// packages provide.
+type Alternative struct {
+	Pattern string // path.Match pattern of exchange paths, e.g. /bin/python*
+	Pkg     string // e.g. python3
+}
+
+// Alternatives returns all configured alternatives by consulting DistriConfig,
+// in order of precedence. Each line of an alternatives.d/*.alternatives file
+// prefers a package for the matching exchange directory entries:
+//
+//	/bin/vi neovim
+//	/bin/python* python3
+func Alternatives() ([]Alternative, error) {
+	var alternatives []Alternative
+	_, err := readConfigDir("alternatives.d", ".alternatives", func(_ string, fields []string) error {
+		if len(fields) != 2 {
+			return fmt.Errorf("syntax error: want <path pattern> <package>")
+		}
+		if _, err := path.Match(fields[0], ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %v", fields[0], err)
+		}
+		alternatives = append(alternatives, Alternative{
+			Pattern: fields[0],
+			Pkg:     fields[1],
+		})
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return alternatives, nil
+}
+
+// Views returns all configured views of the FUSE file system, keyed by name, by
+// consulting DistriConfig. Each views.d/<name>.view file lists the packages of
+// the view, one per line, either by package name (e.g. less), which includes
+// all versions, or by full package name (e.g. less-amd64-530-3).
+func Views() (map[string][]string, error) {
+	views := make(map[string][]string)
+	files, err := readConfigDir("views.d", ".view", func(file string, fields []string) error {
+		if len(fields) != 1 {
+			return fmt.Errorf("syntax error: want <package>")
+		}
+		name := strings.TrimSuffix(file, ".view")
+		views[name] = append(views[name], fields[0])
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if name := strings.TrimSuffix(file, ".view"); views[name] == nil {
+			views[name] = []string{} // an empty view is still a view
+		}
+	}
+	return views, nil
+}
+
+// Builder configures how to connect to a remote build server (see distri
+// builder).
+type Builder struct {
+	Addr      string // host:port
+	AuthToken string // sent as bearer token, if non-empty
+	// CACert is the file name of the certificate authority which signed the
+	// builder’s TLS certificate. If CACert is empty, the connection is not
+	// encrypted.
+	CACert string
+	// Cert and Key are the file names of the TLS client certificate and its
+	// private key, for builders which require mutual TLS.
+	Cert, Key string
+}
+
+// Builders returns all configured remote build servers, keyed by address, by
+// consulting DistriConfig. Each line of a builders.d/*.builder file contains a
+// host:port address, optionally followed by space-separated options:
+//
+//	auth=<file>       send the contents of file as bearer token
+//	ca=<file>         connect via TLS, verifying the builder’s certificate
+//	                  against the certificate authority in file
+//	cert=<file>       present the TLS client certificate in file (requires key=)
+//	key=<file>        private key of the TLS client certificate
+//
+// Relative file names are interpreted relative to DistriConfig.
+func Builders() (map[string]Builder, error) {
+	builders := make(map[string]Builder)
+	_, err := readConfigDir("builders.d", ".builder", func(_ string, fields []string) error {
+		bld, err := parseBuilder(fields)
+		if err != nil {
+			return err
+		}
+		builders[bld.Addr] = bld
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return builders, nil
+}
+
+// parseBuilder parses the fields of a builders.d line, see Builders.
+func parseBuilder(fields []string) (Builder, error) {
+	b := Builder{Addr: fields[0]}
+	for _, opt := range fields[1:] {
+		parts := strings.SplitN(opt, "=", 2)
+		if len(parts) != 2 {
+			return b, fmt.Errorf("malformed option %q: want key=value", opt)
+		}
+		key, val := parts[0], parts[1]
+		switch key {
+		case "auth":
+			c, err := ioutil.ReadFile(configFile(val))
+			if err != nil {
+				return b, err
+			}
+			b.AuthToken = strings.TrimSpace(string(c))
+
+		case "ca":
+			b.CACert = configFile(val)
+
+		case "cert":
+			b.Cert = configFile(val)
+
+		case "key":
+			b.Key = configFile(val)
+
+		default:
+			return b, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	if (b.Cert == "") != (b.Key == "") {
+		return b, fmt.Errorf("cert= and key= must be specified together")
+	}
+	return b, nil
+}
+
+// DefaultExchangeDirs lists the exchange directories which are provided unless
+// configured otherwise (see ExchangeDirs). E.g., /ro/bin will contain symlinks
+// to all package’s bin directories, or /ro/lib will contain symlinks to all
+// package’s out/lib directories.
+var DefaultExchangeDirs = []string{
+	"/bin",
+	"/out/lib",
+	"/out/lib64",
+	"/out/lib/gio",
+	"/out/lib/girepository-1.0",
+	"/out/include",
+	"/out/share",
+	"/out/share/aclocal",
+	"/out/share/gettext",
+	"/out/share/gir-1.0",
+	"/out/share/glib-2.0/schemas",
+	"/out/share/mime",
+	"/out/gopath",
+	"/debug",
+}
+
+// CleanExchangeDir returns dir (e.g. out/share/mime) as an absolute, clean path
+// within a package image (e.g. /out/share/mime).
+func CleanExchangeDir(dir string) (string, error) {
+	rel := path.Clean(strings.TrimPrefix(dir, "/"))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("invalid exchange directory %q", dir)
+	}
+	return "/" + rel, nil
+}
+
+// ExchangeDirs returns the exchange directories to provide by consulting
+// DistriConfig. Each line of an exchange.d/*.exchange file adds a directory to
+// DefaultExchangeDirs, or removes it if prefixed with an exclamation mark:
+//
+//	/out/share/tcl8.6
+//	!/out/gopath
+//
+// Packages can declare additional exchange directories in their meta
+// (exchange_dir).
+func ExchangeDirs() ([]string, error) {
+	dirs := append([]string(nil), DefaultExchangeDirs...)
+	_, err := readConfigDir("exchange.d", ".exchange", func(_ string, fields []string) error {
+		if len(fields) != 1 {
+			return fmt.Errorf("syntax error: want [!]<directory>")
+		}
+		remove := strings.HasPrefix(fields[0], "!")
+		exchangeDir, err := CleanExchangeDir(strings.TrimPrefix(fields[0], "!"))
+		if err != nil {
+			return err
+		}
+		filtered := dirs[:0]
+		for _, d := range dirs {
+			if d != exchangeDir {
+				filtered = append(filtered, d)
+			}
+		}
+		dirs = filtered
+		if !remove {
+			dirs = append(dirs, exchangeDir)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return dirs, nil
 }
 
 // DefaultRepoRoot is the default repository path or URL.
@@ -94,6 +545,15 @@ var DefaultRepo = func() string {
 	return join(DefaultRepoRoot, "pkg") // default
 }()
 
+// BuildCache is the location (a directory or HTTP URL) of the build cache
+// which distri build consults before building packages and populates after
+// building packages, or empty if no build cache is configured.
+var BuildCache = os.Getenv("DISTRIBUILDCACHE")
+
+// BuildCacheAuth is the path to a file containing the bearer token which distri
+// build sends when storing artifacts in an HTTP(S) BuildCache, or empty.
+var BuildCacheAuth = os.Getenv("DISTRIBUILDCACHEAUTH")
+
 func join(elem ...string) string {
 	if len(elem) == 0 {
 		return ""
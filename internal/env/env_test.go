@@ -0,0 +1,358 @@
+package env_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/env"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRepos(t *testing.T) {
+	cfg, err := ioutil.TempDir("", "distri-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cfg)
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	if err := os.MkdirAll(filepath.Join(cfg, "repos.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fn, contents := range map[string]string{
+		"team.pub":   base64.StdEncoding.EncodeToString(pub),
+		"team.token": "secret\n",
+		"repos.d/upstream.repo": `# the upstream mirror
+https://repo.distr1.org/distri/jackherer
+https://repo.distr1.org/distri/supersilverhaze enabled=false # not yet released
+`,
+		"repos.d/team.repo": `https://distri.example.net priority=10 key=team.pub auth=team.token debug=https://debug.example.net/distri
+`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(cfg, fn), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repos, err := env.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []distri.Repo{
+		{
+			Path:      "https://distri.example.net",
+			PkgPath:   "https://distri.example.net/pkg",
+			Priority:  10,
+			Keys:      []ed25519.PublicKey{pub},
+			Sections:  map[string]string{"debug": "https://debug.example.net/distri"},
+			AuthToken: "secret",
+		},
+		{
+			Path:    "https://repo.distr1.org/distri/jackherer",
+			PkgPath: "https://repo.distr1.org/distri/jackherer/pkg",
+		},
+	}
+	if diff := cmp.Diff(want, repos); diff != "" {
+		t.Fatalf("Repos(): unexpected result: diff (-want +got):\n%s", diff)
+	}
+	if got, want := repos[0].Section("debug"), "https://debug.example.net/distri"; got != want {
+		t.Errorf("Section(debug) = %q, want %q", got, want)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(cfg, "repos.d", "broken.repo"), []byte("/srv/distri prio=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.Repos()
+	if err == nil {
+		t.Fatalf("Repos() unexpectedly succeeded with unknown option")
+	}
+	if want := "repos.d/broken.repo:1: "; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Repos() = %v, want error prefixed with %q", err, want)
+	}
+}
+
+func TestPins(t *testing.T) {
+	cfg, err := ioutil.TempDir("", "distri-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cfg)
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	if err := os.MkdirAll(filepath.Join(cfg, "pins.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const pins = `# production pins
+linux >=5.4, <5.6
+systemd 245-*
+glibc hold
+`
+	if err := ioutil.WriteFile(filepath.Join(cfg, "pins.d", "production.pins"), []byte(pins), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := env.Pins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		pkg     string
+		version string
+		want    bool
+	}{
+		{"linux", "5.5.2-12", true},
+		{"linux", "5.10.1-20", false},
+		{"systemd", "245-3", true},
+		{"systemd", "246-4", false},
+		{"glibc", "2.32-5", true}, // holds only apply to installed packages
+	} {
+		pin, ok := got[tt.pkg]
+		if !ok {
+			t.Fatalf("no pin for %s found", tt.pkg)
+		}
+		if got := pin.Allows(tt.version); got != tt.want {
+			t.Errorf("pin %q: Allows(%s) = %v, want %v", pin, tt.version, got, tt.want)
+		}
+	}
+	if !got["glibc"].Hold {
+		t.Errorf("glibc unexpectedly not held")
+	}
+	// A pin without version must not panic:
+	if (env.Pin{Pkg: "hello"}).Allows("2.10-3") {
+		t.Errorf("empty pin unexpectedly allows hello 2.10-3")
+	}
+}
+
+func TestExchangeDirs(t *testing.T) {
+	cfg, err := ioutil.TempDir("", "distri-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cfg)
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	dirs, err := env.ExchangeDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(env.DefaultExchangeDirs, dirs); diff != "" {
+		t.Fatalf("ExchangeDirs() without exchange.d: diff (-want +got):\n%s", diff)
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg, "exchange.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const tcl = `# tcl only looks in a versioned directory
+out/share/tcl8.6
+!/out/gopath
+`
+	if err := ioutil.WriteFile(filepath.Join(cfg, "exchange.d", "tcl.exchange"), []byte(tcl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dirs, err = env.ExchangeDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, dir := range env.DefaultExchangeDirs {
+		if dir != "/out/gopath" {
+			want = append(want, dir)
+		}
+	}
+	want = append(want, "/out/share/tcl8.6")
+	if diff := cmp.Diff(want, dirs); diff != "" {
+		t.Fatalf("ExchangeDirs(): diff (-want +got):\n%s", diff)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(cfg, "exchange.d", "invalid.exchange"), []byte("../etc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.ExchangeDirs(); err == nil {
+		t.Fatalf("ExchangeDirs() unexpectedly succeeded with invalid exchange directory")
+	}
+}
+
+func TestCleanExchangeDir(t *testing.T) {
+	for _, tt := range []struct {
+		dir  string
+		want string // empty if invalid
+	}{
+		{"out/share/mime", "/out/share/mime"},
+		{"/out/share/mime/", "/out/share/mime"},
+		{"out/share/foo..bar", "/out/share/foo..bar"},
+		{"out/share/../lib", "/out/lib"},
+		{"", ""},
+		{"/", ""},
+		{"..", ""},
+		{"../etc", ""},
+		{"/out/../../etc", ""},
+	} {
+		got, err := env.CleanExchangeDir(tt.dir)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("CleanExchangeDir(%q) = %q, want error", tt.dir, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("CleanExchangeDir(%q): %v", tt.dir, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CleanExchangeDir(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestAlternatives(t *testing.T) {
+	cfg, err := ioutil.TempDir("", "distri-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cfg)
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	if err := os.MkdirAll(filepath.Join(cfg, "alternatives.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const editors = `# prefer neovim over vim
+/bin/vi neovim
+/bin/python* python3
+`
+	if err := ioutil.WriteFile(filepath.Join(cfg, "alternatives.d", "editors.alternatives"), []byte(editors), 0644); err != nil {
+		t.Fatal(err)
+	}
+	alternatives, err := env.Alternatives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []env.Alternative{
+		{Pattern: "/bin/vi", Pkg: "neovim"},
+		{Pattern: "/bin/python*", Pkg: "python3"},
+	}
+	if diff := cmp.Diff(want, alternatives); diff != "" {
+		t.Fatalf("Alternatives(): diff (-want +got):\n%s", diff)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(cfg, "alternatives.d", "invalid.alternatives"), []byte("/bin/vi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Alternatives(); err == nil {
+		t.Fatalf("Alternatives() unexpectedly succeeded with invalid line")
+	}
+}
+
+func TestViews(t *testing.T) {
+	cfg, err := ioutil.TempDir("", "distri-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cfg)
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	views, err := env.Views()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(views) > 0 {
+		t.Fatalf("Views() without views.d: got %v, want none", views)
+	}
+
+	if err := os.MkdirAll(filepath.Join(cfg, "views.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const dev = `# development tools
+gcc
+less-amd64-530-3 # pinned for now
+`
+	if err := ioutil.WriteFile(filepath.Join(cfg, "views.d", "dev.view"), []byte(dev), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg, "views.d", "empty.view"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	views, err = env.Views()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"dev":   {"gcc", "less-amd64-530-3"},
+		"empty": {},
+	}
+	if diff := cmp.Diff(want, views); diff != "" {
+		t.Fatalf("Views(): diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	cfg, err := ioutil.TempDir("", "distri-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cfg)
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	if err := os.MkdirAll(filepath.Join(cfg, "builders.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for fn, contents := range map[string]string{
+		"builder.token": "secret\n",
+		"builders.d/cluster.builder": `# the build cluster
+ws:2019 auth=builder.token # workstation
+cloud:2019 ca=/etc/ssl/builder-ca.pem cert=client.pem key=client.key
+`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(cfg, fn), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builders, err := env.Builders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]env.Builder{
+		"ws:2019": {
+			Addr:      "ws:2019",
+			AuthToken: "secret",
+		},
+		"cloud:2019": {
+			Addr:   "cloud:2019",
+			CACert: "/etc/ssl/builder-ca.pem",
+			Cert:   filepath.Join(cfg, "client.pem"),
+			Key:    filepath.Join(cfg, "client.key"),
+		},
+	}
+	if diff := cmp.Diff(want, builders); diff != "" {
+		t.Fatalf("Builders(): unexpected result: diff (-want +got):\n%s", diff)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(cfg, "builders.d", "broken.builder"), []byte("laptop:2019 cert=client.pem\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Builders(); err == nil {
+		t.Fatalf("Builders() unexpectedly succeeded with cert= but without key=")
+	}
+}
@@ -0,0 +1,467 @@
+// Package extract implements extracting source archives in-process, i.e.
+// without depending on the tar(1) or ar(1) flavor of the host.
+//
+// Supported are tar archives (uncompressed or compressed with gzip, xz, bzip2,
+// lzip or zstd), zip archives and Debian packages (.deb). The format is
+// detected by the contents of the archive, not its file name.
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicLzip  = []byte("LZIP")
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicZip   = []byte("PK\x03\x04")
+	magicAr    = []byte("!<arch>\n")
+)
+
+// Archive extracts the archive fn into the directory dest, which must exist.
+//
+// For tar and zip archives, the first stripComponents path components are
+// removed from each file name, like tar --strip-components does: entries with
+// fewer path components (e.g. the top-level directory) are skipped. For Debian
+// packages, the ar(1) members (e.g. data.tar.xz) are extracted.
+//
+// File names which would be extracted outside of dest, e.g. ../etc/passwd or
+// files underneath symlinks, result in an error. File ownership is not
+// preserved.
+func Archive(fn, dest string, stripComponents int) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(magicAr)) // short archives are handled below
+	switch {
+	case bytes.HasPrefix(magic, magicZip):
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		err = extractZip(f, st.Size(), dest, stripComponents)
+		if err != nil {
+			return xerrors.Errorf("%s: %w", fn, err)
+		}
+		return nil
+
+	case bytes.HasPrefix(magic, magicAr):
+		if err := extractAr(br, dest); err != nil {
+			return xerrors.Errorf("%s: %w", fn, err)
+		}
+		return nil
+	}
+
+	rd, err := decompress(br)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", fn, err)
+	}
+	defer rd.Close()
+	if err := extractTar(rd, dest, stripComponents); err != nil {
+		return xerrors.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// decompress returns a reader for the uncompressed contents of br, detecting
+// the compression format by its magic bytes.
+func decompress(br *bufio.Reader) (io.ReadCloser, error) {
+	magic, _ := br.Peek(len(magicXz))
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		return gzip.NewReader(br)
+
+	case bytes.HasPrefix(magic, magicBzip2):
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+
+	case bytes.HasPrefix(magic, magicXz):
+		rd, err := xz.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(rd), nil
+
+	case bytes.HasPrefix(magic, magicLzip):
+		return lzipReader(br)
+
+	case bytes.HasPrefix(magic, magicZstd):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+
+	default:
+		return ioutil.NopCloser(br), nil // uncompressed
+	}
+}
+
+// lzipReader returns a reader for the contents of the first member of the lzip
+// file br (see https://www.nongnu.org/lzip/manual/lzip_manual.html#File-format),
+// which is all that lzip(1) creates by default. The member trailer is not
+// verified: the integrity of source archives is verified by their hash.
+func lzipReader(br *bufio.Reader) (io.ReadCloser, error) {
+	var hdr struct {
+		Magic   [4]byte
+		Version uint8
+		DictCap uint8 // coded dictionary size
+	}
+	if err := binary.Read(br, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Version != 1 {
+		return nil, xerrors.Errorf("unsupported lzip version %d", hdr.Version)
+	}
+	base := uint32(1) << (hdr.DictCap & 0x1f)
+	dictCap := base - (base/16)*uint32(hdr.DictCap>>5)
+	// A member contains raw LZMA data with fixed properties (lc=3, lp=0, pb=2)
+	// and an end of stream marker, so prepend the equivalent .lzma header:
+	var lzmaHdr bytes.Buffer
+	lzmaHdr.WriteByte(lzma.Properties{LC: 3, LP: 0, PB: 2}.Code())
+	binary.Write(&lzmaHdr, binary.LittleEndian, dictCap)
+	binary.Write(&lzmaHdr, binary.LittleEndian, int64(-1)) // unknown size
+	rd, err := lzma.NewReader(io.MultiReader(&lzmaHdr, br))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(rd), nil
+}
+
+// stripPath removes the first n components of the archive file name name and
+// returns the resulting relative path, or false if no components remain.
+func stripPath(name string, n int) (string, bool, error) {
+	name = strings.TrimPrefix(name, "./")
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	if len(parts) <= n {
+		return "", false, nil
+	}
+	rel := path.Clean(strings.Join(parts[n:], "/"))
+	if rel == "." {
+		return "", false, nil
+	}
+	if path.IsAbs(name) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false, xerrors.Errorf("refusing to extract %q outside of the destination directory", name)
+	}
+	return rel, true, nil
+}
+
+// extractor creates files within dest, refusing to write outside of dest.
+type extractor struct {
+	dest string
+	// dirs records the mode and modification time of all extracted
+	// directories, which are applied after the directory contents were
+	// extracted.
+	dirs map[string]dirAttrs
+}
+
+type dirAttrs struct {
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func newExtractor(dest string) *extractor {
+	return &extractor{dest: dest, dirs: make(map[string]dirAttrs)}
+}
+
+// path returns the path of rel within e.dest, after verifying that none of
+// the parent directories within e.dest is a symlink.
+func (e *extractor) path(rel string) (string, error) {
+	dir := e.dest
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				break // will be created
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", xerrors.Errorf("refusing to extract %q: parent directory %q is a symlink", rel, dir)
+		}
+	}
+	return filepath.Join(e.dest, filepath.FromSlash(rel)), nil
+}
+
+func (e *extractor) mkdirAll(rel string, mode os.FileMode, modTime time.Time) error {
+	p, err := e.path(rel)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(p); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return xerrors.Errorf("refusing to extract directory %q: %q is a symlink", rel, p)
+	}
+	// Directories stay writable until all of their contents are extracted.
+	if err := os.MkdirAll(p, 0755); err != nil {
+		return err
+	}
+	e.dirs[p] = dirAttrs{mode: mode, modTime: modTime}
+	return nil
+}
+
+// create returns a file at rel, replacing existing files (like tar(1), later
+// archive entries win).
+func (e *extractor) create(rel string, mode os.FileMode) (*os.File, error) {
+	p, err := e.prepare(rel)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+}
+
+// prepare creates the parent directory of rel and removes an existing file at
+// rel.
+func (e *extractor) prepare(rel string) (string, error) {
+	p, err := e.path(rel)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return p, nil
+}
+
+func (e *extractor) file(rel string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+	f, err := e.create(rel, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(f.Name(), modTime, modTime)
+}
+
+func (e *extractor) symlink(rel, target string, modTime time.Time) error {
+	p, err := e.prepare(rel)
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(target, p); err != nil {
+		return err
+	}
+	ts := []unix.Timespec{unix.NsecToTimespec(modTime.UnixNano()), unix.NsecToTimespec(modTime.UnixNano())}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, p, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func (e *extractor) hardlink(rel, oldrel string) error {
+	oldpath, err := e.path(oldrel)
+	if err != nil {
+		return err
+	}
+	p, err := e.prepare(rel)
+	if err != nil {
+		return err
+	}
+	return os.Link(oldpath, p)
+}
+
+// finish applies the modes and modification times of all extracted
+// directories, deepest first.
+func (e *extractor) finish() error {
+	paths := make([]string, 0, len(e.dirs))
+	for p := range e.dirs {
+		paths = append(paths, p)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, p := range paths {
+		attrs := e.dirs[p]
+		if err := os.Chmod(p, attrs.mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(p, attrs.modTime, attrs.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTar(r io.Reader, dest string, stripComponents int) error {
+	e := newExtractor(dest)
+	rd := tar.NewReader(r)
+	for {
+		hdr, err := rd.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		rel, ok, err := stripPath(hdr.Name, stripComponents)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = e.mkdirAll(rel, mode, hdr.ModTime)
+
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.file(rel, mode, hdr.ModTime, rd)
+
+		case tar.TypeSymlink:
+			err = e.symlink(rel, hdr.Linkname, hdr.ModTime)
+
+		case tar.TypeLink:
+			oldrel, ok, serr := stripPath(hdr.Linkname, stripComponents)
+			if serr != nil {
+				return serr
+			}
+			if !ok {
+				return xerrors.Errorf("%s: hard link target %q stripped", hdr.Name, hdr.Linkname)
+			}
+			err = e.hardlink(rel, oldrel)
+
+		case tar.TypeXGlobalHeader:
+			// metadata only, e.g. the commit ID in git archive output
+
+		default:
+			// e.g. device nodes, which cannot be created without privileges
+			log.Printf("%s: skipping unsupported tar entry type %q", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return xerrors.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+	return e.finish()
+}
+
+func extractZip(r io.ReaderAt, size int64, dest string, stripComponents int) error {
+	e := newExtractor(dest)
+	rd, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range rd.File {
+		rel, ok, err := stripPath(zf.Name, stripComponents)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := extractZipFile(e, zf, rel); err != nil {
+			return xerrors.Errorf("%s: %w", zf.Name, err)
+		}
+	}
+	return e.finish()
+}
+
+func extractZipFile(e *extractor, zf *zip.File, rel string) error {
+	fi := zf.FileInfo()
+	mode := fi.Mode()
+	if mode.Perm() == 0 {
+		// Archives created on non-unix systems do not contain permissions.
+		mode |= 0644
+		if fi.IsDir() {
+			mode |= 0111
+		}
+	}
+	if fi.IsDir() {
+		return e.mkdirAll(rel, mode.Perm(), zf.Modified)
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if mode&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		return e.symlink(rel, string(target), zf.Modified)
+	}
+	return e.file(rel, mode.Perm(), zf.Modified, rc)
+}
+
+// extractAr extracts the members of the ar(1) archive r (in the common format
+// used by Debian packages) into dest.
+func extractAr(r io.Reader, dest string) error {
+	e := newExtractor(dest)
+	if _, err := io.ReadFull(r, make([]byte, len(magicAr))); err != nil {
+		return err
+	}
+	for {
+		var hdr [60]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if string(hdr[58:60]) != "`\n" {
+			return xerrors.Errorf("malformed ar member header %q", hdr)
+		}
+		// GNU ar terminates names with a slash, BSD ar pads with spaces.
+		name := strings.TrimSuffix(strings.TrimRight(string(hdr[0:16]), " "), "/")
+		mtime, err := strconv.ParseInt(strings.TrimSpace(string(hdr[16:28])), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("%s: malformed modification time: %v", name, err)
+		}
+		mode, err := strconv.ParseUint(strings.TrimSpace(string(hdr[40:48])), 8, 32)
+		if err != nil {
+			return xerrors.Errorf("%s: malformed mode: %v", name, err)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return xerrors.Errorf("%s: malformed size: %v", name, err)
+		}
+		if name == "" || strings.ContainsRune(name, '/') || name == "." || name == ".." {
+			return xerrors.Errorf("refusing to extract ar member %q", name)
+		}
+		lr := &io.LimitedReader{R: r, N: size}
+		if err := e.file(name, os.FileMode(mode).Perm(), time.Unix(mtime, 0), lr); err != nil {
+			return xerrors.Errorf("%s: %w", name, err)
+		}
+		if lr.N > 0 {
+			return xerrors.Errorf("%s: %w", name, io.ErrUnexpectedEOF)
+		}
+		if size%2 == 1 {
+			// Members are aligned to an even offset.
+			if _, err := io.ReadFull(r, make([]byte, 1)); err != nil && err != io.EOF {
+				return err
+			}
+		}
+	}
+	return nil
+}
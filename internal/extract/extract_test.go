@@ -0,0 +1,353 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+var modTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// sourceTar returns a tar archive like upstream source tarballs, i.e. with a
+// top-level directory.
+func sourceTar(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "hello-2.10/", Mode: 0755},
+		{Typeflag: tar.TypeDir, Name: "hello-2.10/doc/", Mode: 0555}, // read-only
+		{Typeflag: tar.TypeReg, Name: "hello-2.10/doc/README", Mode: 0644, Size: int64(len("hello world\n"))},
+		{Typeflag: tar.TypeReg, Name: "hello-2.10/configure", Mode: 0755, Size: int64(len("#!/bin/sh\n"))},
+		{Typeflag: tar.TypeSymlink, Name: "hello-2.10/README", Linkname: "doc/README"},
+		{Typeflag: tar.TypeLink, Name: "hello-2.10/configure.orig", Linkname: "hello-2.10/configure"},
+	} {
+		hdr.ModTime = modTime
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		switch hdr.Name {
+		case "hello-2.10/doc/README":
+			tw.Write([]byte("hello world\n"))
+		case "hello-2.10/configure":
+			tw.Write([]byte("#!/bin/sh\n"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func lzipCompress(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	props := lzma.Properties{LC: 3, LP: 0, PB: 2}
+	const dictCap = 1 << 16
+	w, err := lzma.WriterConfig{
+		Properties: &props,
+		DictCap:    dictCap,
+		Size:       -1,
+		EOSMarker:  true,
+	}.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var lz bytes.Buffer
+	lz.WriteString("LZIP")
+	lz.WriteByte(1)  // version
+	lz.WriteByte(16) // coded dictionary size: 2^16
+	lz.Write(buf.Bytes()[lzma.HeaderLen:])
+	// Trailer: CRC32, data size, member size (not verified).
+	binary.Write(&lz, binary.LittleEndian, [5]uint32{})
+	return lz.Bytes()
+}
+
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			tree[rel] = "-> " + target
+		case info.IsDir():
+			tree[rel] = fmt.Sprintf("dir %o", info.Mode().Perm())
+		default:
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			tree[rel] = fmt.Sprintf("%o %s", info.Mode().Perm(), b)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// extractBytes extracts the archive b into a new temporary directory dest.
+// Callers must call removeAll(dest) when done.
+func extractBytes(t *testing.T, b []byte, stripComponents int) (string, error) {
+	t.Helper()
+	tmp, err := ioutil.TempDir("", "distri-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(tmp, "archive")
+	if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(tmp, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dest, Archive(fn, dest, stripComponents)
+}
+
+// removeAll removes the temporary directory created by extractBytes, including
+// read-only directories.
+func removeAll(dest string) {
+	tmp := filepath.Dir(dest)
+	filepath.Walk(tmp, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			os.Chmod(path, 0755)
+		}
+		return nil
+	})
+	os.RemoveAll(tmp)
+}
+
+func TestTar(t *testing.T) {
+	raw := sourceTar(t)
+	var gz bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	gzw.Write(raw)
+	gzw.Close()
+
+	var xzb bytes.Buffer
+	xzw, err := xz.NewWriter(&xzb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xzw.Write(raw)
+	xzw.Close()
+
+	var zst bytes.Buffer
+	zw, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(raw)
+	zw.Close()
+
+	archives := map[string][]byte{
+		"tar":     raw,
+		"tar.gz":  gz.Bytes(),
+		"tar.xz":  xzb.Bytes(),
+		"tar.lz":  lzipCompress(t, raw),
+		"tar.zst": zst.Bytes(),
+	}
+	if _, err := exec.LookPath("bzip2"); err == nil {
+		bz := exec.Command("bzip2", "-c")
+		bz.Stdin = bytes.NewReader(raw)
+		b, err := bz.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives["tar.bz2"] = b
+	}
+
+	want := map[string]string{
+		"doc":            "dir 555",
+		"doc/README":     "644 hello world\n",
+		"configure":      "755 #!/bin/sh\n",
+		"configure.orig": "755 #!/bin/sh\n",
+		"README":         "-> doc/README",
+	}
+	for name, b := range archives {
+		t.Run(name, func(t *testing.T) {
+			dest, err := extractBytes(t, b, 1)
+			defer removeAll(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, readTree(t, dest)); diff != "" {
+				t.Fatalf("unexpected extracted files: diff (-want +got):\n%s", diff)
+			}
+			st, err := os.Stat(filepath.Join(dest, "doc", "README"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := st.ModTime(); !got.Equal(modTime) {
+				t.Errorf("doc/README: unexpected modification time: got %v, want %v", got, modTime)
+			}
+		})
+	}
+
+	t.Run("NoStrip", func(t *testing.T) {
+		dest, err := extractBytes(t, raw, 0)
+		defer removeAll(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "hello-2.10", "configure")); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name     string
+		mode     os.FileMode
+		contents string
+	}{
+		{name: "hello-2.10/", mode: os.ModeDir | 0755},
+		{name: "hello-2.10/main.go", mode: 0644, contents: "package main\n"},
+		{name: "hello-2.10/build.sh", mode: 0755, contents: "#!/bin/sh\n"},
+		{name: "hello-2.10/run.sh", mode: os.ModeSymlink | 0777, contents: "build.sh"},
+	} {
+		hdr := &zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: modTime}
+		hdr.SetMode(f.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dest, err := extractBytes(t, buf.Bytes(), 1)
+	defer removeAll(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"main.go":  "644 package main\n",
+		"build.sh": "755 #!/bin/sh\n",
+		"run.sh":   "-> build.sh",
+	}
+	if diff := cmp.Diff(want, readTree(t, dest)); diff != "" {
+		t.Fatalf("unexpected extracted files: diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeb(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, m := range []struct{ name, contents string }{
+		{"debian-binary", "2.0\n"},
+		{"control.tar.xz", "control"}, // odd length: padded
+		{"data.tar.xz", "data"},
+	} {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", m.name, modTime.Unix(), 0, 0, 0644, len(m.contents))
+		buf.WriteString(m.contents)
+		if len(m.contents)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+
+	dest, err := extractBytes(t, buf.Bytes(), 1)
+	defer removeAll(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"debian-binary":  "644 2.0\n",
+		"control.tar.xz": "644 control",
+		"data.tar.xz":    "644 data",
+	}
+	if diff := cmp.Diff(want, readTree(t, dest)); diff != "" {
+		t.Fatalf("unexpected extracted files: diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestTraversal(t *testing.T) {
+	for _, tt := range []struct {
+		desc    string
+		headers []*tar.Header
+	}{
+		{
+			desc: "parent directory",
+			headers: []*tar.Header{
+				{Typeflag: tar.TypeReg, Name: "hello-2.10/../../evil", Mode: 0644},
+			},
+		},
+		{
+			desc: "absolute path",
+			headers: []*tar.Header{
+				{Typeflag: tar.TypeReg, Name: "/tmp/evil", Mode: 0644},
+			},
+		},
+		{
+			desc: "through symlink",
+			headers: []*tar.Header{
+				{Typeflag: tar.TypeSymlink, Name: "hello-2.10/tmp", Linkname: "/tmp"},
+				{Typeflag: tar.TypeReg, Name: "hello-2.10/tmp/evil", Mode: 0644},
+			},
+		},
+		{
+			desc: "directory through symlink",
+			headers: []*tar.Header{
+				{Typeflag: tar.TypeSymlink, Name: "hello-2.10/tmp", Linkname: "/tmp"},
+				{Typeflag: tar.TypeDir, Name: "hello-2.10/tmp/", Mode: 0777},
+			},
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, hdr := range tt.headers {
+				if err := tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			dest, err := extractBytes(t, buf.Bytes(), 1)
+			removeAll(dest)
+			if err == nil || !strings.Contains(err.Error(), "refusing") {
+				t.Fatalf("Archive() = %v, want refusing error", err)
+			}
+		})
+	}
+}
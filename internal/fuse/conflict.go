@@ -0,0 +1,165 @@
+package fuse
+
+import (
+	"path"
+	"strings"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/env"
+	"golang.org/x/xerrors"
+)
+
+// Conflict policies, see the -conflict_policy flag:
+const (
+	// policyNewest serves the most recent version of a package.
+	policyNewest = "newest"
+	// policyPinned serves the most recent version of a package which is allowed
+	// by its pin (see env.Pins), if any.
+	policyPinned = "pinned"
+)
+
+// conflictRule identifies which rule of a conflictPolicy decided a conflict,
+// in order of precedence.
+type conflictRule int
+
+const (
+	ruleAlternative conflictRule = iota // alternatives.d
+	rulePin                             // pins.d
+	ruleName                            // different packages
+	ruleVersion                         // different versions of a package
+)
+
+func (r conflictRule) String() string {
+	switch r {
+	case ruleAlternative:
+		return "preferred in alternatives.d"
+	case rulePin:
+		return "allowed by pin"
+	case ruleName:
+		return "package name sorts first"
+	default:
+		return "newest version"
+	}
+}
+
+// conflictPolicy decides which package provides an exchange directory entry
+// (e.g. /bin/python3) which multiple packages provide. Decisions do not depend
+// on the order in which packages are scanned:
+//
+// 1. a package preferred by the first matching env.Alternative wins
+//
+// 2. with policyPinned, a version allowed by its pin wins
+//
+// 3. of different packages, the package whose name sorts first wins
+//
+// 4. of different versions of a package, the most recent version wins
+type conflictPolicy struct {
+	name         string // policyNewest or policyPinned
+	pins         map[string]env.Pin
+	alternatives []env.Alternative
+}
+
+// loadConflictPolicy reads the configuration of the named policy from
+// DistriConfig.
+func loadConflictPolicy(name string) (conflictPolicy, error) {
+	p := conflictPolicy{name: name}
+	switch name {
+	case policyNewest:
+	case policyPinned:
+		pins, err := env.Pins()
+		if err != nil {
+			return p, err
+		}
+		p.pins = pins
+	default:
+		return p, xerrors.Errorf("unknown conflict policy %q (want %q or %q)", name, policyNewest, policyPinned)
+	}
+	alternatives, err := env.Alternatives()
+	if err != nil {
+		return p, err
+	}
+	p.alternatives = alternatives
+	return p, nil
+}
+
+// targetPackage returns the package (e.g. bash-amd64-5.0-4) of an exchange
+// directory symlink target (e.g. ../../bash-amd64-5.0-4/out/lib/libfoo.so).
+func targetPackage(target string) string {
+	for strings.HasPrefix(target, "../") {
+		target = target[len("../"):]
+	}
+	if idx := strings.IndexByte(target, '/'); idx > -1 {
+		return target[:idx]
+	}
+	return target
+}
+
+func (p *conflictPolicy) preferred(exchangePath string) (string, bool) {
+	for _, a := range p.alternatives {
+		if matched, _ := path.Match(a.Pattern, exchangePath); matched {
+			return a.Pkg, true
+		}
+	}
+	return "", false
+}
+
+func (p *conflictPolicy) allowed(pkg string, pv distri.PackageVersion) bool {
+	pin, ok := p.pins[pv.Pkg]
+	return !ok || pin.Allows(strings.TrimPrefix(pkg, pv.Pkg+"-"+pv.Arch+"-"))
+}
+
+// prefer reports whether link target a should be served instead of link target
+// b for exchangePath (e.g. /bin/python3), and which rule decided.
+func (p *conflictPolicy) prefer(exchangePath, a, b string) (bool, conflictRule) {
+	pkgA, pkgB := targetPackage(a), targetPackage(b)
+	pvA, pvB := distri.ParseVersion(pkgA), distri.ParseVersion(pkgB)
+	if pkg, ok := p.preferred(exchangePath); ok && (pvA.Pkg == pkg) != (pvB.Pkg == pkg) {
+		return pvA.Pkg == pkg, ruleAlternative
+	}
+	if p.name == policyPinned {
+		if allowedA, allowedB := p.allowed(pkgA, pvA), p.allowed(pkgB, pvB); allowedA != allowedB {
+			return allowedA, rulePin
+		}
+	}
+	if pvA.Pkg != pvB.Pkg {
+		return pvA.Pkg < pvB.Pkg, ruleName
+	}
+	if c := pvA.Compare(pvB); c != 0 {
+		return c > 0, ruleVersion
+	}
+	return pkgA < pkgB, ruleVersion // e.g. different architectures
+}
+
+// resolveConflicts re-evaluates all exchange directory entries which multiple
+// packages provide, e.g. after fs.policy changed. resolveConflicts must be
+// called with fs.mu held.
+func (fs *fuseFS) resolveConflicts() {
+	for path, dir := range fs.dirs {
+		for idx, dirent := range dir.entries {
+			if dirent == nil || len(dirent.alternatives) == 0 {
+				continue
+			}
+			best := dirent.linkTarget
+			for _, alt := range dirent.alternatives {
+				if prefer, _ := fs.policy.prefer(viewRelative(path+"/"+dirent.name), alt, best); prefer {
+					best = alt
+				}
+			}
+			if best == dirent.linkTarget {
+				continue
+			}
+			targets := []string{best, dirent.linkTarget}
+			for _, alt := range dirent.alternatives {
+				if alt != best {
+					targets = append(targets, alt)
+				}
+			}
+			delete(dir.byName, dirent.name)
+			delete(fs.inodes, dirent.inode)
+			dir.entries[idx] = nil // tombstone
+			for _, target := range targets {
+				fs.symlink(path, dir, target)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	newest := conflictPolicy{name: policyNewest}
+	pinned := conflictPolicy{
+		name: policyPinned,
+		pins: map[string]env.Pin{"python3": {Pkg: "python3", Version: "3.7.*"}},
+	}
+	preferring := conflictPolicy{
+		name:         policyNewest,
+		alternatives: []env.Alternative{{Pattern: "/bin/python*", Pkg: "python3"}},
+	}
+	for _, tt := range []struct {
+		desc   string
+		policy conflictPolicy
+		path   string
+		a, b   string
+		want   bool
+		rule   conflictRule
+	}{
+		{
+			desc:   "newest version",
+			policy: newest,
+			path:   "/bin/python3",
+			a:      "../python3-amd64-3.8.2-5/bin/python3",
+			b:      "../python3-amd64-3.7.0-4/bin/python3",
+			want:   true,
+			rule:   ruleVersion,
+		},
+		{
+			desc:   "pinned version",
+			policy: pinned,
+			path:   "/bin/python3",
+			a:      "../python3-amd64-3.8.2-5/bin/python3",
+			b:      "../python3-amd64-3.7.0-4/bin/python3",
+			want:   false,
+			rule:   rulePin,
+		},
+		{
+			desc:   "package name",
+			policy: newest,
+			path:   "/bin/python3",
+			a:      "../python3-amd64-3.8.2-5/bin/python3",
+			b:      "../micropython-amd64-1.12-1/bin/python3",
+			want:   false,
+			rule:   ruleName,
+		},
+		{
+			desc:   "alternative",
+			policy: preferring,
+			path:   "/bin/python3",
+			a:      "../python3-amd64-3.8.2-5/bin/python3",
+			b:      "../micropython-amd64-1.12-1/bin/python3",
+			want:   true,
+			rule:   ruleAlternative,
+		},
+		{
+			desc:   "alternative does not match",
+			policy: preferring,
+			path:   "/lib/libpython3.so",
+			a:      "../../python3-amd64-3.8.2-5/out/lib/libpython3.so",
+			b:      "../../micropython-amd64-1.12-1/out/lib/libpython3.so",
+			want:   false,
+			rule:   ruleName,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, rule := tt.policy.prefer(tt.path, tt.a, tt.b)
+			if got != tt.want || rule != tt.rule {
+				t.Errorf("prefer(%s, %s, %s) = %v, %v, want %v, %v", tt.path, tt.a, tt.b, got, rule, tt.want, tt.rule)
+			}
+			// The decision must not depend on the argument order:
+			if got, _ := tt.policy.prefer(tt.path, tt.b, tt.a); got == tt.want {
+				t.Errorf("prefer(%s, %s, %s) = %v, want %v", tt.path, tt.b, tt.a, got, !tt.want)
+			}
+		})
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-conflict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	for _, pkg := range []string{"python3-amd64-3.8.2-5", "micropython-amd64-1.12-1"} {
+		writePackage(t, repo, pkg, "bin/python3")
+	}
+
+	fs := newTestFS(repo)
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	linkTarget := func() string {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if d, ok := fs.dirs["/bin"].byName["python3"]; ok {
+			return d.linkTarget
+		}
+		return ""
+	}
+	if got, want := linkTarget(), "../micropython-amd64-1.12-1/bin/python3"; got != want {
+		t.Fatalf("unexpected link target: got %q, want %q", got, want)
+	}
+
+	numInodes := func() int {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		return len(fs.inodes)
+	}
+	before := numInodes()
+
+	// Prefer python3, like alternatives.d would:
+	fs.mu.Lock()
+	fs.policy.alternatives = []env.Alternative{{Pattern: "/bin/python3", Pkg: "python3"}}
+	fs.resolveConflicts()
+	fs.mu.Unlock()
+	if got, want := linkTarget(), "../python3-amd64-3.8.2-5/bin/python3"; got != want {
+		t.Fatalf("unexpected link target after preferring python3: got %q, want %q", got, want)
+	}
+	// The replaced symlink must not leak its inode:
+	if got, want := numInodes(), before; got != want {
+		t.Errorf("unexpected number of inodes after resolving conflicts: got %d, want %d", got, want)
+	}
+
+	ctx := context.Background()
+	resp, err := fs.ListConflicts(ctx, &pb.ListConflictsRequest{Dir: proto.String("/bin")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(resp.GetConflict()), 1; got != want {
+		t.Fatalf("unexpected number of conflicts: got %d, want %d", got, want)
+	}
+	c := resp.GetConflict()[0]
+	if got, want := c.GetProvider(), "python3-amd64-3.8.2-5"; got != want {
+		t.Errorf("unexpected provider: got %q, want %q", got, want)
+	}
+	if got, want := c.GetReason(), ruleAlternative.String(); got != want {
+		t.Errorf("unexpected reason: got %q, want %q", got, want)
+	}
+
+	// Removing the provider falls back to the alternative:
+	if _, err := fs.RemovePackages(ctx, &pb.RemovePackagesRequest{
+		Package: []string{"python3-amd64-3.8.2-5"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := linkTarget(), "../micropython-amd64-1.12-1/bin/python3"; got != want {
+		t.Fatalf("unexpected link target after removal: got %q, want %q", got, want)
+	}
+	resp, err = fs.ListConflicts(ctx, &pb.ListConflictsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.GetConflict(); len(got) > 0 {
+		t.Errorf("unexpected conflicts after removal: %v", got)
+	}
+}
@@ -0,0 +1,137 @@
+package fuse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+// packageStats returns the packages of the file system and their statistics.
+func (fs *fuseFS) packageStats(openedOnly bool) []*pb.ListPackagesReply_Package {
+	fs.mu.Lock()
+	pkgs := append([]string(nil), fs.pkgs...)
+	readers := append([]*squashfsReader(nil), fs.readers...)
+	fs.mu.Unlock()
+
+	var stats []*pb.ListPackagesReply_Package
+	for idx, pkg := range pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
+		var rd *squashfsReader
+		if idx < len(readers) {
+			rd = readers[idx]
+		}
+		if openedOnly && rd == nil {
+			continue
+		}
+		p := &pb.ListPackagesReply_Package{
+			Name:   proto.String(pkg),
+			Image:  proto.String(filepath.Join(fs.repo, pkg+".squashfs")),
+			Opened: proto.Bool(rd != nil),
+		}
+		if st, err := os.Stat(p.GetImage()); err == nil {
+			p.Size = proto.Uint64(uint64(st.Size()))
+		}
+		if rd != nil {
+			p.Reads = proto.Uint64(atomic.LoadUint64(&rd.reads))
+			p.ReadBytes = proto.Uint64(atomic.LoadUint64(&rd.readBytes))
+			p.DircacheHits = proto.Uint64(atomic.LoadUint64(&rd.dircacheHits))
+			p.DircacheMisses = proto.Uint64(atomic.LoadUint64(&rd.dircacheMisses))
+			if sf, ok := rd.file.(*streamFile); ok {
+				p.Streamed = proto.Bool(true)
+				p.Image = proto.String(sf.f.Name())
+				p.Size = proto.Uint64(uint64(sf.size))
+				p.StreamHits = proto.Uint64(atomic.LoadUint64(&sf.hits))
+				p.StreamMisses = proto.Uint64(atomic.LoadUint64(&sf.misses))
+			}
+		}
+		stats = append(stats, p)
+	}
+	return stats
+}
+
+func (fs *fuseFS) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusReply, error) {
+	reply := &pb.StatusReply{
+		Repo:         proto.String(fs.repo),
+		Section:      proto.String(fs.repoSection),
+		Autodownload: proto.Bool(fs.autoDownload),
+		Stream:       proto.Bool(fs.streamCache != nil),
+	}
+	var packages, opened, reads, readBytes, dircacheHits, dircacheMisses, streamHits, streamMisses uint64
+	for _, p := range fs.packageStats(false) {
+		packages++
+		if p.GetOpened() {
+			opened++
+		}
+		reads += p.GetReads()
+		readBytes += p.GetReadBytes()
+		dircacheHits += p.GetDircacheHits()
+		dircacheMisses += p.GetDircacheMisses()
+		streamHits += p.GetStreamHits()
+		streamMisses += p.GetStreamMisses()
+	}
+	reply.Packages = proto.Uint64(packages)
+	reply.Opened = proto.Uint64(opened)
+	reply.Reads = proto.Uint64(reads)
+	reply.ReadBytes = proto.Uint64(readBytes)
+	reply.DircacheHits = proto.Uint64(dircacheHits)
+	reply.DircacheMisses = proto.Uint64(dircacheMisses)
+	reply.StreamHits = proto.Uint64(streamHits)
+	reply.StreamMisses = proto.Uint64(streamMisses)
+	if c := fs.streamCache; c != nil {
+		reply.StreamCacheUsed = proto.Uint64(uint64(c.usage()))
+		reply.StreamCacheBudget = proto.Uint64(uint64(c.budget))
+	}
+	return reply, nil
+}
+
+func (fs *fuseFS) ListPackages(ctx context.Context, req *pb.ListPackagesRequest) (*pb.ListPackagesReply, error) {
+	return &pb.ListPackagesReply{Package: fs.packageStats(req.GetOpenedOnly())}, nil
+}
+
+func (fs *fuseFS) ListConflicts(ctx context.Context, req *pb.ListConflictsRequest) (*pb.ListConflictsReply, error) {
+	prefix := strings.TrimSuffix(req.GetDir(), "/") + "/"
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var conflicts []*pb.ListConflictsReply_Conflict
+	for path, dir := range fs.dirs {
+		for _, dirent := range dir.entries {
+			if dirent == nil || len(dirent.alternatives) == 0 {
+				continue
+			}
+			exchangePath := path + "/" + dirent.name
+			if !strings.HasPrefix(exchangePath, prefix) {
+				continue
+			}
+			// Report the most significant rule by which the served target
+			// was preferred over the alternatives:
+			reason := ruleVersion
+			pkgs := []string{targetPackage(dirent.linkTarget)}
+			for _, alt := range dirent.alternatives {
+				pkgs = append(pkgs, targetPackage(alt))
+				if _, rule := fs.policy.prefer(viewRelative(exchangePath), dirent.linkTarget, alt); rule < reason {
+					reason = rule
+				}
+			}
+			sort.Strings(pkgs)
+			conflicts = append(conflicts, &pb.ListConflictsReply_Conflict{
+				Path:     proto.String(exchangePath),
+				Target:   proto.String(dirent.linkTarget),
+				Package:  pkgs,
+				Provider: proto.String(targetPackage(dirent.linkTarget)),
+				Reason:   proto.String(reason.String()),
+			})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].GetPath() < conflicts[j].GetPath()
+	})
+	return &pb.ListConflictsReply{Conflict: conflicts}, nil
+}
@@ -0,0 +1,112 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestControlRPCs(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-ctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	writePackage(t, repo, "hello-amd64-1", "bin/hello")
+	writePackage(t, repo, "hello-amd64-2", "bin/hello")
+	writePackage(t, repo, "other-amd64-1", "bin/other")
+
+	fs := newTestFS(repo)
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("ListConflicts", func(t *testing.T) {
+		resp, err := fs.ListConflicts(ctx, &pb.ListConflictsRequest{Dir: proto.String("/bin")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(resp.GetConflict()), 1; got != want {
+			t.Fatalf("unexpected number of conflicts: got %d, want %d (%v)", got, want, resp.GetConflict())
+		}
+		c := resp.GetConflict()[0]
+		if got, want := c.GetPath(), "/bin/hello"; got != want {
+			t.Errorf("unexpected conflict path: got %q, want %q", got, want)
+		}
+		if got, want := c.GetTarget(), "../hello-amd64-2/bin/hello"; got != want {
+			t.Errorf("unexpected conflict target: got %q, want %q", got, want)
+		}
+		want := map[string]bool{"hello-amd64-1": true, "hello-amd64-2": true}
+		got := make(map[string]bool)
+		for _, pkg := range c.GetPackage() {
+			got[pkg] = true
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected providers: diff (-want +got):\n%s", diff)
+		}
+
+		resp, err = fs.ListConflicts(ctx, &pb.ListConflictsRequest{Dir: proto.String("/lib")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.GetConflict(); len(got) > 0 {
+			t.Errorf("unexpected conflicts in /lib: %v", got)
+		}
+	})
+
+	var image int
+	for idx, pkg := range fs.pkgs {
+		if pkg == "other-amd64-1" {
+			image = idx
+		}
+	}
+	if _, err := fs.mountImage(image); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("ListPackages", func(t *testing.T) {
+		resp, err := fs.ListPackages(ctx, &pb.ListPackagesRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(resp.GetPackage()), 3; got != want {
+			t.Fatalf("unexpected number of packages: got %d, want %d", got, want)
+		}
+		for _, p := range resp.GetPackage() {
+			if p.GetSize() == 0 {
+				t.Errorf("%s: unexpectedly empty image size", p.GetName())
+			}
+		}
+
+		resp, err = fs.ListPackages(ctx, &pb.ListPackagesRequest{OpenedOnly: proto.Bool(true)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(resp.GetPackage()), 1; got != want {
+			t.Fatalf("unexpected number of opened packages: got %d, want %d", got, want)
+		}
+		if got, want := resp.GetPackage()[0].GetName(), "other-amd64-1"; got != want {
+			t.Errorf("unexpected opened package: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		resp, err := fs.Status(ctx, &pb.StatusRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := resp.GetPackages(), uint64(3); got != want {
+			t.Errorf("unexpected number of packages: got %d, want %d", got, want)
+		}
+		if got, want := resp.GetOpened(), uint64(1); got != want {
+			t.Errorf("unexpected number of opened packages: got %d, want %d", got, want)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package fuse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeclaredExchangeDirs(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-exchange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	writePackage(t, repo, "other-amd64-1", "out/etc/fonts/other.conf")
+
+	fs := newTestFS(repo)
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.dirs["/etc/fonts"]; ok {
+		t.Fatalf("/etc/fonts unexpectedly provided before any package declared it")
+	}
+
+	// Install a package which declares /out/etc/fonts as exchange directory:
+	meta := []byte(`source_pkg: "fontconfig"
+version: "1"
+exchange_dir: "out/etc/fonts"
+`)
+	if err := ioutil.WriteFile(filepath.Join(repo, "fontconfig-amd64-1.meta.textproto"), meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeImageFiles(t, filepath.Join(repo, "fontconfig-amd64-1.squashfs"), "out/etc/fonts/fonts.conf")
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+
+	fonts, ok := fs.dirs["/etc/fonts"]
+	if !ok {
+		t.Fatalf("/etc/fonts not provided after fontconfig declared it")
+	}
+	for name, want := range map[string]string{
+		"fonts.conf": "../../fontconfig-amd64-1/out/etc/fonts/fonts.conf",
+		// other-amd64-1 was scanned before /out/etc/fonts was declared:
+		"other.conf": "../../other-amd64-1/out/etc/fonts/other.conf",
+	} {
+		d, ok := fonts.byName[name]
+		if !ok {
+			t.Errorf("/etc/fonts/%s not found", name)
+			continue
+		}
+		if got := d.linkTarget; got != want {
+			t.Errorf("/etc/fonts/%s: unexpected link target: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLinkLoader(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	for _, pkg := range []string{"glibc-amd64-2.31-3", "glibc-amd64-2.31-4"} {
+		writePackage(t, repo, pkg, "out/lib/ld-linux-x86-64.so.2")
+	}
+
+	fs := newTestFS(repo)
+	// Like -overlays=/bin, i.e. without the /out/lib exchange directory:
+	fs.exchangeDirs = []string{"/bin"}
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	lib, ok := fs.dirs["/lib"]
+	if !ok {
+		t.Fatalf("/lib not provided")
+	}
+	d, ok := lib.byName["ld-linux-x86-64.so.2"]
+	if !ok {
+		t.Fatalf("/lib/ld-linux-x86-64.so.2 not found")
+	}
+	if got, want := d.linkTarget, "../glibc-amd64-2.31-4/out/lib/ld-linux-x86-64.so.2"; got != want {
+		t.Errorf("unexpected link target: got %q, want %q", got, want)
+	}
+}
@@ -9,17 +9,16 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
-	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/fuse/fuseutil"
@@ -41,31 +40,6 @@ Example:
   % distri fuse /ro
 `
 
-// wellKnown lists paths which should be created as a union overlay underneath
-// /ro. E.g., /ro/bin will contain symlinks to all package’s bin directories, or
-// /ro/system will contain symlinks to all package’s
-// out/lib/systemd/system directories.
-var ExchangeDirs = []string{
-	"/bin",
-	"/out/lib",
-	"/out/lib64",
-	"/out/lib/gio",
-	"/out/lib/girepository-1.0",
-	"/out/include",
-	"/out/share",
-	"/out/share/aclocal",
-	"/out/share/gettext",
-	// TODO: patch gettext’s msgfmt code to search in
-	// /ro/gettext…/out/share/gettext-0.19.8 directly (too tight coupling to
-	// qualify for an exchange directory).
-	"/out/share/gettext-0.19.8",
-	"/out/share/gir-1.0",
-	"/out/share/glib-2.0/schemas",
-	"/out/share/mime",
-	"/out/gopath",
-	"/debug",
-}
-
 // TODO: pprof label for each of the exchange dirs so that we can profile them
 
 const (
@@ -83,9 +57,12 @@ func Mount(ctx context.Context, args []string) (join func(context.Context) error
 		pkgsList     = fset.String("pkgs", "", "comma-separated list of packages to provide. if empty, all packages within -repo will be provided")
 		autoDownload = fset.Bool("autodownload", false, "simulate availability of all packages, automatically downloading them as required. works well for e.g. /ro-dbg")
 		section      = fset.String("section", "pkg", "repository section to serve (one of pkg, debug, src)")
+		stream       = fset.Bool("stream", false, "with -autodownload, read images on demand using HTTP range requests instead of downloading them entirely")
+		streamCache  = fset.Int64("stream_cache_mb", 2048, "size budget of the -stream block cache (stored in <repo>/.stream) in MiB")
+		policyName   = fset.String("conflict_policy", policyNewest, "which version of a package provides exchange directory entries: “newest”, or “pinned” for the newest version allowed by /etc/distri/pins.d. Packages preferred in /etc/distri/alternatives.d take precedence either way")
 	)
 	fset.Usage = func() {
-		fmt.Fprintln(os.Stderr, help)
+		fmt.Fprintf(os.Stderr, "%s\n", help)
 		fmt.Fprintf(os.Stderr, "Flags for distri %s:\n", fset.Name())
 		fset.PrintDefaults()
 	}
@@ -106,36 +83,47 @@ func Mount(ctx context.Context, args []string) (join func(context.Context) error
 
 	// TODO: do what fusermount -u does, i.e. umount2("/ro-dbg", UMOUNT_NOFOLLOW)
 
+	exchangeDirs, err := env.ExchangeDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := loadConflictPolicy(*policyName)
+	if err != nil {
+		return nil, err
+	}
+
+	var permitted map[string]bool
 	if *overlays != "" {
-		var filtered []string
-		permitted := make(map[string]bool)
+		permitted = make(map[string]bool)
 		for _, overlay := range strings.Split(strings.TrimSpace(*overlays), ",") {
 			if overlay == "" {
 				continue
 			}
 			permitted[overlay] = true
 		}
-		for _, dir := range ExchangeDirs {
-			if !permitted[dir] {
-				continue
-			}
-			filtered = append(filtered, dir)
-		}
-		ExchangeDirs = filtered
 	}
 
-	// TODO: use inotify to efficiently get updates to the store
-
 	fs := &fuseFS{
 		repo:         *repo,
 		remoteRepos:  remotes,
 		autoDownload: *autoDownload,
 		repoSection:  *section,
-		fileReaders:  make(map[fuseops.InodeID]*io.SectionReader),
+		fileReaders:  make(map[fuseops.InodeID]*squashfs.File),
 		inodeCnt:     2, // root + ctl inode
 		dirs:         make(map[string]*dir),
 		inodes:       make(map[fuseops.InodeID]interface{}),
 		unions:       make(map[fuseops.InodeID][]fuseops.InodeID),
+		remotePkgs:   make(map[string]*remotePackage),
+		overlays:     permitted,
+		policy:       policy,
+		views:        make(map[string]*view),
+	}
+	fs.addExchangeDirs(exchangeDirs)
+	if *autoDownload && *stream {
+		if fs.streamCache, err = newStreamCache(filepath.Join(*repo, ".stream"), *streamCache<<20); err != nil {
+			return nil, err
+		}
 	}
 	dir := &dir{
 		byName: make(map[string]*dirent),
@@ -155,6 +143,9 @@ func Mount(ctx context.Context, args []string) (join func(context.Context) error
 	}
 	fs.growReaders(len(pkgs))
 
+	if err := fs.loadViews(); err != nil {
+		return nil, err
+	}
 	if err := fs.scanPackages(&nopLocker{}, pkgs); err != nil {
 		return nil, err
 	}
@@ -175,21 +166,6 @@ func Mount(ctx context.Context, args []string) (join func(context.Context) error
 		}
 	}
 
-	var libRequested bool
-	for _, dir := range ExchangeDirs {
-		if dir == "/lib" {
-			libRequested = true
-			break
-		}
-	}
-	if !libRequested {
-		// Even if the /lib exchange dir was not requested, we still need to
-		// provide a symlink to ld-linux.so, which is used as the .interp of our
-		// ELF binaries.
-		fs.mkExchangeDirAll(&nopLocker{}, "/lib")
-		fs.symlink(fs.dirs["/lib"], "../glibc-amd64-2.27-1/out/lib/ld-linux-x86-64.so.2")
-	}
-
 	server := fuseutil.NewFileSystemServer(fs)
 
 	go func() {
@@ -214,33 +190,39 @@ func Mount(ctx context.Context, args []string) (join func(context.Context) error
 			signal.Notify(c, syscall.SIGUSR1)
 			for range c {
 				log.Printf("scanning packages upon SIGUSR1")
-				pkgs, err := fs.findPackages()
-				if err != nil {
-					log.Printf("findPackages: %v", err)
-					continue
-				}
-				fs.mu.Lock()
-				err = fs.scanPackages(&nopLocker{}, pkgs)
-				fs.mu.Unlock()
-				if err != nil {
-					log.Printf("scanPackages: %v", err)
+				if err := fs.rescanPackages(); err != nil {
+					log.Print(err)
 				}
 				log.Printf("scan done")
 			}
 		}()
+
+		// With -autodownload, images appear in the repo as they are
+		// downloaded, so the repo contents do not reflect the package list.
+		if !fs.autoDownload {
+			if err := fs.watchPackages(ctx); err != nil {
+				log.Printf("not watching %s for new packages: %v", fs.repo, err)
+			}
+		}
 	}
 
 	// logf, err := os.Create("/tmp/fuse.log")
 	// if err != nil {
 	// 	return nil, err
 	// }
+	// To notify the kernel about exchange directory changes, we need to find
+	// the /dev/fuse file descriptor which fuse.Mount opens:
+	fuseFDs, err := devFUSEFDs()
+	if err != nil {
+		log.Printf("not sending invalidation notifications: %v", err)
+	}
 	mfs, err := fuse.Mount(mountpoint, server, &fuse.MountConfig{
 		FSName: "distri",
-		// While squashfs contents are read-only, e.g. exchange directories are
-		// not, so the file system as a whole cannot be read-only. When ReadOnly
-		// is true, the kernel caches so aggressively that newly appearing
-		// images are not accessible.
-		ReadOnly: false,
+		// Exchange directories change, but changes are explicitly invalidated
+		// (see fuseFS.invalidate), so the file system as a whole can be
+		// read-only. Without notifications, the kernel caches so aggressively
+		// in read-only mode that newly appearing images are not accessible.
+		ReadOnly: fuseFDs != nil,
 		Options: map[string]string{
 			"allow_other": "", // allow all users to read files
 			"suid":        "",
@@ -255,6 +237,20 @@ func Mount(ctx context.Context, args []string) (join func(context.Context) error
 	if err != nil {
 		return nil, xerrors.Errorf("fuse.Mount: %v", err)
 	}
+	if fuseFDs != nil {
+		dev, err := openFUSEDev(fuseFDs)
+		if err != nil {
+			// The file system was mounted read-only, which is only usable with
+			// invalidation notifications (see above).
+			if err := fuse.Unmount(mountpoint); err != nil {
+				log.Printf("fuse.Unmount: %v", err)
+			}
+			return nil, xerrors.Errorf("sending invalidation notifications: %v", err)
+		}
+		fs.mu.Lock()
+		fs.notify = dev
+		fs.mu.Unlock()
+	}
 	join = func(ctx context.Context) error {
 		defer syscall.Unmount(mountpoint, 0)
 		return mfs.Join(ctx)
@@ -308,6 +304,9 @@ type dirent struct {
 	name       string // e.g. "xterm"
 	linkTarget string // e.g. "../../xterm-amd64-23/bin/xterm". Empty for directories
 	inode      fuseops.InodeID
+	// alternatives contains the link targets of the other packages providing
+	// this symlink, see conflictPolicy. nil unless there is a conflict.
+	alternatives []string
 }
 
 func (d *dirent) typ() fuseutil.DirentType {
@@ -337,9 +336,13 @@ type dir struct {
 }
 
 type squashfsReader struct {
+	// Statistics, accessed atomically. Placed first for 64-bit alignment.
+	reads, readBytes             uint64
+	dircacheHits, dircacheMisses uint64
+
 	*squashfs.Reader
 
-	file *os.File // for closing it in Destroy
+	file io.Closer // for closing it in Destroy
 
 	dircacheMu sync.Mutex
 	dircache   map[squashfs.Inode]map[string]fuseops.ChildInodeEntry
@@ -352,7 +355,8 @@ type fuseFS struct {
 	remoteRepos  []distri.Repo
 	ctl          string
 	autoDownload bool
-	repoSection  string // e.g. “debug” (default “pkg”)
+	repoSection  string       // e.g. “debug” (default “pkg”)
+	streamCache  *streamCache // non-nil if streaming autodownloaded images
 
 	mu       sync.Mutex
 	inodeCnt fuseops.InodeID
@@ -365,9 +369,28 @@ type fuseFS struct {
 	// readers contains one SquashFS reader for every package, or nil if the
 	// package has not yet been accessed.
 	readers []*squashfsReader
+	// remotePkgs contains the remote repositories from which packages can be
+	// automatically downloaded, by package name.
+	remotePkgs map[string]*remotePackage
+	// exchangeDirs contains the exchange directories within package images
+	// (e.g. /out/lib), both configured and declared by packages.
+	exchangeDirs []string
+	// overlays restricts exchangeDirs to the -overlays flag, if non-nil.
+	overlays map[string]bool
+	// policy decides which package provides conflicting exchange directory
+	// entries.
+	policy conflictPolicy
+	// views contains the views (package sets with their own exchange
+	// directories underneath /.views), by name.
+	views map[string]*view
+	// notify is the FUSE device to which invalidation notifications are
+	// written, or nil if notifications are not supported.
+	notify io.Writer
+	// staleEntries are invalidated by the next call to invalidate.
+	staleEntries []staleEntry
 
 	fileReadersMu sync.Mutex
-	fileReaders   map[fuseops.InodeID]*io.SectionReader
+	fileReaders   map[fuseops.InodeID]*squashfs.File
 }
 
 func (fs *fuseFS) growReaders(n int) {
@@ -422,39 +445,53 @@ func (fs *fuseFS) mkExchangeDirAll(mu sync.Locker, path string) {
 		parent.entries = append(parent.entries, dirent)
 		parent.byName[dirent.name] = dirent // might shadow an old symlink dirent
 		fs.inodes[dirent.inode] = dir
+		fs.stale(parentPath, component)
 	}
 }
 
-func (fs *fuseFS) symlink(dir *dir, target string) {
+// symlink adds a symlink to target (e.g. ../hello-amd64-1/bin/hello) to dir,
+// whose path is path (e.g. /bin or /.views/dev/bin). If another package already
+// provides the symlink, fs.policy decides which target is served. symlink must
+// be called with fs.mu held.
+func (fs *fuseFS) symlink(path string, dir *dir, target string) {
 	base := filepath.Base(target)
 	current := dir.byName[base]
+	var alternatives []string
 	if current != nil {
 		if current.linkTarget == "" {
 			return // do not shadow exchange directories
 		}
-		versionTarget := distri.ParseVersion(target)
-		versionCurrent := distri.ParseVersion(current.linkTarget)
-		if versionTarget.Pkg != versionCurrent.Pkg {
-			return // different package already owns this link
+		if current.linkTarget == target {
+			return
+		}
+		for _, alt := range current.alternatives {
+			if alt == target {
+				return
+			}
 		}
-		if versionTarget.DistriRevision < versionCurrent.DistriRevision {
-			return // more recent link target already in place
+		if prefer, _ := fs.policy.prefer(viewRelative(path+"/"+base), target, current.linkTarget); !prefer {
+			current.alternatives = append(current.alternatives, target)
+			return
 		}
+		alternatives = append(current.alternatives, current.linkTarget)
 		for idx, entry := range dir.entries {
 			if entry == nil || entry.name != base {
 				continue
 			}
+			delete(fs.inodes, entry.inode)
 			dir.entries[idx] = nil // tombstone
 		}
 	}
 	dirent := &dirent{
-		name:       base,
-		linkTarget: target,
-		inode:      fs.allocateInodeLocked(),
+		name:         base,
+		linkTarget:   target,
+		inode:        fs.allocateInodeLocked(),
+		alternatives: alternatives,
 	}
 	dir.entries = append(dir.entries, dirent)
 	dir.byName[base] = dirent
 	fs.inodes[dirent.inode] = dirent
+	fs.stale(path, base)
 }
 
 func (fs *fuseFS) findPackages() ([]string, error) {
@@ -492,7 +529,10 @@ func countSlashes(filename string) int {
 	return count
 }
 
-func (fs *fuseFS) scanPackagesSymlink(mu sync.Locker, rd *squashfs.Reader, pkg string, exchangeDirs []string) error {
+// walkExchangeDirs calls fn for all files and directories within exchangeDirs
+// (e.g. /out/lib) of rd, recursively. dir is the directory containing fi, e.g.
+// /out/lib/pkgconfig.
+func walkExchangeDirs(rd *squashfs.Reader, exchangeDirs []string, fn func(dir string, fi os.FileInfo) error) error {
 	type pathWithInode struct {
 		path  string
 		inode squashfs.Inode
@@ -512,38 +552,81 @@ func (fs *fuseFS) scanPackagesSymlink(mu sync.Locker, rd *squashfs.Reader, pkg s
 	for len(inodes) > 0 {
 		path, inode := inodes[0].path, inodes[0].inode
 		inodes = inodes[1:]
-		exchangePath := strings.TrimPrefix(path, "/out")
-		prefix := strings.Repeat("../", countSlashes(exchangePath)-1)
-		mu.Lock()
-		dir, ok := fs.dirs[exchangePath]
-		mu.Unlock()
-		if !ok {
-			panic(fmt.Sprintf("BUG: fs.dirs[%q] not found", exchangePath))
-		}
 		sfis, err := rd.ReaddirNoStat(inode)
 		if err != nil {
-			return xerrors.Errorf("Readdir(%s, %v): %v", pkg, dir, err)
+			return xerrors.Errorf("Readdir(%s): %v", path, err)
 		}
 		for _, sfi := range sfis {
+			if err := fn(path, sfi); err != nil {
+				return err
+			}
 			if sfi.Mode().IsDir() {
-				dir := filepath.Join(path, sfi.Name())
-				fs.mkExchangeDirAll(mu, strings.TrimPrefix(dir, "/out"))
-				inodes = append(inodes, pathWithInode{dir, sfi.Sys().(*squashfs.FileInfo).Inode})
-				continue
+				inodes = append(inodes, pathWithInode{filepath.Join(path, sfi.Name()), sfi.Sys().(*squashfs.FileInfo).Inode})
 			}
-			full := "/" + pkg + path + "/" + sfi.Name()
-			rel := prefix + full[1:]
+		}
+	}
+	return nil
+}
+
+// scanPackagesSymlink adds symlinks for the files within exchangeDirs of pkg to
+// the exchange directories underneath root (empty for the global exchange
+// directories, or a view root such as /.views/dev).
+func (fs *fuseFS) scanPackagesSymlink(mu sync.Locker, rd *squashfs.Reader, pkg, root string, exchangeDirs []string) error {
+	var (
+		lastPath     string
+		exchangePath string
+		dir          *dir
+		prefix       string
+	)
+	err := walkExchangeDirs(rd, exchangeDirs, func(path string, fi os.FileInfo) error {
+		if fi.Mode().IsDir() {
+			fs.mkExchangeDirAll(mu, root+strings.TrimPrefix(filepath.Join(path, fi.Name()), "/out"))
+			return nil
+		}
+		if path != lastPath {
+			lastPath = path
+			exchangePath = root + strings.TrimPrefix(path, "/out")
+			prefix = strings.Repeat("../", countSlashes(exchangePath)-1)
+			var ok bool
 			mu.Lock()
-			fs.symlink(dir, rel)
+			dir, ok = fs.dirs[exchangePath]
 			mu.Unlock()
+			if !ok {
+				panic(fmt.Sprintf("BUG: fs.dirs[%q] not found", exchangePath))
+			}
 		}
+		full := "/" + pkg + path + "/" + fi.Name()
+		rel := prefix + full[1:]
+		mu.Lock()
+		fs.symlink(exchangePath, dir, rel)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return xerrors.Errorf("%s: %v", pkg, err)
 	}
 	return nil
 }
 
 var errSkipPackage = errors.New("sentinel: skip package")
 
-func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
+// readMeta reads the meta file of pkg, which is optional in the debug section.
+func (fs *fuseFS) readMeta(pkg string) (*pb.Meta, error) {
+	meta, err := pb.ReadMetaFile(filepath.Join(fs.repo, pkg+".meta.textproto"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			if fs.repoSection != "debug" {
+				log.Print(err)
+				return nil, errSkipPackage // recover by skipping this package
+			}
+			return nil, nil
+		}
+		return nil, err
+	}
+	return meta, nil
+}
+
+func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string, meta *pb.Meta, exchangeDirs []string) error {
 	f, err := os.Open(filepath.Join(fs.repo, pkg+".squashfs"))
 	if err != nil {
 		return err
@@ -555,17 +638,6 @@ func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
 	}
 
 	// set up runtime_unions:
-	meta, err := pb.ReadMetaFile(filepath.Join(fs.repo, pkg+".meta.textproto"))
-	if err != nil {
-		if os.IsNotExist(err) {
-			if fs.repoSection != "debug" {
-				log.Print(err)
-				return errSkipPackage // recover by skipping this package
-			}
-		} else {
-			return err
-		}
-	}
 	for _, o := range meta.GetRuntimeUnion() {
 		// log.Printf("%s: runtime union: %v", pkg, o)
 		image := -1
@@ -591,10 +663,7 @@ func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
 			return err
 		}
 
-		err = fs.mountImage(image)
-		mu.Lock()
-		rd := fs.readers[image]
-		mu.Unlock()
+		rd, err := fs.mountImage(image)
 		if err != nil {
 			return err
 		}
@@ -616,28 +685,141 @@ func (fs *fuseFS) scanPackage(mu sync.Locker, idx int, pkg string) error {
 		delete(rd.dircache, srcinode) // invalidate dircache
 	}
 
-	if err := fs.scanPackagesSymlink(mu, rd, pkg, ExchangeDirs); err != nil {
+	if err := fs.scanPackagesSymlink(mu, rd, pkg, "", exchangeDirs); err != nil {
 		return err
 	}
 
+	if err := fs.scanViews(mu, rd, pkg, exchangeDirs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addExchangeDirs adds dirs (within package images, e.g. /out/lib) to the
+// exchange directories, unless filtered by the -overlays flag, and returns the
+// directories which were added. addExchangeDirs must be called with fs.mu held.
+func (fs *fuseFS) addExchangeDirs(dirs []string) []string {
+	present := make(map[string]bool, len(fs.exchangeDirs))
+	for _, dir := range fs.exchangeDirs {
+		present[dir] = true
+	}
+	var added []string
+	for _, dir := range dirs {
+		if present[dir] || (fs.overlays != nil && !fs.overlays[dir]) {
+			continue
+		}
+		present[dir] = true
+		fs.exchangeDirs = append(fs.exchangeDirs, dir)
+		fs.mkExchangeDirAll(&nopLocker{}, strings.TrimPrefix(dir, "/out"))
+		for _, v := range fs.views {
+			fs.mkExchangeDirAll(&nopLocker{}, v.root()+strings.TrimPrefix(dir, "/out"))
+		}
+		added = append(added, dir)
+	}
+	return added
+}
+
+// scanExchangeDirs adds the exchange directory symlinks within dirs for the
+// packages in pkgs, e.g. after a package declared additional exchange
+// directories. Packages whose image is not available locally are skipped.
+func (fs *fuseFS) scanExchangeDirs(mu sync.Locker, pkgs []string, dirs []string) error {
+	for _, pkg := range pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
+		f, err := os.Open(filepath.Join(fs.repo, pkg+".squashfs"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		rd, err := squashfs.NewReader(f)
+		if err == nil {
+			err = fs.scanPackagesSymlink(mu, rd, pkg, "", dirs)
+		}
+		if err == nil {
+			err = fs.scanViews(mu, rd, pkg, dirs)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// loader is the path of the ELF interpreter within glibc package images.
+const loader = "/out/lib/ld-linux-x86-64.so.2"
+
+// linkLoader provides /lib/ld-linux-x86-64.so.2, which is used as the .interp
+// of our ELF binaries, even if the /out/lib exchange dir was not requested. Like
+// for any other exchange directory entry, fs.policy decides which glibc package
+// provides the symlink (typically the most recent one). linkLoader must be
+// called with fs.mu held.
+func (fs *fuseFS) linkLoader() {
+	for _, dir := range fs.exchangeDirs {
+		if dir == "/out/lib" {
+			return // provided by scanPackagesSymlink
+		}
+	}
+	for _, pkg := range fs.pkgs {
+		pv := distri.ParseVersion(pkg)
+		if pv.Pkg != "glibc" || pv.Arch != "amd64" {
+			continue
+		}
+		fs.mkExchangeDirAll(&nopLocker{}, "/lib")
+		fs.symlink("/lib", fs.dirs["/lib"], "../"+pkg+loader)
+	}
+}
+
 func (fs *fuseFS) scanPackages(mu sync.Locker, pkgs []string) error {
 	start := time.Now()
 	defer func() {
 		log.Printf("scanPackages in %v", time.Since(start))
 	}()
-	// TODO: iterate over packages once, calling mkdir for all exchange dirs
-	for _, dir := range ExchangeDirs {
-		fs.mkExchangeDirAll(mu, strings.TrimPrefix(dir, "/out"))
-	}
-
 	existing := make(map[string]bool)
 	for _, pkg := range fs.pkgs {
+		if pkg == "" {
+			continue // tombstone
+		}
 		existing[pkg] = true
 	}
 
+	// Read the meta files of new packages first: exchange directories declared
+	// by a package need to be scanned in all packages.
+	metas := make(map[string]*pb.Meta)
+	var declared []string
+	for _, pkg := range pkgs {
+		if existing[pkg] {
+			continue
+		}
+		meta, err := fs.readMeta(pkg)
+		if err != nil {
+			if err != errSkipPackage {
+				log.Println(err)
+			}
+			continue
+		}
+		metas[pkg] = meta
+		for _, dir := range meta.GetExchangeDir() {
+			cleaned, err := env.CleanExchangeDir(dir)
+			if err != nil {
+				log.Printf("%s: %v", pkg, err)
+				continue
+			}
+			declared = append(declared, cleaned)
+		}
+	}
+	if added := fs.addExchangeDirs(declared); len(added) > 0 {
+		log.Printf("scanning packages for exchange dirs %q", added)
+		if err := fs.scanExchangeDirs(mu, fs.pkgs, added); err != nil {
+			return err
+		}
+	}
+	exchangeDirs := append([]string(nil), fs.exchangeDirs...)
+
 	{
 		mu := mu // shadow, possibly overwrite:
 		if _, ok := mu.(*nopLocker); ok {
@@ -650,9 +832,13 @@ func (fs *fuseFS) scanPackages(mu sync.Locker, pkgs []string) error {
 				delete(existing, pkg) // left-overs are deleted packages
 				continue
 			}
+			meta, ok := metas[pkg]
+			if !ok {
+				continue // skipped
+			}
 			idx, pkg := idx, pkg // copy
 			eg.Go(func() error {
-				if err := fs.scanPackage(mu, idx, pkg); err != nil {
+				if err := fs.scanPackage(mu, idx, pkg, meta, exchangeDirs); err != nil {
 					if err == errSkipPackage {
 						return nil
 					}
@@ -664,6 +850,7 @@ func (fs *fuseFS) scanPackages(mu sync.Locker, pkgs []string) error {
 				}
 				mu.Lock()
 				fs.pkgs = append(fs.pkgs, pkg)
+				fs.stale("/", pkg)
 				mu.Unlock()
 				return nil
 			})
@@ -673,82 +860,95 @@ func (fs *fuseFS) scanPackages(mu sync.Locker, pkgs []string) error {
 		}
 	}
 
-	if leftover := existing; len(leftover) > 0 {
-		// iterate through all symlinks, checking if they begin with /ro/<pkg>,
-		// and <pkg> matching any of the still-present ones
-		scan := make(map[string]bool)
-		for path, dir := range fs.dirs {
-			for idx, dirent := range dir.entries {
-				if dirent == nil {
-					continue // tombstone
-				}
-				if dirent.linkTarget == "" {
-					continue // subdirectory
-				}
-				// e.g. /lib/pkgconfig/bash.pc → ../../bash-amd64-1/out/lib/pkgconfig/bash.pc
-				target := filepath.Clean(filepath.Join(filepath.Dir(path), dirent.linkTarget))
-				// target is now /bash-amd64-1/out/lib/pkgconfig/bash.pc
-				pkg := target[1 : 1+strings.IndexByte(target[1:], '/')]
-				if leftover[pkg] {
-					scan[path] = true
-
-					// delete, in case there is no stand-in (or the stand-in
-					// does not contain the file)
-					delete(dir.byName, dirent.name)
-					dir.entries[idx] = nil // tombstone
-				}
+	mu.Lock()
+	fs.removePackages(existing) // left-overs
+	mu.Unlock()
+
+	fs.growReaders(len(fs.pkgs))
+
+	mu.Lock()
+	fs.linkLoader()
+	mu.Unlock()
+
+	return nil
+}
+
+// removePackages removes the packages in leftover (full package names) from
+// the file system: their images are closed and their inodes become invalid.
+// Their exchange directory symlinks are removed, or replaced with those of the
+// remaining packages providing the same symlinks. removePackages must be
+// called with fs.mu held.
+func (fs *fuseFS) removePackages(leftover map[string]bool) {
+	removed := make(map[int]bool)
+	for idx, pkg := range fs.pkgs {
+		if !leftover[pkg] {
+			continue
+		}
+		log.Printf("removing package %s", pkg)
+		fs.pkgs[idx] = "" // tombstone
+		fs.stale("/", pkg)
+		if rd := fs.readers[idx]; rd != nil {
+			// Closing the image releases its disk space if it was deleted.
+			if err := rd.file.Close(); err != nil {
+				log.Printf("closing %s: %v", pkg, err)
 			}
+			fs.readers[idx] = nil
 		}
-		affectedExchangeDirs := make([]string, 0, len(scan))
-		for path := range scan {
-			affectedExchangeDirs = append(affectedExchangeDirs, path)
+		removed[idx] = true
+	}
+	if len(removed) == 0 {
+		return
+	}
+	fs.fileReadersMu.Lock()
+	for i := range fs.fileReaders {
+		if removed[inodeImage(i)] {
+			delete(fs.fileReaders, i)
 		}
-		for deleted := range existing {
-			var standin string
-			for arch := range distri.Architectures {
-				archmiddle := "-" + arch + "-"
-				if !strings.Contains(deleted, archmiddle) {
-					continue
-				}
-				source := deleted[:strings.Index(deleted, archmiddle)+len(archmiddle)]
-				matches, err := filepath.Glob(filepath.Join(fs.repo, source+"*.squashfs"))
-				if err != nil {
-					return err
-				}
-				if len(matches) == 0 {
-					continue
-				}
-				for idx, m := range matches {
-					matches[idx] = strings.TrimSuffix(filepath.Base(m), ".squashfs")
-				}
-				sort.Slice(matches, func(i, j int) bool {
-					return distri.PackageRevisionLess(matches[j], matches[i]) // reverse
-				})
-				standin = matches[0]
-				break
+	}
+	fs.fileReadersMu.Unlock()
+	for src, dsts := range fs.unions {
+		if removed[inodeImage(src)] {
+			delete(fs.unions, src)
+			continue
+		}
+		filtered := dsts[:0]
+		for _, dst := range dsts {
+			if !removed[inodeImage(dst)] {
+				filtered = append(filtered, dst)
 			}
-			if standin == "" {
-				continue
+		}
+		fs.unions[src] = filtered
+	}
+
+	// Remove all symlinks to the removed packages. Where other packages
+	// provide the same symlink, the one preferred by fs.policy takes over.
+	for path, dir := range fs.dirs {
+		for idx, dirent := range dir.entries {
+			if dirent == nil {
+				continue // tombstone
 			}
-			f, err := os.Open(filepath.Join(fs.repo, standin+".squashfs"))
-			if err != nil {
-				return err
+			if dirent.linkTarget == "" {
+				continue // subdirectory
 			}
-			defer f.Close()
-			rd, err := squashfs.NewReader(f)
-			if err != nil {
-				return err
+			var alternatives []string
+			for _, alt := range dirent.alternatives {
+				if !leftover[targetPackage(alt)] {
+					alternatives = append(alternatives, alt)
+				}
 			}
-
-			if err := fs.scanPackagesSymlink(mu, rd, standin, affectedExchangeDirs); err != nil {
-				return err
+			dirent.alternatives = alternatives
+			if !leftover[targetPackage(dirent.linkTarget)] {
+				continue
+			}
+			delete(dir.byName, dirent.name)
+			delete(fs.inodes, dirent.inode)
+			dir.entries[idx] = nil // tombstone
+			fs.stale(path, dirent.name)
+			for _, alt := range alternatives {
+				fs.symlink(path, dir, alt)
 			}
 		}
 	}
-
-	fs.growReaders(len(fs.pkgs))
-
-	return nil
 }
 
 type nopLocker struct{}
@@ -757,36 +957,28 @@ func (*nopLocker) Lock()   {}
 func (*nopLocker) Unlock() {}
 
 func (fs *fuseFS) updatePackages() error {
-	// TODO: make this code work with multiple repos
-	resp, err := http.Get(fs.remoteRepos[0].Path + "/" + fs.repoSection + "/meta.binaryproto")
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if got, want := resp.StatusCode, http.StatusOK; got != want {
-		return xerrors.Errorf("HTTP status %v", resp.Status)
-	}
-	b, err := ioutil.ReadAll(resp.Body)
+	metas, err := fetchMirrorMetas(context.Background(), fs.remoteRepos, fs.repoSection)
 	if err != nil {
-		return xerrors.Errorf("reading meta.binaryproto: %v", err)
-	}
-	var mm pb.MirrorMeta
-	if err := proto.Unmarshal(b, &mm); err != nil {
 		return err
 	}
-	log.Printf("%d remote packages", len(mm.GetPackage()))
+	remotePkgs := mergeMirrorMetas(fs.remoteRepos, metas)
+	log.Printf("%d remote packages", len(remotePkgs))
 
 	existing := make(map[string]bool)
+	defer fs.invalidate() // after fs.mu.Unlock()
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 	for _, pkg := range fs.pkgs {
 		existing[pkg] = true
 	}
-	for _, pkg := range mm.GetPackage() {
+	for _, rp := range remotePkgs {
+		pkg := rp.meta
+		fs.remotePkgs[pkg.GetName()] = rp
 		if existing[pkg.GetName()] {
 			continue
 		}
 		fs.pkgs = append(fs.pkgs, pkg.GetName())
+		fs.stale("/", pkg.GetName())
 		for _, p := range pkg.GetWellKnownPath() {
 			exchangePath := "/" + strings.TrimPrefix(filepath.Dir(p), "out/")
 			fs.mkExchangeDirAll(&nopLocker{}, exchangePath)
@@ -798,72 +990,134 @@ func (fs *fuseFS) updatePackages() error {
 			if err != nil {
 				return err
 			}
-			fs.symlink(dir, rel)
+			fs.symlink(exchangePath, dir, rel)
 		}
 	}
 
 	fs.growReaders(len(fs.pkgs))
+	fs.linkLoader()
 
 	return nil
 }
 
-func (fs *fuseFS) mountImage(image int) error {
+// mountImage opens the image with the specified index (unless already open)
+// and returns its reader. The reader must be used instead of calling fs.reader
+// again, which returns nil once the package is removed.
+func (fs *fuseFS) mountImage(image int) (*squashfsReader, error) {
 	//log.Printf("mountImage(%d)", image)
-	if fs.reader(image) != nil {
-		return nil // already mounted
+	if rd := fs.reader(image); rd != nil {
+		return rd, nil // already mounted
 	}
 
 	fs.mu.Lock()
 	pkg := fs.pkgs[image]
 	fs.mu.Unlock()
+	if pkg == "" {
+		return nil, fuse.ENOENT // package was removed
+	}
 	log.Printf("mounting %s", pkg)
 
-	// var err error
-	// f := &httpReaderAt{fileurl: "http://localhost:7080/" + pkg + ".squashfs"}
+	var f interface {
+		io.ReaderAt
+		io.Closer
+	}
 	f, err := os.Open(filepath.Join(fs.repo, pkg+".squashfs"))
+	var sf *streamFile
 	if err != nil {
 		if !os.IsNotExist(err) {
-			return err
+			return nil, err
 		}
 		if !fs.autoDownload {
-			return err
+			return nil, err
+		}
+		remotes := fs.remoteRepos
+		fs.mu.Lock()
+		if rp, ok := fs.remotePkgs[pkg]; ok {
+			remotes = rp.repos
+		}
+		fs.mu.Unlock()
+		if fs.streamCache != nil {
+			sf, err = openStream(fs.streamCache, remotes, fs.repoSection, pkg+".squashfs")
+			f = sf
+		} else {
+			f, err = autodownload(fs.repo, remotes, fs.repoSection, pkg+".squashfs")
 		}
-		f, err = autodownload(fs.repo, fs.remoteRepos[0].Path, fs.repoSection+"/"+pkg+".squashfs")
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	rd, err := squashfs.NewReader(f)
 	if err != nil {
-		return err
+		f.Close()
+		return nil, err
+	}
+	if sf != nil {
+		// Directory lookups and stat calls only touch the metadata, so fetch
+		// it in the background before it is needed.
+		go sf.prefetch(rd.MetadataRange())
 	}
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if fs.pkgs[image] == "" {
+		// The package was removed while opening its image.
+		f.Close()
+		return nil, fuse.ENOENT
+	}
+	if existing := fs.readers[image]; existing != nil {
+		// A concurrent request mounted the image first.
+		f.Close()
+		return existing, nil
+	}
 	fs.readers[image] = &squashfsReader{
 		file:     f,
 		Reader:   rd,
 		dircache: make(map[squashfs.Inode]map[string]fuseops.ChildInodeEntry),
 	}
-	return nil
+	return fs.readers[image], nil
 }
 
-func (fs *fuseFS) squashfsInode(i fuseops.InodeID) (int, squashfs.Inode, error) {
+// inodeImage returns the image index of FUSE inode i, see squashfsInode.
+func inodeImage(i fuseops.InodeID) int { return int((i>>48)&0xFFFF) - 1 }
+
+// squashfsInode returns the image index, the reader of the image (nil for
+// virtual inodes, i.e. image -1) and the SquashFS inode of FUSE inode i. It
+// returns fuse.ENOENT for inodes of removed packages.
+func (fs *fuseFS) squashfsInode(i fuseops.InodeID) (*squashfsReader, int, squashfs.Inode, error) {
 	// encoding scheme: <imagenr(uint16)> <startblock(uint32)> <offset(uint16)>
 	// where imagenr starts at 1 (because 0 is an invalid inode in FUSE, but valid in SquashFS)
-	image := int((i>>48)&0xFFFF) - 1
+	image := inodeImage(i)
 	i &= 0xFFFFFFFFFFFF // remove imagenr
 	// We must support RootInodeID == 1: https://github.com/libfuse/libfuse/issues/267
 	if i == fuseops.RootInodeID {
 		if image == -1 {
-			return image, 1, nil
+			return nil, image, 1, nil
 		}
-		if err := fs.mountImage(image); err != nil {
-			return 0, 0, err
+		rd, err := fs.mountImage(image)
+		if err != nil {
+			return nil, 0, 0, err
 		}
-		return image, fs.reader(image).RootInode(), nil
+		return rd, image, rd.RootInode(), nil
+	}
+
+	if image == -1 {
+		return nil, image, squashfs.Inode(i), nil
+	}
+	rd := fs.reader(image)
+	if rd == nil {
+		// The kernel still references an inode of a removed package.
+		return nil, 0, 0, fuse.ENOENT
 	}
+	return rd, image, squashfs.Inode(i), nil
+}
 
-	return image, squashfs.Inode(i), nil
+// inodeError converts an error returned by squashfsInode into the error to
+// return to the kernel.
+func inodeError(err error) error {
+	if err == fuse.ENOENT {
+		return err // package was removed
+	}
+	log.Println(err)
+	return fuse.EIO
 }
 
 func (fs *fuseFS) fuseInode(image int, i squashfs.Inode) fuseops.InodeID {
@@ -901,30 +1155,26 @@ func (fs *fuseFS) StatFS(ctx context.Context, op *fuseops.StatFSOp) error {
 var never = time.Now().Add(365 * 24 * time.Hour)
 
 // VirtualFileExpiration determines how long virtual files (e.g. exchange
-// directory contents) are cached. 1s matches the default entry_timeout FUSE
-// option. Larger values (e.g. never) have no effect.
+// directory contents) are cached when the kernel cannot be notified about
+// changes. 1s matches the default entry_timeout FUSE option. Enabling caching
+// speeds up building the i3 package from 46s to 18s.
 const VirtualFileExpiration = 1 * time.Second
 
 func (fs *fuseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) error {
 	//log.Printf("LookUpInode(op=%+v)", op)
 	// find dirent op.Name in inode op.Parent
-	image, squashfsInode, err := fs.squashfsInode(op.Parent)
+	rd, image, squashfsInode, err := fs.squashfsInode(op.Parent)
 	if err != nil {
-		log.Println(err)
-		return fuse.EIO
+		return inodeError(err)
 	}
 
 	if image == -1 { // (virtual) root directory
 
-		// Cache virtual files for 1s, which is the default entry_timeout FUSE
-		// option value. Enabling caching speeds up building the i3 package from
-		// 46s to 18s. Larger values (e.g. never) have no effect.
-		op.Entry.AttributesExpiration = time.Now().Add(VirtualFileExpiration)
-		op.Entry.EntryExpiration = time.Now().Add(VirtualFileExpiration)
-
 		if squashfsInode == 1 { // root directory (e.g. /ro)
 			fs.mu.Lock()
 			defer fs.mu.Unlock()
+			op.Entry.AttributesExpiration = fs.expiration()
+			op.Entry.EntryExpiration = fs.expiration()
 			for _, dirent := range fs.dirs["/"].entries {
 				if dirent.name != op.Name {
 					continue
@@ -966,11 +1216,17 @@ func (fs *fuseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) er
 				}
 				return nil
 			}
-			// TODO: switch to returning nil once we invalidate the cache
+			if fs.notify != nil {
+				// Cache the negative entry: packages appearing later are
+				// invalidated explicitly.
+				return nil // same as ENOENT when op.Entry.Child is 0
+			}
 			return fuse.ENOENT
 		} else { // overlay directory
 			fs.mu.Lock()
 			defer fs.mu.Unlock()
+			op.Entry.AttributesExpiration = fs.expiration()
+			op.Entry.EntryExpiration = fs.expiration()
 			dir, ok := fs.inodes[op.Parent].(*dir)
 			if !ok {
 				return fuse.EIO // not a directory
@@ -997,11 +1253,13 @@ func (fs *fuseFS) LookUpInode(ctx context.Context, op *fuseops.LookUpInodeOp) er
 	op.Entry.AttributesExpiration = never
 	op.Entry.EntryExpiration = never
 
-	rd := fs.reader(image)
 	rd.dircacheMu.Lock()
 	fis, ok := rd.dircache[squashfsInode]
 	rd.dircacheMu.Unlock()
-	if !ok {
+	if ok {
+		atomic.AddUint64(&rd.dircacheHits, 1)
+	} else {
+		atomic.AddUint64(&rd.dircacheMisses, 1)
 		fis = make(map[string]fuseops.ChildInodeEntry)
 		ur := fs.newUnionReader(op.Parent)
 		for ur.Next() {
@@ -1047,10 +1305,9 @@ func (fs *fuseFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAt
 		}
 		return nil
 	}
-	image, squashfsInode, err := fs.squashfsInode(op.Inode)
+	rd, image, squashfsInode, err := fs.squashfsInode(op.Inode)
 	if err != nil {
-		log.Println(err)
-		return fuse.EIO
+		return inodeError(err)
 	}
 
 	if image == -1 {
@@ -1094,7 +1351,7 @@ func (fs *fuseFS) GetInodeAttributes(ctx context.Context, op *fuseops.GetInodeAt
 		return nil
 	}
 
-	fi, err := fs.reader(image).Stat("", squashfsInode)
+	fi, err := rd.Stat("", squashfsInode)
 	if err != nil {
 		//log.Printf("Stat: %v", err)
 		return fuse.ENOENT // TODO
@@ -1120,10 +1377,9 @@ func (fs *fuseFS) OpenDir(ctx context.Context, op *fuseops.OpenDirOp) error {
 func (fs *fuseFS) ReadDir(ctx context.Context, op *fuseops.ReadDirOp) error {
 	// TODO: if this inode is not referring to a directory, return fuse.EIO
 
-	image, squashfsInode, err := fs.squashfsInode(op.Inode)
+	_, image, squashfsInode, err := fs.squashfsInode(op.Inode)
 	if err != nil {
-		log.Println(err)
-		return fuse.EIO
+		return inodeError(err)
 	}
 
 	//log.Printf("ReadDir(inode %d (image %d, i %d), handle %d, offset %d)", op.Inode, image, squashfsInode, op.Handle, op.Offset) // skip op.Dst, which is large
@@ -1244,22 +1500,37 @@ func (fs *fuseFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
 	r, ok := fs.fileReaders[op.Inode]
 	fs.fileReadersMu.Unlock()
 	if !ok {
-		image, squashfsInode, err := fs.squashfsInode(op.Inode)
+		rd, image, squashfsInode, err := fs.squashfsInode(op.Inode)
 		if err != nil {
-			log.Println(err)
-			return fuse.EIO
+			return inodeError(err)
 		}
 
-		r, err = fs.reader(image).FileReader(squashfsInode)
+		r, err = rd.FileReader(squashfsInode)
 		if err != nil {
 			return err
 		}
-		fs.fileReadersMu.Lock()
-		fs.fileReaders[op.Inode] = r
-		fs.fileReadersMu.Unlock()
+		// Only cache r if the package was not removed in the meantime, in which
+		// case removePackages already deleted the cached readers of the image.
+		fs.mu.Lock()
+		removed := fs.readers[image] != rd
+		if !removed {
+			fs.fileReadersMu.Lock()
+			fs.fileReaders[op.Inode] = r
+			fs.fileReadersMu.Unlock()
+		}
+		fs.mu.Unlock()
+		if removed {
+			return fuse.ENOENT
+		}
 	}
 	var err error
 	op.BytesRead, err = r.ReadAt(op.Dst, op.Offset)
+	if image := inodeImage(op.Inode); image > -1 {
+		if rd := fs.reader(image); rd != nil {
+			atomic.AddUint64(&rd.reads, 1)
+			atomic.AddUint64(&rd.readBytes, uint64(op.BytesRead))
+		}
+	}
 	if err == io.EOF {
 		err = nil // FUSE does not want io.EOF
 	}
@@ -1269,10 +1540,9 @@ func (fs *fuseFS) ReadFile(ctx context.Context, op *fuseops.ReadFileOp) error {
 func (fs *fuseFS) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) error {
 	//log.Printf("ReadSymlink(inode %d)", op.Inode)
 
-	image, squashfsInode, err := fs.squashfsInode(op.Inode)
+	rd, image, squashfsInode, err := fs.squashfsInode(op.Inode)
 	if err != nil {
-		log.Println(err)
-		return fuse.EIO
+		return inodeError(err)
 	}
 
 	if image == -1 {
@@ -1290,7 +1560,7 @@ func (fs *fuseFS) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) er
 		return nil
 	}
 
-	target, err := fs.reader(image).ReadLink(squashfsInode)
+	target, err := rd.ReadLink(squashfsInode)
 	if err != nil {
 		return err
 	}
@@ -1299,16 +1569,15 @@ func (fs *fuseFS) ReadSymlink(ctx context.Context, op *fuseops.ReadSymlinkOp) er
 }
 
 func (fs *fuseFS) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) error {
-	image, squashfsInode, err := fs.squashfsInode(op.Inode)
+	rd, image, squashfsInode, err := fs.squashfsInode(op.Inode)
 	if err != nil {
-		log.Println(err)
-		return fuse.EIO
+		return inodeError(err)
 	}
 	if image == -1 {
 		return nil // no extended attributes
 	}
 
-	attrs, err := fs.reader(image).ReadXattrs(squashfsInode)
+	attrs, err := rd.ReadXattrs(squashfsInode)
 	if err != nil {
 		return err
 	}
@@ -1331,10 +1600,9 @@ func (fs *fuseFS) ListXattr(ctx context.Context, op *fuseops.ListXattrOp) error
 }
 
 func (fs *fuseFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
-	image, squashfsInode, err := fs.squashfsInode(op.Inode)
+	rd, image, squashfsInode, err := fs.squashfsInode(op.Inode)
 	if err != nil {
-		log.Println(err)
-		return fuse.EIO
+		return inodeError(err)
 	}
 	if image == -1 {
 		if len(op.Dst) > 0 {
@@ -1344,7 +1612,7 @@ func (fs *fuseFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
 		return nil // no extended attributes
 	}
 
-	attrs, err := fs.reader(image).ReadXattrs(squashfsInode)
+	attrs, err := rd.ReadXattrs(squashfsInode)
 	if err != nil {
 		return err
 	}
@@ -1371,6 +1639,12 @@ func (fs *fuseFS) GetXattr(ctx context.Context, op *fuseops.GetXattrOp) error {
 }
 
 func (fs *fuseFS) Destroy() {
+	fs.mu.Lock()
+	if dev, ok := fs.notify.(*fuseDev); ok {
+		dev.Close()
+		fs.notify = nil
+	}
+	fs.mu.Unlock()
 	for _, rd := range fs.readers {
 		if rd == nil {
 			continue
@@ -1390,6 +1664,7 @@ func (fs *fuseFS) MkdirAll(ctx context.Context, req *pb.MkdirAllRequest) (*pb.Mk
 	if strings.Contains(req.GetDir(), "/") {
 		return nil, xerrors.Errorf("MkdirAll: dir must not contain slashes")
 	}
+	defer fs.invalidate() // after fs.mu.Unlock()
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 	for _, pkg := range fs.pkgs {
@@ -1402,11 +1677,18 @@ func (fs *fuseFS) MkdirAll(ctx context.Context, req *pb.MkdirAllRequest) (*pb.Mk
 }
 
 func (fs *fuseFS) ScanPackages(ctx context.Context, req *pb.ScanPackagesRequest) (*pb.ScanPackagesReply, error) {
-	pkgs, err := fs.findPackages()
-	if err != nil {
-		return nil, err
+	return &pb.ScanPackagesReply{}, fs.rescanPackages()
+}
+
+func (fs *fuseFS) RemovePackages(ctx context.Context, req *pb.RemovePackagesRequest) (*pb.RemovePackagesReply, error) {
+	remove := make(map[string]bool, len(req.GetPackage()))
+	for _, pkg := range req.GetPackage() {
+		remove[pkg] = true
 	}
+	defer fs.invalidate() // after fs.mu.Unlock()
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
-	return &pb.ScanPackagesReply{}, fs.scanPackages(&nopLocker{}, pkgs)
+	fs.removePackages(remove)
+	fs.linkLoader()
+	return &pb.RemovePackagesReply{}, nil
 }
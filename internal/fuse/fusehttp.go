@@ -1,64 +1,31 @@
 package fuse
 
 import (
-	"fmt"
+	"context"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/repo"
 	"github.com/google/renameio"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 )
 
-// TODO: to make this performant enough, even just for starting emacs, we
-// probably need to cache relatively large blocks.
-
 var httpClient = &http.Client{Transport: &http.Transport{
 	// http.DefaultMaxIdleConnsPerHost is 2, which is not enough for concurrent
 	// requests.
 	MaxIdleConnsPerHost: 1024,
 }}
 
-type httpReaderAt struct {
-	fileurl string // e.g. http://localhost:7080/bash-4.4.18.squashfs
-}
-
-func (hr *httpReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
-	req, err := http.NewRequest("GET", hr.fileurl, nil)
-	if err != nil {
-		return 0, err
-	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))))
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-	if got, want := resp.StatusCode, http.StatusPartialContent; got != want {
-		return 0, xerrors.Errorf("HTTP status %v", resp.Status)
-	}
-	for n < int(resp.ContentLength-1) {
-		nn, err := resp.Body.Read(p[n:])
-		if err != nil {
-			return 0, err
-		}
-		n += nn
-	}
-
-	io.Copy(ioutil.Discard, resp.Body) // ensure resp.Body hits EOF
-
-	log.Printf("[%s] %d-%d (len %d), read %d (content-length %d)", filepath.Base(hr.fileurl), off, off+int64(len(p)), len(p), n, resp.ContentLength)
-	return n, err
-}
-
-func autodownload(imgDir, remote, rel string) (*os.File, error) {
-	fileurl := remote + "/" + rel
-	dest := filepath.Join(imgDir, filepath.Base(fileurl))
+// autodownload downloads fn from section of the first of remotes which
+// successfully serves it, and returns the downloaded file (stored in imgDir).
+func autodownload(imgDir string, remotes []distri.Repo, section, fn string) (*os.File, error) {
+	dest := filepath.Join(imgDir, filepath.Base(fn))
 
 	// If the file can be opened, it was successfully downloaded already. As
 	// files never change (only new files are added), no update check is needed.
@@ -66,6 +33,21 @@ func autodownload(imgDir, remote, rel string) (*os.File, error) {
 		return f, nil
 	}
 
+	if len(remotes) == 0 {
+		return nil, xerrors.Errorf("%s: no remote repositories configured", fn)
+	}
+	var err error
+	for _, remote := range remotes {
+		if err = download(dest, remote, section, fn); err == nil {
+			return os.Open(dest)
+		}
+		log.Printf("downloading %s from %s: %v", fn, remote.Section(section), err)
+	}
+	return nil, err // from the last remote
+}
+
+func download(dest string, remote distri.Repo, section, fn string) error {
+	fileurl := remote.Section(section) + "/" + fn
 	var (
 		eg       errgroup.Group
 		base     = strings.TrimSuffix(dest, ".squashfs")
@@ -73,20 +55,23 @@ func autodownload(imgDir, remote, rel string) (*os.File, error) {
 		files    = make(map[string]*renameio.PendingFile)
 		suffixes = []string{".squashfs"}
 	)
-	if !strings.HasPrefix(rel, "debug/") &&
-		!strings.HasPrefix(rel, "src/") {
+	if section == "pkg" {
 		suffixes = append(suffixes, ".meta.textproto")
 	}
 	for _, suffix := range suffixes {
 		suffix := suffix // copy
 		f, err := renameio.TempFile("", base+suffix)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		defer f.Cleanup()
 		files[suffix] = f
 		eg.Go(func() error {
-			resp, err := http.Get(baseurl + suffix)
+			req, err := repo.NewRequest(context.Background(), remote, "GET", baseurl+suffix)
+			if err != nil {
+				return err
+			}
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				return err
 			}
@@ -99,13 +84,14 @@ func autodownload(imgDir, remote, rel string) (*os.File, error) {
 		})
 	}
 	if err := eg.Wait(); err != nil {
-		return nil, err
+		return err
 	}
-	for _, suffix := range suffixes {
-		if err := files[suffix].CloseAtomicallyReplace(); err != nil {
-			return nil, err
+	// Install the image last: its presence marks the download as complete, see
+	// autodownload.
+	for i := len(suffixes) - 1; i >= 0; i-- {
+		if err := files[suffixes[i]].CloseAtomicallyReplace(); err != nil {
+			return err
 		}
 	}
-
-	return os.Open(dest)
+	return nil
 }
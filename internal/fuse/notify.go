@@ -0,0 +1,228 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jacobsa/fuse/fuseops"
+	"golang.org/x/xerrors"
+)
+
+// FUSE notification codes, see include/uapi/linux/fuse.h
+const (
+	notifyInvalInode = 2
+	notifyInvalEntry = 3
+)
+
+// fuseDev writes notifications to a /dev/fuse file descriptor. Each Write must
+// contain exactly one notification.
+type fuseDev struct {
+	// mu guards fd, so that Close does not close (and the process re-use) the
+	// file descriptor while fs.invalidate is writing to it outside of fs.mu.
+	mu sync.Mutex
+	fd int // -1 once closed
+}
+
+func (d *fuseDev) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fd == -1 {
+		return 0, syscall.EBADF
+	}
+	// Avoid the retry loop in os.File.Write, like github.com/jacobsa/fuse.
+	return syscall.Write(d.fd, b)
+}
+
+func (d *fuseDev) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fd == -1 {
+		return nil
+	}
+	err := syscall.Close(d.fd)
+	d.fd = -1
+	return err
+}
+
+// devFUSEFDs returns the file descriptors of this process which refer to
+// /dev/fuse.
+func devFUSEFDs() (map[int]bool, error) {
+	fis, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil, err
+	}
+	fds := make(map[int]bool)
+	for _, fi := range fis {
+		fd, err := strconv.Atoi(fi.Name())
+		if err != nil {
+			continue
+		}
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fi.Name())); err == nil && target == "/dev/fuse" {
+			fds[fd] = true
+		}
+	}
+	return fds, nil
+}
+
+// openFUSEDev returns a fuseDev for the FUSE connection which was established
+// after devFUSEFDs returned before, i.e. by the fuse.Mount call in between.
+// github.com/jacobsa/fuse does not expose its connection’s file descriptor, so
+// we duplicate it to send notifications ourselves.
+func openFUSEDev(before map[int]bool) (*fuseDev, error) {
+	after, err := devFUSEFDs()
+	if err != nil {
+		return nil, err
+	}
+	var added []int
+	for fd := range after {
+		if !before[fd] {
+			added = append(added, fd)
+		}
+	}
+	if len(added) != 1 {
+		return nil, xerrors.Errorf("cannot identify /dev/fuse file descriptor: %d candidates", len(added))
+	}
+	fd, err := syscall.Dup(added[0])
+	if err != nil {
+		return nil, err
+	}
+	syscall.CloseOnExec(fd)
+	return &fuseDev{fd: fd}, nil
+}
+
+// notify writes a notification message with the specified code and payload.
+func notify(w io.Writer, code int32, payload ...interface{}) error {
+	var buf bytes.Buffer
+	// Placeholder header (struct fuse_out_header), filled in below. distri
+	// only runs on little endian architectures, so we can spell out the byte
+	// order of the kernel’s native encoding.
+	buf.Write(make([]byte, 16))
+	for _, p := range payload {
+		if err := binary.Write(&buf, binary.LittleEndian, p); err != nil {
+			return err
+		}
+	}
+	b := buf.Bytes()
+	binary.LittleEndian.PutUint32(b[0:], uint32(len(b))) // len
+	binary.LittleEndian.PutUint32(b[4:], uint32(code))   // error: notification code
+	// unique remains 0, which identifies notifications
+	_, err := w.Write(b)
+	return err
+}
+
+func notifyInvalidateInode(w io.Writer, inode fuseops.InodeID) error {
+	// Zero offset and length invalidate the attributes and the entire page
+	// cache (e.g. cached directory contents) of the inode.
+	return notify(w, notifyInvalInode, struct {
+		Ino uint64
+		Off int64
+		Len int64
+	}{Ino: uint64(inode)})
+}
+
+func notifyInvalidateEntry(w io.Writer, parent fuseops.InodeID, name string) error {
+	return notify(w, notifyInvalEntry, struct {
+		Parent  uint64
+		Namelen uint32
+		Padding uint32
+	}{
+		Parent:  uint64(parent),
+		Namelen: uint32(len(name)),
+	}, []byte(name+"\x00"))
+}
+
+// staleEntry is a directory entry which was added, removed or replaced since
+// the kernel might have looked it up.
+type staleEntry struct {
+	dir  string // e.g. /bin
+	name string // e.g. hello
+}
+
+// stale records that the entry name in the directory path (e.g. /bin) changed,
+// so that the next call to invalidate invalidates the kernel caches of the
+// entry and of the directory. stale must be called with fs.mu held.
+func (fs *fuseFS) stale(path, name string) {
+	if fs.notify == nil {
+		return // kernel caches expire after VirtualFileExpiration
+	}
+	fs.staleEntries = append(fs.staleEntries, staleEntry{dir: path, name: name})
+}
+
+// dirInodeLocked returns the inode of the directory path (e.g. /bin), or false
+// if the directory does not exist (anymore). dirInodeLocked must be called with
+// fs.mu held.
+func (fs *fuseFS) dirInodeLocked(path string) (fuseops.InodeID, bool) {
+	if path == "/" {
+		return fuseops.RootInodeID, true
+	}
+	parent, ok := fs.dirs[filepath.Dir(path)]
+	if !ok {
+		return 0, false
+	}
+	dirent, ok := parent.byName[filepath.Base(path)]
+	if !ok || dirent.linkTarget != "" {
+		return 0, false
+	}
+	return dirent.inode, true
+}
+
+// invalidate notifies the kernel about all entries recorded by fs.stale. The
+// kernel might need to lock directories on which a pending request is waiting
+// for fs.mu, so invalidate must be called without fs.mu held.
+func (fs *fuseFS) invalidate() {
+	type entry struct {
+		parent fuseops.InodeID
+		name   string
+	}
+	fs.mu.Lock()
+	w := fs.notify
+	var (
+		entries []entry
+		dirs    []fuseops.InodeID
+		seen    = make(map[fuseops.InodeID]bool)
+	)
+	for _, s := range fs.staleEntries {
+		inode, ok := fs.dirInodeLocked(s.dir)
+		if !ok {
+			continue // parent directory was removed and invalidated
+		}
+		entries = append(entries, entry{parent: inode, name: s.name})
+		if !seen[inode] {
+			seen[inode] = true
+			dirs = append(dirs, inode)
+		}
+	}
+	fs.staleEntries = nil
+	fs.mu.Unlock()
+
+	for _, e := range entries {
+		if err := notifyInvalidateEntry(w, e.parent, e.name); err != nil && !xerrors.Is(err, syscall.ENOENT) {
+			// ENOENT means the kernel has not cached the entry.
+			log.Printf("invalidating entry %q in inode %d: %v", e.name, e.parent, err)
+		}
+	}
+	for _, inode := range dirs {
+		if err := notifyInvalidateInode(w, inode); err != nil && !xerrors.Is(err, syscall.ENOENT) {
+			log.Printf("invalidating inode %d: %v", inode, err)
+		}
+	}
+}
+
+// expiration returns when kernel caches for virtual files (e.g. exchange
+// directories) expire. expiration must be called with fs.mu held.
+func (fs *fuseFS) expiration() time.Time {
+	if fs.notify != nil {
+		// Changes are invalidated explicitly, see fs.invalidate.
+		return never
+	}
+	return time.Now().Add(VirtualFileExpiration)
+}
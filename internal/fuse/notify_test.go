@@ -0,0 +1,130 @@
+package fuse
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/distr1/distri/pb"
+	"github.com/jacobsa/fuse/fuseops"
+	"golang.org/x/xerrors"
+)
+
+// notifications records notifications written to a FUSE device.
+type notifications struct {
+	entries []string // e.g. /bin/hello
+	inodes  []fuseops.InodeID
+	names   map[fuseops.InodeID]string
+}
+
+func (n *notifications) Write(b []byte) (int, error) {
+	if got, want := binary.LittleEndian.Uint32(b[0:]), uint32(len(b)); got != want {
+		panic("notification length mismatch")
+	}
+	switch int32(binary.LittleEndian.Uint32(b[4:])) {
+	case notifyInvalInode:
+		n.inodes = append(n.inodes, fuseops.InodeID(binary.LittleEndian.Uint64(b[16:])))
+	case notifyInvalEntry:
+		parent := fuseops.InodeID(binary.LittleEndian.Uint64(b[16:]))
+		namelen := binary.LittleEndian.Uint32(b[24:])
+		name := string(b[32 : 32+namelen])
+		n.entries = append(n.entries, strings.TrimSuffix(n.names[parent], "/")+"/"+name)
+	}
+	return len(b), nil
+}
+
+func TestInvalidate(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	writePackage(t, repo, "hello-amd64-1", "bin/hello")
+
+	fs := newTestFS(repo)
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	n := &notifications{names: make(map[fuseops.InodeID]string)}
+	fs.mu.Lock()
+	fs.notify = n
+	for path := range fs.dirs {
+		if inode, ok := fs.dirInodeLocked(path); ok {
+			n.names[inode] = path
+		}
+	}
+	fs.mu.Unlock()
+
+	contains := func(paths []string, path string) bool {
+		for _, p := range paths {
+			if p == path {
+				return true
+			}
+		}
+		return false
+	}
+
+	writePackage(t, repo, "hello-amd64-2", "bin/hello")
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/hello-amd64-2", "/bin/hello"} {
+		if !contains(n.entries, want) {
+			t.Errorf("entry %s not invalidated after rescan (invalidated: %v)", want, n.entries)
+		}
+	}
+	if len(n.inodes) == 0 {
+		t.Errorf("no directory invalidated after rescan")
+	}
+
+	*n = notifications{names: n.names}
+	if _, err := fs.RemovePackages(context.Background(), &pb.RemovePackagesRequest{
+		Package: []string{"hello-amd64-2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"/hello-amd64-2", "/bin/hello"} {
+		if !contains(n.entries, want) {
+			t.Errorf("entry %s not invalidated after removal (invalidated: %v)", want, n.entries)
+		}
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if got := fs.staleEntries; len(got) > 0 {
+		t.Errorf("stale entries remain after invalidation: %v", got)
+	}
+}
+
+func TestFUSEDevClose(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := &fuseDev{fd: fd}
+	if _, err := dev.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// After Close, writes must fail instead of using a (possibly re-used) file
+	// descriptor:
+	if _, err := dev.Write([]byte("x")); !xerrors.Is(err, syscall.EBADF) {
+		t.Errorf("Write after Close = %v, want %v", err, syscall.EBADF)
+	}
+	if err := dev.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+}
@@ -0,0 +1,113 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/repo"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+)
+
+// remotePackage is a package which can be downloaded from remote repositories.
+type remotePackage struct {
+	meta  *pb.MirrorMeta_Package
+	repos []distri.Repo // in order of preference
+}
+
+// sectionRepo returns a copy of r whose PkgPath refers to section of r, so that
+// repo.Reader reads files from section.
+func sectionRepo(r distri.Repo, section string) distri.Repo {
+	r.PkgPath = r.Section(section)
+	return r
+}
+
+// fetchMirrorMetas concurrently fetches the package list of section from all
+// remotes. metas[i] belongs to remotes[i] and is nil if remotes[i] could not be
+// reached. An error is only returned if no remote could be reached.
+func fetchMirrorMetas(ctx context.Context, remotes []distri.Repo, section string) ([]*pb.MirrorMeta, error) {
+	var (
+		wg      sync.WaitGroup
+		metas   = make([]*pb.MirrorMeta, len(remotes))
+		errs    = make([]error, len(remotes))
+		fetched = func(r distri.Repo) (*pb.MirrorMeta, error) {
+			rd, err := repo.Reader(ctx, sectionRepo(r, section), "meta.binaryproto", false)
+			if err != nil {
+				return nil, err
+			}
+			defer rd.Close()
+			b, err := ioutil.ReadAll(rd)
+			if err != nil {
+				return nil, xerrors.Errorf("reading meta.binaryproto: %v", err)
+			}
+			var mm pb.MirrorMeta
+			if err := proto.Unmarshal(b, &mm); err != nil {
+				return nil, err
+			}
+			return &mm, nil
+		}
+	)
+	for i, r := range remotes {
+		wg.Add(1)
+		go func(i int, r distri.Repo) {
+			defer wg.Done()
+			metas[i], errs[i] = fetched(r)
+		}(i, r)
+	}
+	wg.Wait()
+	var reachable int
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("%s: %v", remotes[i].Section(section), err)
+			continue
+		}
+		reachable++
+	}
+	if reachable == 0 && len(remotes) > 0 {
+		return nil, xerrors.Errorf("no remote repository reachable: %w", errs[0])
+	}
+	return metas, nil
+}
+
+// mergeMirrorMetas merges the package lists of remotes (ordered by descending
+// priority, see env.Repos). metas[i] belongs to remotes[i] and may be nil.
+//
+// Like distri install, a package (e.g. less-amd64) is only taken from the
+// repositories with the highest priority which offer it. Packages offered by
+// multiple repositories (e.g. mirrors) can be downloaded from any of them.
+func mergeMirrorMetas(remotes []distri.Repo, metas []*pb.MirrorMeta) []*remotePackage {
+	var (
+		merged   []*remotePackage
+		byName   = make(map[string]*remotePackage)
+		priority = make(map[string]int) // by package name and architecture
+	)
+	for i, mm := range metas {
+		if mm == nil {
+			continue
+		}
+		r := remotes[i]
+		for _, pkg := range mm.GetPackage() {
+			if rp, ok := byName[pkg.GetName()]; ok {
+				rp.repos = append(rp.repos, r)
+				continue
+			}
+			pv := distri.ParseVersion(pkg.GetName())
+			key := pv.Pkg + "-" + pv.Arch
+			if prio, ok := priority[key]; ok && prio > r.Priority {
+				continue // shadowed by a repository with higher priority
+			}
+			priority[key] = r.Priority
+			rp := &remotePackage{
+				meta:  pkg,
+				repos: []distri.Repo{r},
+			}
+			byName[pkg.GetName()] = rp
+			merged = append(merged, rp)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,95 @@
+package fuse
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func mirrorMeta(names ...string) *pb.MirrorMeta {
+	mm := &pb.MirrorMeta{}
+	for _, name := range names {
+		mm.Package = append(mm.Package, &pb.MirrorMeta_Package{Name: proto.String(name)})
+	}
+	return mm
+}
+
+func TestMergeMirrorMetas(t *testing.T) {
+	var (
+		team     = distri.Repo{Path: "https://distri.example.net", Priority: 10}
+		upstream = distri.Repo{Path: "https://repo.distr1.org/distri/jackherer"}
+		mirror   = distri.Repo{Path: "https://mirror.example.org/distri/jackherer"}
+		offline  = distri.Repo{Path: "https://offline.example.org/distri/jackherer"}
+	)
+	remotes := []distri.Repo{team, upstream, offline, mirror}
+	metas := []*pb.MirrorMeta{
+		mirrorMeta("less-amd64-530-2"),
+		mirrorMeta("less-amd64-530-3", "bash-amd64-5.0-4"),
+		nil, // offline
+		mirrorMeta("bash-amd64-5.0-4", "zsh-amd64-5.8-1"),
+	}
+	got := make(map[string][]string)
+	for _, rp := range mergeMirrorMetas(remotes, metas) {
+		for _, r := range rp.repos {
+			got[rp.meta.GetName()] = append(got[rp.meta.GetName()], r.Path)
+		}
+	}
+	want := map[string][]string{
+		// less-amd64-530-3 is shadowed by the team repository:
+		"less-amd64-530-2": {team.Path},
+		"bash-amd64-5.0-4": {upstream.Path, mirror.Path},
+		"zsh-amd64-5.8-1":  {mirror.Path},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("mergeMirrorMetas: unexpected result: diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestAutodownloadFallback(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "mirror out of sync", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("Authorization"), "Bearer secret"; got != want {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer working.Close()
+
+	imgDir, err := ioutil.TempDir("", "distrifuse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(imgDir)
+
+	remotes := []distri.Repo{
+		{Path: broken.URL},
+		{Path: working.URL, AuthToken: "secret"},
+	}
+	f, err := autodownload(imgDir, remotes, "debug", "less-amd64-530-3.squashfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "/debug/less-amd64-530-3.squashfs"; got != want {
+		t.Errorf("downloaded contents: got %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(imgDir, "less-amd64-530-3.meta.textproto")); !os.IsNotExist(err) {
+		t.Errorf("meta file unexpectedly downloaded for the debug section (stat: %v)", err)
+	}
+}
@@ -0,0 +1,509 @@
+package fuse
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/repo"
+	"github.com/google/renameio"
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// streamBlockSize is the granularity in which remote images are requested and
+// cached. It is a multiple of the default SquashFS block size.
+const streamBlockSize = 256 * 1024
+
+// streamCache is a size-bounded cache of remote image blocks, shared by all
+// streamed images of a file system. The least recently used blocks are evicted
+// once the budget is exceeded, regardless of whether their image is opened.
+type streamCache struct {
+	dir    string // e.g. /rodebug/.stream
+	budget int64  // in bytes
+
+	// mu protects the following fields. It is held while evicting blocks so
+	// that images cannot be opened or closed concurrently.
+	mu    sync.Mutex
+	used  int64
+	lru   *list.List // of cachedBlock, front is most recently used
+	elems map[blockRef]*list.Element
+	open  map[string]*streamFile // by file name, e.g. less-amd64-530-3.squashfs
+}
+
+type blockRef struct {
+	fn  string // e.g. less-amd64-530-3.squashfs
+	idx int64
+}
+
+type cachedBlock struct {
+	blockRef
+	len int64
+}
+
+// newStreamCache returns the cache stored in dir, accounting for all blocks
+// which are already on disk (e.g. cached before a restart) and evicting blocks
+// if they exceed the budget.
+func newStreamCache(dir string, budget int64) (*streamCache, error) {
+	c := &streamCache{
+		dir:    dir,
+		budget: budget,
+		lru:    list.New(),
+		elems:  make(map[blockRef]*list.Element),
+		open:   make(map[string]*streamFile),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Blocks of the most recently modified images are least likely to be
+	// evicted:
+	sort.Slice(fis, func(i, j int) bool { return fis[i].ModTime().After(fis[j].ModTime()) })
+	valid := make(map[string]bool)
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), ".bitmap") {
+			continue
+		}
+		fn := strings.TrimSuffix(fi.Name(), ".bitmap")
+		if err := c.load(fn); err != nil {
+			log.Printf("discarding cached blocks of %s: %v", fn, err)
+			continue
+		}
+		valid[fn] = true
+		valid[fi.Name()] = true
+	}
+	// Remove files which are not (or no longer) accounted for, e.g. images
+	// whose first block was never stored, or temporary files.
+	for _, fi := range fis {
+		if valid[fi.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			return nil, err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictOverBudget()
+	return c, nil
+}
+
+// load accounts for the cached blocks of image fn.
+func (c *streamCache) load(fn string) error {
+	local := filepath.Join(c.dir, fn)
+	bitmap, err := ioutil.ReadFile(local + ".bitmap")
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	size := st.Size()
+	if got, want := int64(len(bitmap)), bitmapLen(size); got != want {
+		return xerrors.Errorf("bitmap length mismatch: got %d, want %d", got, want)
+	}
+	for idx := int64(0); idx < blocks(size); idx++ {
+		if bitmap[idx/8]&(1<<uint(idx%8)) == 0 {
+			continue
+		}
+		ref := blockRef{fn, idx}
+		c.elems[ref] = c.lru.PushBack(cachedBlock{ref, blockLen(size, idx)})
+		c.used += blockLen(size, idx)
+	}
+	return nil
+}
+
+// touch marks block idx of sf as most recently used, evicting other blocks if
+// the cache exceeds its budget. touch must not be called with sf.mu held.
+func (c *streamCache) touch(sf *streamFile, idx int64) {
+	ref := blockRef{sf.fn, idx}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.elems[ref]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.elems[ref] = c.lru.PushFront(cachedBlock{ref, sf.blockLen(idx)})
+	c.used += sf.blockLen(idx)
+	c.evictOverBudget()
+}
+
+// evictOverBudget must be called with c.mu held.
+func (c *streamCache) evictOverBudget() {
+	for c.used > c.budget && c.lru.Len() > 1 {
+		el := c.lru.Back()
+		old := el.Value.(cachedBlock)
+		c.lru.Remove(el)
+		delete(c.elems, old.blockRef)
+		c.used -= old.len
+		var err error
+		if sf, ok := c.open[old.fn]; ok {
+			err = sf.evict(old.idx)
+		} else {
+			err = c.evictClosed(old.fn, old.idx, old.len)
+		}
+		if err != nil {
+			log.Printf("evicting block %d of %s: %v", old.idx, old.fn, err)
+		}
+	}
+}
+
+// evictClosed releases the disk space of block idx of the image fn, which is
+// not opened. evictClosed must be called with c.mu held.
+func (c *streamCache) evictClosed(fn string, idx, length int64) error {
+	local := filepath.Join(c.dir, fn)
+	bitmap, err := ioutil.ReadFile(local + ".bitmap")
+	if err != nil {
+		return err
+	}
+	if idx/8 >= int64(len(bitmap)) {
+		return xerrors.Errorf("block %d beyond bitmap length %d", idx, len(bitmap))
+	}
+	bitmap[idx/8] &^= 1 << uint(idx%8)
+	if err := renameio.WriteFile(local+".bitmap", bitmap, 0644); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(local, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return punchHole(f, idx, length)
+}
+
+// forget removes all blocks of the image fn from the cache accounting. forget
+// must be called with c.mu held.
+func (c *streamCache) forget(fn string) {
+	for ref, el := range c.elems {
+		if ref.fn != fn {
+			continue
+		}
+		c.used -= el.Value.(cachedBlock).len
+		c.lru.Remove(el)
+		delete(c.elems, ref)
+	}
+}
+
+// usage returns the disk usage of the cache in bytes.
+func (c *streamCache) usage() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used
+}
+
+func blocks(size int64) int64 {
+	return (size + streamBlockSize - 1) / streamBlockSize
+}
+
+func bitmapLen(size int64) int64 { return (blocks(size) + 7) / 8 }
+
+// blockLen returns the length of block idx of an image of the specified size,
+// which is shorter than streamBlockSize for the last block.
+func blockLen(size, idx int64) int64 {
+	if rest := size - idx*streamBlockSize; rest < streamBlockSize {
+		return rest
+	}
+	return streamBlockSize
+}
+
+func punchHole(f *os.File, idx, length int64) error {
+	return unix.Fallocate(int(f.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, idx*streamBlockSize, length)
+}
+
+// streamFile is an io.ReaderAt for a remote package image, which reads the
+// image on demand using HTTP range requests. Blocks are cached in a sparse
+// local file, and a bitmap file records which blocks are present.
+type streamFile struct {
+	// Statistics, accessed atomically. Placed first for 64-bit alignment.
+	hits, misses uint64 // blocks served from the cache, blocks fetched
+
+	cache   *streamCache
+	remotes []distri.Repo // in order of preference
+	section string        // e.g. debug
+	fn      string        // e.g. less-amd64-530-3.squashfs
+	size    int64
+
+	mu       sync.Mutex
+	f        *os.File // sparse local copy
+	present  []byte   // bitmap of cached blocks
+	inflight map[int64]chan struct{}
+}
+
+// openStream returns a streamFile for fn in section of remotes, re-using
+// blocks which were cached previously.
+func openStream(cache *streamCache, remotes []distri.Repo, section, fn string) (*streamFile, error) {
+	if len(remotes) == 0 {
+		return nil, xerrors.Errorf("%s: no remote repositories configured", fn)
+	}
+	sf := &streamFile{
+		cache:    cache,
+		remotes:  remotes,
+		section:  section,
+		fn:       fn,
+		inflight: make(map[int64]chan struct{}),
+	}
+	local := filepath.Join(cache.dir, fn)
+	if ok, err := sf.reopen(local); err != nil {
+		return nil, err
+	} else if ok {
+		return sf, nil
+	}
+
+	// Start afresh: learn the image size from the first block’s response.
+	block, size, err := sf.fetch(0, streamBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	sf.size = size
+	cache.mu.Lock()
+	// Blocks of a previous, different version of the image are discarded:
+	cache.forget(fn)
+	os.Remove(local + ".bitmap")
+	sf.f, err = os.OpenFile(local, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err == nil {
+		if err = sf.f.Truncate(size); err != nil {
+			sf.f.Close()
+		}
+	}
+	if err != nil {
+		cache.mu.Unlock()
+		return nil, err
+	}
+	cache.open[fn] = sf
+	cache.mu.Unlock()
+	sf.present = make([]byte, sf.bitmapLen())
+	if err := sf.store(0, block); err != nil {
+		sf.Close()
+		return nil, err
+	}
+	cache.touch(sf, 0)
+	return sf, nil
+}
+
+// reopen opens the local copy of a previously cached image, if any, and
+// returns whether it can be used.
+func (sf *streamFile) reopen(local string) (bool, error) {
+	sf.cache.mu.Lock()
+	defer sf.cache.mu.Unlock()
+	bitmap, err := ioutil.ReadFile(local + ".bitmap")
+	if err != nil {
+		return false, nil // not cached
+	}
+	if sf.f, err = os.OpenFile(local, os.O_RDWR, 0644); err != nil {
+		return false, nil
+	}
+	st, err := sf.f.Stat()
+	if err != nil {
+		sf.f.Close()
+		return false, err
+	}
+	sf.size = st.Size()
+	if int64(len(bitmap)) != sf.bitmapLen() {
+		sf.f.Close() // bitmap does not match: start afresh
+		return false, nil
+	}
+	sf.present = bitmap
+	sf.cache.open[sf.fn] = sf
+	return true, nil
+}
+
+func (sf *streamFile) blocks() int64 { return blocks(sf.size) }
+
+func (sf *streamFile) bitmapLen() int64 { return bitmapLen(sf.size) }
+
+// blockLen returns the length of block idx, which is shorter than
+// streamBlockSize for the last block.
+func (sf *streamFile) blockLen(idx int64) int64 { return blockLen(sf.size, idx) }
+
+// has must be called with sf.mu held.
+func (sf *streamFile) has(idx int64) bool { return sf.present[idx/8]&(1<<uint(idx%8)) != 0 }
+
+// fetch requests length bytes of the image, starting at block idx, from the
+// first remote which successfully serves them. It returns the data and the
+// total size of the image.
+func (sf *streamFile) fetch(idx, length int64) ([]byte, int64, error) {
+	var err error
+	for _, r := range sf.remotes {
+		var (
+			b    []byte
+			size int64
+		)
+		if b, size, err = fetchRange(r, r.Section(sf.section)+"/"+sf.fn, idx*streamBlockSize, length); err == nil {
+			return b, size, nil
+		}
+		log.Printf("streaming %s from %s: %v", sf.fn, r.Section(sf.section), err)
+	}
+	return nil, 0, err // from the last remote
+}
+
+// fetchRange requests bytes [off, off+length) of url (less if the file is
+// shorter) and returns them, together with the total size of the file.
+func fetchRange(r distri.Repo, url string, off, length int64) ([]byte, int64, error) {
+	req, err := repo.NewRequest(context.Background(), r, "GET", url)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+length-1))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusPartialContent; got != want {
+		return nil, 0, xerrors.Errorf("%s: HTTP status %v", url, resp.Status)
+	}
+	var start, end, size int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return nil, 0, xerrors.Errorf("%s: malformed Content-Range header %q", url, resp.Header.Get("Content-Range"))
+	}
+	if start != off {
+		return nil, 0, xerrors.Errorf("%s: unexpected Content-Range start: got %d, want %d", url, start, off)
+	}
+	b := make([]byte, end-start+1)
+	if _, err := io.ReadFull(resp.Body, b); err != nil {
+		return nil, 0, xerrors.Errorf("%s: %v", url, err)
+	}
+	return b, size, nil
+}
+
+// store writes block idx to the local copy and marks it as present.
+func (sf *streamFile) store(idx int64, block []byte) error {
+	if got, want := int64(len(block)), sf.blockLen(idx); got != want {
+		return xerrors.Errorf("%s: block %d: unexpected length: got %d, want %d", sf.fn, idx, got, want)
+	}
+	if _, err := sf.f.WriteAt(block, idx*streamBlockSize); err != nil {
+		return err
+	}
+	// The block must be on disk before the bitmap marks it as present, lest a
+	// crash results in serving zeros.
+	if err := unix.Fdatasync(int(sf.f.Fd())); err != nil {
+		return xerrors.Errorf("fdatasync(%s): %v", sf.f.Name(), err)
+	}
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.present[idx/8] |= 1 << uint(idx%8)
+	return sf.saveBitmap()
+}
+
+// saveBitmap must be called with sf.mu held.
+func (sf *streamFile) saveBitmap() error {
+	return renameio.WriteFile(sf.f.Name()+".bitmap", sf.present, 0644)
+}
+
+// evict releases the disk space of block idx.
+func (sf *streamFile) evict(idx int64) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if !sf.has(idx) {
+		return nil
+	}
+	sf.present[idx/8] &^= 1 << uint(idx%8)
+	if err := sf.saveBitmap(); err != nil {
+		return err
+	}
+	return punchHole(sf.f, idx, sf.blockLen(idx))
+}
+
+// readBlock copies the part of block idx starting at offset off into p,
+// fetching the block if it is not cached.
+func (sf *streamFile) readBlock(p []byte, idx, off int64) (int, error) {
+	for {
+		sf.mu.Lock()
+		if sf.has(idx) {
+			// Reading while holding sf.mu prevents concurrent eviction.
+			n, err := sf.f.ReadAt(p, idx*streamBlockSize+off)
+			sf.mu.Unlock()
+			atomic.AddUint64(&sf.hits, 1)
+			sf.cache.touch(sf, idx)
+			return n, err
+		}
+		if ch, ok := sf.inflight[idx]; ok {
+			sf.mu.Unlock()
+			<-ch // another goroutine is fetching this block
+			continue
+		}
+		ch := make(chan struct{})
+		sf.inflight[idx] = ch
+		sf.mu.Unlock()
+
+		atomic.AddUint64(&sf.misses, 1)
+		block, _, err := sf.fetch(idx, sf.blockLen(idx))
+		if err == nil {
+			err = sf.store(idx, block)
+		}
+		sf.mu.Lock()
+		delete(sf.inflight, idx)
+		close(ch)
+		sf.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		sf.cache.touch(sf, idx)
+		return copy(p, block[off:]), nil
+	}
+}
+
+// ReadAt implements io.ReaderAt.
+func (sf *streamFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off >= sf.size {
+		return 0, io.EOF
+	}
+	for n < len(p) && off < sf.size {
+		idx := off / streamBlockSize
+		boff := off % streamBlockSize
+		end := int64(len(p) - n)
+		if rest := sf.blockLen(idx) - boff; end > rest {
+			end = rest
+		}
+		nn, err := sf.readBlock(p[n:int64(n)+end], idx, boff)
+		n += nn
+		off += int64(nn)
+		if err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// prefetch fetches all blocks overlapping [start, end) which are not cached.
+func (sf *streamFile) prefetch(start, end int64) {
+	if end > sf.size {
+		end = sf.size
+	}
+	var buf [1]byte
+	for idx := start / streamBlockSize; idx*streamBlockSize < end; idx++ {
+		if _, err := sf.readBlock(buf[:], idx, 0); err != nil {
+			log.Printf("prefetching %s: %v", sf.fn, err)
+			return
+		}
+	}
+}
+
+// Close closes the local copy. Cached blocks remain on disk (and in the cache
+// accounting) for the next openStream call.
+func (sf *streamFile) Close() error {
+	sf.cache.mu.Lock()
+	defer sf.cache.mu.Unlock()
+	if sf.cache.open[sf.fn] == sf {
+		delete(sf.cache.open, sf.fn)
+	}
+	return sf.f.Close()
+}
@@ -0,0 +1,133 @@
+package fuse
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri"
+)
+
+func TestStreamFile(t *testing.T) {
+	image := make([]byte, 5*streamBlockSize+123)
+	rand.New(rand.NewSource(1)).Read(image)
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		http.ServeContent(w, r, "less-amd64-530-3.squashfs", time.Time{}, bytes.NewReader(image))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "distrifuse-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remotes := []distri.Repo{{Path: srv.URL}}
+	cache, err := newStreamCache(dir, 2*streamBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf, err := openStream(cache, remotes, "debug", "less-amd64-530-3.squashfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sf.size, int64(len(image)); got != want {
+		t.Fatalf("size: got %d, want %d", got, want)
+	}
+
+	readAt := func(off, length int64) {
+		t.Helper()
+		buf := make([]byte, length)
+		n, err := sf.ReadAt(buf, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], image[off:off+length]) {
+			t.Fatalf("ReadAt(%d, %d): unexpected contents", off, length)
+		}
+	}
+
+	// Reading across a block boundary fetches exactly the two blocks:
+	atomic.StoreInt64(&requests, 0)
+	readAt(streamBlockSize-10, 20)
+	if got, want := atomic.LoadInt64(&requests), int64(1); got != want {
+		t.Errorf("requests: got %d, want %d (block 0 was cached by openStream)", got, want)
+	}
+	readAt(streamBlockSize-10, 20)
+	if got, want := atomic.LoadInt64(&requests), int64(1); got != want {
+		t.Errorf("requests: got %d, want %d (blocks should be cached)", got, want)
+	}
+
+	// Reading the last (short) block exceeds the budget of two blocks and
+	// evicts the least recently used block 0:
+	readAt(5*streamBlockSize, 123)
+	sf.mu.Lock()
+	evicted := !sf.has(0)
+	sf.mu.Unlock()
+	if !evicted {
+		t.Errorf("block 0 unexpectedly not evicted")
+	}
+	if _, err := sf.ReadAt(make([]byte, 1), int64(len(image))); err == nil {
+		t.Errorf("ReadAt beyond the end unexpectedly succeeded")
+	}
+	if err := sf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks of closed images remain accounted for:
+	if got, want := cache.usage(), int64(streamBlockSize+123); got != want {
+		t.Errorf("usage after Close: got %d, want %d", got, want)
+	}
+
+	// Cached blocks are re-used after re-opening:
+	atomic.StoreInt64(&requests, 0)
+	sf, err = openStream(cache, remotes, "debug", "less-amd64-530-3.squashfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAt(5*streamBlockSize, 123)
+	if got, want := atomic.LoadInt64(&requests), int64(0); got != want {
+		t.Errorf("requests after re-opening: got %d, want %d", got, want)
+	}
+	readAt(0, streamBlockSize)
+	if got, want := atomic.LoadInt64(&requests), int64(1); got != want {
+		t.Errorf("requests after re-opening: got %d, want %d", got, want)
+	}
+	if err := sf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks on disk are accounted for after a restart, and evicted if they
+	// exceed the (now smaller) budget, even though the image is not opened:
+	cache, err = newStreamCache(dir, streamBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cache.usage(), int64(streamBlockSize); got != want {
+		t.Errorf("usage after restart: got %d, want %d", got, want)
+	}
+	sf, err = openStream(cache, remotes, "debug", "less-amd64-530-3.squashfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sf.Close()
+	sf.mu.Lock()
+	var present int
+	for idx := int64(0); idx < sf.blocks(); idx++ {
+		if sf.has(idx) {
+			present++
+		}
+	}
+	sf.mu.Unlock()
+	if got, want := present, 1; got != want {
+		t.Errorf("blocks present after restart: got %d, want %d", got, want)
+	}
+}
@@ -3,7 +3,6 @@ package fuse
 import (
 	"os"
 
-	"github.com/distr1/distri/internal/squashfs"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 )
@@ -28,17 +27,17 @@ func (mr *unionReader) Next() bool {
 	if mr.idx > len(mr.inodes)-1 {
 		return false
 	}
-	var squashfsInode squashfs.Inode
-	mr.image, squashfsInode, mr.err = mr.fs.squashfsInode(mr.inodes[mr.idx])
-	if mr.err != nil {
-		mr.err = fuse.EIO
+	rd, image, squashfsInode, err := mr.fs.squashfsInode(mr.inodes[mr.idx])
+	if err != nil {
+		mr.err = inodeError(err)
 		return false
 	}
-
-	if mr.err = mr.fs.mountImage(mr.image); mr.err != nil {
+	if rd == nil {
+		mr.err = fuse.EIO // not a directory within an image
 		return false
 	}
-	mr.dir, mr.err = mr.fs.reader(mr.image).Readdir(squashfsInode)
+	mr.image = image
+	mr.dir, mr.err = rd.Readdir(squashfsInode)
 	mr.idx++
 	return mr.err == nil
 }
@@ -0,0 +1,229 @@
+package fuse
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/xerrors"
+)
+
+// viewsDir is the directory (relative to the mountpoint) underneath which views
+// are provided, e.g. /ro/.views/dev/bin.
+const viewsDir = "/.views"
+
+// view is a package set whose exchange directories are provided underneath
+// viewsDir, so that e.g. different users or services can see different
+// exchange directory contents.
+type view struct {
+	name string
+	// pkgs contains package names (e.g. less), which include all versions, or
+	// full package names (e.g. less-amd64-530-3).
+	pkgs []string
+	// configured is true if the view was loaded from views.d (as opposed to
+	// created by the SetView RPC).
+	configured bool
+}
+
+func (v *view) root() string { return viewsDir + "/" + v.name }
+
+// includes returns whether pkg (e.g. less-amd64-530-3) is part of v.
+func (v *view) includes(pkg string) bool {
+	name := distri.ParseVersion(pkg).Pkg
+	for _, p := range v.pkgs {
+		if p == pkg || p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// viewRelative returns the exchange path (e.g. /bin/python3) corresponding to
+// path, which might be underneath a view (e.g. /.views/dev/bin/python3).
+func viewRelative(path string) string {
+	if !strings.HasPrefix(path, viewsDir+"/") {
+		return path
+	}
+	rest := strings.TrimPrefix(path, viewsDir+"/")
+	if idx := strings.IndexByte(rest, '/'); idx > -1 {
+		return rest[idx:]
+	}
+	return "/"
+}
+
+// ValidViewName returns an error if name cannot be used as a view name, e.g.
+// because it would escape viewsDir.
+func ValidViewName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+		return xerrors.Errorf("invalid view name %q", name)
+	}
+	return nil
+}
+
+// scanViews adds symlinks for the files within exchangeDirs of pkg to all views
+// which include pkg.
+func (fs *fuseFS) scanViews(mu sync.Locker, rd *squashfs.Reader, pkg string, exchangeDirs []string) error {
+	mu.Lock()
+	var roots []string
+	for _, v := range fs.views {
+		if v.includes(pkg) {
+			roots = append(roots, v.root())
+		}
+	}
+	mu.Unlock()
+	for _, root := range roots {
+		if err := fs.scanPackagesSymlink(mu, rd, pkg, root, exchangeDirs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTree removes the directory path (e.g. /.views/dev) and its contents.
+// removeTree must be called with fs.mu held.
+func (fs *fuseFS) removeTree(path string) {
+	for p, dir := range fs.dirs {
+		if p != path && !strings.HasPrefix(p, path+"/") {
+			continue
+		}
+		for _, dirent := range dir.entries {
+			if dirent != nil {
+				delete(fs.inodes, dirent.inode)
+			}
+		}
+		delete(fs.dirs, p)
+	}
+	parent, ok := fs.dirs[filepath.Dir(path)]
+	if !ok {
+		return
+	}
+	base := filepath.Base(path)
+	for idx, dirent := range parent.entries {
+		if dirent != nil && dirent.name == base {
+			delete(fs.inodes, dirent.inode)
+			parent.entries[idx] = nil // tombstone
+		}
+	}
+	delete(parent.byName, base)
+	fs.stale(filepath.Dir(path), base)
+}
+
+// setView creates or replaces view v. setView must be called with fs.mu held.
+func (fs *fuseFS) setView(v *view) error {
+	fs.removeTree(v.root())
+	fs.views[v.name] = v
+	fs.mkExchangeDirAll(&nopLocker{}, v.root())
+	for _, dir := range fs.exchangeDirs {
+		fs.mkExchangeDirAll(&nopLocker{}, v.root()+strings.TrimPrefix(dir, "/out"))
+	}
+	for _, pkg := range fs.pkgs {
+		if pkg == "" || !v.includes(pkg) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(fs.repo, pkg+".squashfs"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // not yet downloaded
+			}
+			return err
+		}
+		rd, err := squashfs.NewReader(f)
+		if err == nil {
+			err = fs.scanPackagesSymlink(&nopLocker{}, rd, pkg, v.root(), fs.exchangeDirs)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteView must be called with fs.mu held.
+func (fs *fuseFS) deleteView(name string) {
+	fs.removeTree(viewsDir + "/" + name)
+	delete(fs.views, name)
+}
+
+// loadViews applies the views configured in views.d: new or modified views are
+// set up, and previously configured views which were removed from views.d are
+// deleted. loadViews must be called with fs.mu held.
+func (fs *fuseFS) loadViews() error {
+	configured, err := env.Views()
+	if err != nil {
+		return err
+	}
+	for name, v := range fs.views {
+		if _, ok := configured[name]; !ok && v.configured {
+			fs.deleteView(name)
+		}
+	}
+	for name, pkgs := range configured {
+		if err := ValidViewName(name); err != nil {
+			log.Print(err)
+			continue
+		}
+		if v, ok := fs.views[name]; ok && v.configured && reflect.DeepEqual(v.pkgs, pkgs) {
+			continue // unchanged
+		}
+		if err := fs.setView(&view{name: name, pkgs: pkgs, configured: true}); err != nil {
+			return xerrors.Errorf("view %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (fs *fuseFS) SetView(ctx context.Context, req *pb.SetViewRequest) (*pb.SetViewReply, error) {
+	if err := ValidViewName(req.GetName()); err != nil {
+		return nil, err
+	}
+	defer fs.invalidate() // after fs.mu.Unlock()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	v := &view{
+		name: req.GetName(),
+		pkgs: append([]string{}, req.GetPackage()...),
+	}
+	if err := fs.setView(v); err != nil {
+		return nil, err
+	}
+	return &pb.SetViewReply{}, nil
+}
+
+func (fs *fuseFS) DeleteView(ctx context.Context, req *pb.DeleteViewRequest) (*pb.DeleteViewReply, error) {
+	defer fs.invalidate() // after fs.mu.Unlock()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.views[req.GetName()]; !ok {
+		return nil, xerrors.Errorf("view %q not found", req.GetName())
+	}
+	fs.deleteView(req.GetName())
+	return &pb.DeleteViewReply{}, nil
+}
+
+func (fs *fuseFS) ListViews(ctx context.Context, req *pb.ListViewsRequest) (*pb.ListViewsReply, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	reply := &pb.ListViewsReply{}
+	for _, v := range fs.views {
+		reply.View = append(reply.View, &pb.ListViewsReply_View{
+			Name:       proto.String(v.name),
+			Package:    v.pkgs,
+			Configured: proto.Bool(v.configured),
+		})
+	}
+	sort.Slice(reply.View, func(i, j int) bool {
+		return reply.View[i].GetName() < reply.View[j].GetName()
+	})
+	return reply, nil
+}
@@ -0,0 +1,95 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestViews(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	writePackage(t, repo, "hello-amd64-1", "bin/hello")
+	writePackage(t, repo, "other-amd64-1", "bin/other")
+
+	fs := newTestFS(repo)
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := fs.SetView(ctx, &pb.SetViewRequest{
+		Name:    proto.String("dev"),
+		Package: []string{"hello"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := func(path string) map[string]string {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		dir, ok := fs.dirs[path]
+		if !ok {
+			return nil
+		}
+		m := make(map[string]string)
+		for _, dirent := range dir.entries {
+			if dirent != nil {
+				m[dirent.name] = dirent.linkTarget
+			}
+		}
+		return m
+	}
+	got := entries("/.views/dev/bin")
+	if got, want := len(got), 1; got != want {
+		t.Fatalf("unexpected number of /.views/dev/bin entries: got %d, want %d", got, want)
+	}
+	if got, want := got["hello"], "../../../hello-amd64-1/bin/hello"; got != want {
+		t.Errorf("unexpected link target: got %q, want %q", got, want)
+	}
+	// The global exchange directories are unaffected by views:
+	if got, want := len(entries("/bin")), 2; got != want {
+		t.Errorf("unexpected number of /bin entries: got %d, want %d", got, want)
+	}
+
+	// Newer versions of packages in the view appear in the view:
+	writePackage(t, repo, "hello-amd64-2", "bin/hello")
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := entries("/.views/dev/bin")["hello"], "../../../hello-amd64-2/bin/hello"; got != want {
+		t.Errorf("unexpected link target after rescan: got %q, want %q", got, want)
+	}
+
+	resp, err := fs.ListViews(ctx, &pb.ListViewsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(resp.GetView()), 1; got != want {
+		t.Fatalf("unexpected number of views: got %d, want %d", got, want)
+	}
+	if got, want := resp.GetView()[0].GetName(), "dev"; got != want {
+		t.Errorf("unexpected view name: got %q, want %q", got, want)
+	}
+
+	if _, err := fs.SetView(ctx, &pb.SetViewRequest{Name: proto.String("../etc")}); err == nil {
+		t.Errorf("SetView unexpectedly succeeded with invalid name")
+	}
+
+	if _, err := fs.DeleteView(ctx, &pb.DeleteViewRequest{Name: proto.String("dev")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := entries("/.views/dev/bin"); got != nil {
+		t.Errorf("/.views/dev/bin unexpectedly still present: %v", got)
+	}
+	if _, ok := entries("/.views")["dev"]; ok {
+		t.Errorf("/.views/dev unexpectedly still present")
+	}
+}
@@ -0,0 +1,134 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// watchSettleDelay is how long to wait for further changes (e.g. the meta file
+// of an image) before rescanning packages.
+const watchSettleDelay = 250 * time.Millisecond
+
+// isPackageFile returns whether name is a package image or meta file, as
+// opposed to e.g. temporary files of rsync.
+func isPackageFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	return strings.HasSuffix(name, ".squashfs") ||
+		strings.HasSuffix(name, ".meta.textproto")
+}
+
+// packageEvents returns whether buf (as read from an inotify file descriptor)
+// contains any events for package files.
+func packageEvents(buf []byte) bool {
+	for len(buf) >= unix.SizeofInotifyEvent {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := unix.SizeofInotifyEvent + int(ev.Len)
+		if end > len(buf) {
+			break // truncated
+		}
+		if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+			return true // events were lost, rescan to be safe
+		}
+		name := buf[unix.SizeofInotifyEvent:end]
+		if idx := bytes.IndexByte(name, 0); idx > -1 {
+			name = name[:idx] // strip NUL padding
+		}
+		if isPackageFile(string(name)) {
+			return true
+		}
+		buf = buf[end:]
+	}
+	return false
+}
+
+// rescanPackages updates the file system to reflect the images in fs.repo, the
+// conflict policy configuration and the views configuration.
+func (fs *fuseFS) rescanPackages() error {
+	pkgs, err := fs.findPackages()
+	if err != nil {
+		return xerrors.Errorf("findPackages: %v", err)
+	}
+	// Pick up changes to pins.d and alternatives.d:
+	policy, err := loadConflictPolicy(fs.policy.name)
+	if err != nil {
+		return xerrors.Errorf("loadConflictPolicy: %v", err)
+	}
+	defer fs.invalidate() // after fs.mu.Unlock()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.policy = policy
+	fs.resolveConflicts()
+	if err := fs.scanPackages(&nopLocker{}, pkgs); err != nil {
+		return err
+	}
+	return fs.loadViews()
+}
+
+// watchPackages rescans packages whenever images are moved into or deleted
+// from fs.repo, until ctx is canceled.
+func (fs *fuseFS) watchPackages(ctx context.Context) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return xerrors.Errorf("inotify_init1: %v", err)
+	}
+	const mask = unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_CLOSE_WRITE | unix.IN_DELETE
+	if _, err := unix.InotifyAddWatch(fd, fs.repo, mask); err != nil {
+		unix.Close(fd)
+		return xerrors.Errorf("inotify_add_watch(%s): %v", fs.repo, err)
+	}
+	// Using a non-blocking file descriptor with the runtime poller allows
+	// unblocking Read by calling Close.
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		defer close(changed)
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("reading inotify events: %v", err)
+				}
+				return
+			}
+			if !packageEvents(buf[:n]) {
+				continue
+			}
+			select {
+			case changed <- struct{}{}:
+			default:
+				// rescan already pending
+			}
+		}
+	}()
+
+	go func() {
+		for range changed {
+			time.Sleep(watchSettleDelay)
+			select {
+			case <-changed:
+			default:
+			}
+			log.Printf("scanning packages upon changes in %s", fs.repo)
+			if err := fs.rescanPackages(); err != nil {
+				log.Print(err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,269 @@
+package fuse
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/internal/env"
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"github.com/jacobsa/fuse"
+	"github.com/jacobsa/fuse/fuseops"
+)
+
+// writeImage writes a package image containing bin/<name> to fn.
+func writeImage(t *testing.T, fn, name string) {
+	t.Helper()
+	writeImageFiles(t, fn, "bin/"+name)
+}
+
+// writeImageFiles writes a package image containing the specified files (e.g.
+// out/lib/libfoo.so) to fn.
+func writeImageFiles(t *testing.T, fn string, files ...string) {
+	t.Helper()
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := squashfs.NewWriter(f, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Directories need to be flushed after their subdirectories.
+	type node struct {
+		files   []string
+		subdirs map[string]*node
+	}
+	root := &node{subdirs: make(map[string]*node)}
+	for _, fn := range files {
+		components := strings.Split(fn, "/")
+		n := root
+		for _, c := range components[:len(components)-1] {
+			if n.subdirs[c] == nil {
+				n.subdirs[c] = &node{subdirs: make(map[string]*node)}
+			}
+			n = n.subdirs[c]
+		}
+		n.files = append(n.files, components[len(components)-1])
+	}
+	var write func(d *squashfs.Directory, n *node)
+	write = func(d *squashfs.Directory, n *node) {
+		for name, sub := range n.subdirs {
+			write(d.Directory(name, time.Now()), sub)
+		}
+		for _, name := range n.files {
+			ff, err := d.File(name, time.Now(), 0555, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ff.Write([]byte("#!/bin/sh\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := ff.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := d.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(w.Root, root)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestFS returns a fuseFS for repo, set up like Mount does.
+func newTestFS(repo string) *fuseFS {
+	fs := &fuseFS{
+		repo:        repo,
+		repoSection: "pkg",
+		fileReaders: make(map[fuseops.InodeID]*squashfs.File),
+		inodeCnt:    2, // root + ctl inode
+		dirs:        make(map[string]*dir),
+		inodes:      make(map[fuseops.InodeID]interface{}),
+		unions:      make(map[fuseops.InodeID][]fuseops.InodeID),
+		remotePkgs:  make(map[string]*remotePackage),
+		policy:      conflictPolicy{name: policyNewest},
+		views:       make(map[string]*view),
+	}
+	root := &dir{byName: make(map[string]*dirent)}
+	fs.dirs["/"] = root
+	fs.inodes[fs.inodeCnt] = root
+	fs.addExchangeDirs(env.DefaultExchangeDirs)
+	return fs
+}
+
+// writePackage writes the meta file and an image containing files for pkg
+// (e.g. hello-amd64-1) to repo.
+func writePackage(t *testing.T, repo, pkg string, files ...string) {
+	t.Helper()
+	pv := distri.ParseVersion(pkg)
+	meta := []byte("source_pkg: \"" + pv.Pkg + "\"\nversion: \"" + pv.Upstream + "\"\n")
+	if err := ioutil.WriteFile(filepath.Join(repo, pkg+".meta.textproto"), meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeImageFiles(t, filepath.Join(repo, pkg+".squashfs"), files...)
+}
+
+func TestWatchPackages(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	fs := newTestFS(repo)
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+	if err := fs.watchPackages(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(desc string, cond func() bool) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+			fs.mu.Lock()
+			ok := cond()
+			fs.mu.Unlock()
+			if ok {
+				return
+			}
+		}
+		t.Fatalf("timeout waiting for %s", desc)
+	}
+	hasPackage := func(pkg string) bool {
+		for _, p := range fs.pkgs {
+			if p == pkg {
+				return true
+			}
+		}
+		return false
+	}
+	linkTarget := func(name string) string {
+		bin, ok := fs.dirs["/bin"]
+		if !ok {
+			return ""
+		}
+		if d, ok := bin.byName[name]; ok {
+			return d.linkTarget
+		}
+		return ""
+	}
+
+	// Install a package the way distri install does: meta file first, then
+	// rename the image into place.
+	const pkg = "hello-amd64-1"
+	meta := []byte("source_pkg: \"hello\"\nversion: \"1\"\n")
+	if err := ioutil.WriteFile(filepath.Join(repo, pkg+".meta.textproto"), meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(repo, ".tmp-"+pkg)
+	writeImage(t, tmp, "hello")
+	if err := os.Rename(tmp, filepath.Join(repo, pkg+".squashfs")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("package to appear", func() bool {
+		return hasPackage(pkg) && linkTarget("hello") == "../hello-amd64-1/bin/hello"
+	})
+
+	// Delete the package the way distri gc does:
+	for _, suffix := range []string{".meta.textproto", ".squashfs"} {
+		if err := os.Remove(filepath.Join(repo, pkg+suffix)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor("package to be retired", func() bool {
+		return !hasPackage(pkg) && linkTarget("hello") == ""
+	})
+}
+
+func TestRemovePackages(t *testing.T) {
+	repo, err := ioutil.TempDir("", "distrifuse-remove")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+
+	fs := newTestFS(repo)
+
+	for _, pkg := range []string{"hello-amd64-1", "hello-amd64-2"} {
+		writePackage(t, repo, pkg, "bin/hello")
+	}
+	if err := fs.rescanPackages(); err != nil {
+		t.Fatal(err)
+	}
+	linkTarget := func() string {
+		if d, ok := fs.dirs["/bin"].byName["hello"]; ok {
+			return d.linkTarget
+		}
+		return ""
+	}
+	if got, want := linkTarget(), "../hello-amd64-2/bin/hello"; got != want {
+		t.Fatalf("unexpected link target: got %q, want %q", got, want)
+	}
+
+	var image int
+	for idx, pkg := range fs.pkgs {
+		if pkg == "hello-amd64-2" {
+			image = idx
+		}
+	}
+	rd, err := fs.mountImage(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An inode which the kernel might still reference after removal:
+	fileInode, err := rd.LookupPath("bin/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inode := fs.fuseInode(image, fileInode)
+
+	if _, err := fs.RemovePackages(context.Background(), &pb.RemovePackagesRequest{
+		Package: []string{"hello-amd64-2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.pkgs[image]; got != "" {
+		t.Errorf("package not removed: fs.pkgs[%d] = %q", image, got)
+	}
+	if fs.reader(image) != nil {
+		t.Errorf("reader of removed package not closed")
+	}
+	if _, err := fs.mountImage(image); err == nil {
+		t.Errorf("mountImage(removed package) unexpectedly succeeded")
+	}
+	// Requests for inodes of the removed package must fail instead of
+	// dereferencing the closed reader:
+	ctx := context.Background()
+	if err := fs.GetInodeAttributes(ctx, &fuseops.GetInodeAttributesOp{Inode: inode}); err != fuse.ENOENT {
+		t.Errorf("GetInodeAttributes(removed package) = %v, want ENOENT", err)
+	}
+	if err := fs.ReadFile(ctx, &fuseops.ReadFileOp{Inode: inode, Dst: make([]byte, 16)}); err != fuse.ENOENT {
+		t.Errorf("ReadFile(removed package) = %v, want ENOENT", err)
+	}
+	if err := fs.ReadSymlink(ctx, &fuseops.ReadSymlinkOp{Inode: inode}); err != fuse.ENOENT {
+		t.Errorf("ReadSymlink(removed package) = %v, want ENOENT", err)
+	}
+	if err := fs.ListXattr(ctx, &fuseops.ListXattrOp{Inode: inode}); err != fuse.ENOENT {
+		t.Errorf("ListXattr(removed package) = %v, want ENOENT", err)
+	}
+	if err := fs.ReadDir(ctx, &fuseops.ReadDirOp{Inode: fs.fuseInode(image, rootInode)}); err != fuse.ENOENT {
+		t.Errorf("ReadDir(removed package) = %v, want ENOENT", err)
+	}
+	if got, want := linkTarget(), "../hello-amd64-1/bin/hello"; got != want {
+		t.Errorf("unexpected link target after removal: got %q, want %q", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package install
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,8 +11,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime/pprof"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -20,8 +23,10 @@ import (
 	"github.com/distr1/distri"
 	"github.com/distr1/distri/internal/env"
 	"github.com/distr1/distri/internal/repo"
+	"github.com/distr1/distri/internal/roimg"
 	"github.com/distr1/distri/internal/squashfs"
 	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
 	"github.com/google/renameio"
 	"golang.org/x/exp/mmap"
 	"golang.org/x/sync/errgroup"
@@ -42,6 +47,17 @@ func (e errPackageNotFound) Error() string {
 	return fmt.Sprintf("package %s not found on any configured repo", e.pkg)
 }
 
+// errUnsatisfiable is returned when no available version of pkg satisfies the
+// pins and holds (see env.Pins) of pkg and its runtime dependencies.
+type errUnsatisfiable struct {
+	pkg    string
+	reason string
+}
+
+func (e errUnsatisfiable) Error() string {
+	return fmt.Sprintf("%s: no available version can be installed: %s", e.pkg, e.reason)
+}
+
 func isNotExist(err error) bool {
 	if _, ok := err.(*repo.ErrNotFound); ok {
 		return true
@@ -115,6 +131,105 @@ type Ctx struct {
 	// Configuration
 	SkipContentHooks bool
 	HookDryRun       io.Writer // if non-nil, write commands instead of executing
+	Operation        string    // recorded in the new generation, default “install”
+	Pkgset           string    // if non-empty, recorded in the new generation
+	// SkipGeneration leaves recording a generation to the caller, e.g. when
+	// one operation consists of multiple Packages calls (see distri update).
+	SkipGeneration bool
+	// Insecure installs packages from repositories for which no trusted keys
+	// are configured without verifying them. By default, such repositories are
+	// refused.
+	Insecure bool
+	// IgnorePins installs the specified versions regardless of pins and holds
+	// (see env.Pins), e.g. when restoring a generation.
+	IgnorePins bool
+	// Modify, if non-nil, is called after installing the packages, with the
+	// store still locked, so that e.g. distri reset can remove packages as part
+	// of the same generation.
+	Modify func(st *roimg.Store) error
+
+	// State
+	indexes map[string]*repo.Index // by distri.Repo.PkgPath, if verifying
+	store   *roimg.Store           // locked for the duration of Packages
+	pins    map[string]env.Pin     // by package name, e.g. glibc
+
+	versionsMu sync.Mutex
+	versions   map[string][]string // by distri.Repo.PkgPath, see repoPackages
+}
+
+// held returns the installed versions of pkg (e.g. glibc-amd64-2.31-4) if pkg
+// is held, or nil if pkg may be installed.
+func (c *Ctx) held(pkg string) ([]string, error) {
+	pv := distri.ParseVersion(pkg)
+	if pin, ok := c.pins[pv.Pkg]; !ok || !pin.Hold {
+		return nil, nil
+	}
+	pkgs, err := c.store.Packages()
+	if err != nil {
+		return nil, err
+	}
+	var installed []string
+	for _, p := range pkgs {
+		if ipv := distri.ParseVersion(p); ipv.Pkg == pv.Pkg && ipv.Arch == pv.Arch {
+			installed = append(installed, p)
+		}
+	}
+	return installed, nil
+}
+
+// pinned returns the pin which disallows installing pkg (e.g.
+// linux-amd64-5.5.2-12), if any.
+func (c *Ctx) pinned(pkg string) (env.Pin, bool) {
+	pv := distri.ParseVersion(pkg)
+	pin, ok := c.pins[pv.Pkg]
+	if !ok || pin.Allows(strings.TrimPrefix(pkg, pv.Pkg+"-"+pv.Arch+"-")) {
+		return env.Pin{}, false
+	}
+	return pin, true
+}
+
+// fetchIndexes downloads and verifies the signed index of all repos, using the
+// trusted keys configured globally or per repository. Repositories without
+// trusted keys are refused unless c.Insecure is set.
+func (c *Ctx) fetchIndexes(ctx context.Context, repos []distri.Repo) error {
+	keys, err := env.TrustedKeys()
+	if err != nil {
+		return err
+	}
+	c.indexes = make(map[string]*repo.Index, len(repos))
+	for _, r := range repos {
+		keys := keys // copy
+		if len(r.Keys) > 0 {
+			keys = r.Keys
+		}
+		if len(keys) == 0 {
+			if !c.Insecure {
+				return xerrors.Errorf("no trusted keys configured in %s for repository %s, refusing to install unverified packages (use -insecure to override)", filepath.Join(env.DistriConfig, "keys.d"), r.PkgPath)
+			}
+			log.Printf("no trusted keys configured in %s, not verifying packages from %s", filepath.Join(env.DistriConfig, "keys.d"), r.PkgPath)
+			continue
+		}
+		idx, err := repo.FetchIndex(ctx, r, keys)
+		if err != nil {
+			return xerrors.Errorf("verifying repository %s: %w", r.PkgPath, err)
+		}
+		c.indexes[r.PkgPath] = idx
+	}
+	return nil
+}
+
+// verify returns an error unless digest matches the digest of fn in the
+// signed index of r. With c.Insecure, verify succeeds for repositories without
+// trusted keys.
+func (c *Ctx) verify(r distri.Repo, fn string, digest []byte) error {
+	idx, ok := c.indexes[r.PkgPath]
+	if !ok {
+		if c.Insecure {
+			return nil // no trusted keys configured
+		}
+		return xerrors.Errorf("%s: no verified index for repository %s", fn, r.PkgPath)
+	}
+	return idx.Verify(fn, digest)
 }
 
 func (c *Ctx) install1(ctx context.Context, root string, installRepo distri.Repo, pkg string, first bool) error {
@@ -143,7 +258,8 @@ func (c *Ctx) install1(ctx context.Context, root string, installRepo distri.Repo
 			return err
 		}
 		defer in.Close()
-		n, err := io.Copy(f, in)
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h), in)
 		if err != nil {
 			return err
 		}
@@ -152,6 +268,13 @@ func (c *Ctx) install1(ctx context.Context, root string, installRepo distri.Repo
 		if err := f.Close(); err != nil {
 			return err
 		}
+		if err := c.verify(installRepo, fn, h.Sum(nil)); err != nil {
+			// Do not leave the unverified files behind:
+			if err := os.RemoveAll(tmpDir); err != nil {
+				log.Print(err)
+			}
+			return err
+		}
 	}
 
 	// first is true only on the first installation of the package (regardless
@@ -356,19 +479,183 @@ func (c *Ctx) install1(ctx context.Context, root string, installRepo distri.Repo
 		}
 	}
 
-	// First meta, then image: the fuse daemon considers the image canonical, so
-	// it must go last.
-	for _, fn := range []string{pkg + ".meta.textproto", pkg + ".squashfs"} {
-		if err := os.Rename(filepath.Join(tmpDir, fn), filepath.Join(root, "roimg", fn)); err != nil {
-			return err
+	return c.store.Install(pkg, tmpDir)
+}
+
+// unsatisfied returns why pkg (e.g. hello-amd64-2.10-1) with the specified
+// runtime dependencies cannot be installed without violating pins or holds, or
+// the empty string if it can be installed.
+func (c *Ctx) unsatisfied(pkg string, runtimeDeps []string) (string, error) {
+	for _, p := range append([]string{pkg}, runtimeDeps...) {
+		installed, err := c.held(p)
+		if err != nil {
+			return "", err
+		}
+		if len(installed) > 0 && !contains(installed, p) {
+			return fmt.Sprintf("%s is held (installed: %v)", p, installed), nil
+		}
+		if pin, ok := c.pinned(p); ok {
+			return fmt.Sprintf("%s does not match pin %q", p, pin), nil
 		}
 	}
+	return "", nil
+}
 
-	if err := os.Remove(tmpDir); err != nil {
-		return err
+func contains(pkgs []string, pkg string) bool {
+	for _, p := range pkgs {
+		if p == pkg {
+			return true
+		}
 	}
+	return false
+}
 
-	return nil
+// readMeta reads and verifies the package meta file fn (e.g.
+// hello-amd64.meta.textproto) from r.
+func (c *Ctx) readMeta(r distri.Repo, fn string) (*pb.Meta, error) {
+	rd, err := repo.Reader(context.Background(), r, fn, false)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(b)
+	if err := c.verify(r, fn, digest[:]); err != nil {
+		return nil, err
+	}
+	var pm pb.Meta
+	if err := (prototext.UnmarshalOptions{
+		// Discarding unknown fields is more robust: when the user runs a
+		// different version of distri as FUSE daemon process and install
+		// process, installing packages with an unknown field might result
+		// in an error.
+		DiscardUnknown: true,
+	}).Unmarshal(b, &pm); err != nil {
+		return nil, err
+	}
+	return &pm, nil
+}
+
+// repoPackages returns the full names of all packages (e.g.
+// hello-amd64-2.10-1) which r offers according to its package list
+// (meta.binaryproto, see distri mirror). Repositories without a package list
+// offer no packages. The package list is only read once per repository.
+func (c *Ctx) repoPackages(r distri.Repo) ([]string, error) {
+	c.versionsMu.Lock()
+	defer c.versionsMu.Unlock()
+	if pkgs, ok := c.versions[r.PkgPath]; ok {
+		return pkgs, nil
+	}
+	var pkgs []string
+	rd, err := repo.Reader(context.Background(), r, "meta.binaryproto", false)
+	if err != nil && !isNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		b, err := ioutil.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(b)
+		if err := c.verify(r, "meta.binaryproto", digest[:]); err != nil {
+			return nil, err
+		}
+		var mm pb.MirrorMeta
+		if err := proto.Unmarshal(b, &mm); err != nil {
+			return nil, xerrors.Errorf("%s/meta.binaryproto: %v", r.PkgPath, err)
+		}
+		for _, p := range mm.GetPackage() {
+			pkgs = append(pkgs, p.GetName())
+		}
+	}
+	if c.versions == nil {
+		c.versions = make(map[string][]string)
+	}
+	c.versions[r.PkgPath] = pkgs
+	return pkgs, nil
+}
+
+type candidate struct {
+	full string // e.g. hello-amd64-2.10-1
+	meta *pb.Meta
+	repo distri.Repo
+}
+
+// choose returns the most preferred candidate which satisfies the pins and
+// holds of the package and all of its runtime dependencies. Otherwise, choose
+// returns nil and why the most preferred candidate is unsatisfied.
+func (c *Ctx) choose(cands []candidate) (*candidate, string, error) {
+	// The repository priority takes precedence over the version. Among equal
+	// versions, the first configured repository wins.
+	sort.SliceStable(cands, func(i, j int) bool {
+		ri, rj := cands[i].repo, cands[j].repo
+		if ri.Priority != rj.Priority {
+			return ri.Priority > rj.Priority
+		}
+		vi := distri.ParseVersion(cands[i].meta.GetVersion())
+		vj := distri.ParseVersion(cands[j].meta.GetVersion())
+		return vi.Compare(vj) > 0
+	})
+	var reason string
+	for idx, cand := range cands {
+		r, err := c.unsatisfied(cand.full, cand.meta.GetRuntimeDep())
+		if err != nil {
+			return nil, "", err
+		}
+		if r == "" {
+			return &cands[idx], "", nil
+		}
+		if reason == "" {
+			reason = r // of the most preferred version
+		}
+	}
+	return nil, reason, nil
+}
+
+// olderCandidates returns the versions of pkg (e.g. hello-amd64) other than
+// those in cands which repos offer and which satisfy the pins and holds of pkg
+// itself.
+func (c *Ctx) olderCandidates(repos []distri.Repo, pkg string, cands []candidate) ([]candidate, error) {
+	known := make(map[string]bool)
+	for _, cand := range cands {
+		known[cand.full] = true
+	}
+	var older []candidate
+	for _, r := range repos {
+		pkgs, err := c.repoPackages(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, full := range pkgs {
+			if known[full] || !strings.HasPrefix(full, pkg+"-") {
+				continue
+			}
+			pv := distri.ParseVersion(full)
+			if pv.Pkg+"-"+pv.Arch != pkg {
+				continue // e.g. hello-doc-amd64-1 for pkg hello
+			}
+			// Only fetch the meta files of versions which pkg’s own pins and
+			// holds permit:
+			if reason, err := c.unsatisfied(full, nil); err != nil {
+				return nil, err
+			} else if reason != "" {
+				continue
+			}
+			pm, err := c.readMeta(r, full+".meta.textproto")
+			if err != nil {
+				if isNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			older = append(older, candidate{full: full, meta: pm, repo: r})
+		}
+	}
+	return older, nil
 }
 
 func (c *Ctx) installTransitively1(root string, repos []distri.Repo, pkg string) error {
@@ -376,46 +663,58 @@ func (c *Ctx) installTransitively1(root string, repos []distri.Repo, pkg string)
 	if _, ok := distri.HasArchSuffix(pkg); !ok && !distri.LikelyFullySpecified(pkg) {
 		pkg += "-amd64" // TODO: configurable / auto-detect
 	}
-	metas := make(map[*pb.Meta]distri.Repo)
+	_, unversioned := distri.HasArchSuffix(pkg)
+	var cands []candidate
 	for _, r := range repos {
-		rd, err := repo.Reader(context.Background(), r, pkg+".meta.textproto", false)
+		pm, err := c.readMeta(r, pkg+".meta.textproto")
 		if err != nil {
 			if isNotExist(err) {
 				continue
 			}
 			return err
 		}
-		b, err := ioutil.ReadAll(rd)
-		rd.Close()
-		if err != nil {
-			return err
+		full := pkg
+		if unversioned {
+			full += "-" + pm.GetVersion()
 		}
-		var pm pb.Meta
-		if err := (prototext.UnmarshalOptions{
-			// Discarding unknown fields is more robust: when the user runs a
-			// different version of distri as FUSE daemon process and install
-			// process, installing packages with an unknown field might result
-			// in an error.
-			DiscardUnknown: true,
-		}).Unmarshal(b, &pm); err != nil {
+		cands = append(cands, candidate{full: full, meta: pm, repo: r})
+	}
+	if len(cands) == 0 {
+		return &errPackageNotFound{pkg: pkg}
+	}
+	// Install the most preferred version which satisfies the pins and holds of
+	// the package and all of its runtime dependencies:
+	chosen, reason, err := c.choose(cands)
+	if err != nil {
+		return err
+	}
+	if chosen == nil && unversioned {
+		// The latest version in each repository cannot be installed, but the
+		// repositories might offer older versions which can:
+		older, err := c.olderCandidates(repos, pkg, cands)
+		if err != nil {
 			return err
 		}
-		metas[&pm] = r
-	}
-	var pm *pb.Meta
-	var repo distri.Repo
-	for m, r := range metas {
-		if pm == nil || m.GetVersion() > pm.GetVersion() {
-			pm = m
-			repo = r
+		if len(older) > 0 {
+			if chosen, _, err = c.choose(older); err != nil {
+				return err
+			}
 		}
 	}
-	if pm == nil {
-		return &errPackageNotFound{pkg: pkg}
+	if chosen == nil {
+		return &errUnsatisfiable{pkg: pkg, reason: reason}
 	}
+	pm, repo := chosen.meta, chosen.repo
+	pkg = chosen.full
 
-	if _, ok := distri.HasArchSuffix(pkg); ok {
-		pkg += "-" + pm.GetVersion()
+	installed, err := c.held(pkg)
+	if err != nil {
+		return err
+	}
+	if len(installed) > 0 {
+		// unsatisfied ensures pkg is among the installed versions.
+		log.Printf("not installing %s: package is held (installed: %v)", pkg, installed)
+		return nil
 	}
 
 	// TODO(later): we could write out b here and save 1 HTTP request
@@ -467,11 +766,29 @@ func (c *Ctx) Packages(args []string, root, repo string, update bool) error {
 		return xerrors.Errorf("no repos configured")
 	}
 
-	// TODO: lock to ensure only one process modifies roimg at a time
+	if err := c.fetchIndexes(context.Background(), repos); err != nil {
+		return err
+	}
+
+	st, err := roimg.Lock(filepath.Join(root, "roimg"))
+	if err != nil {
+		return err
+	}
+	defer st.Unlock() // error paths only, see below
+	c.store = st
+	if !c.IgnorePins {
+		if c.pins, err = env.Pins(); err != nil {
+			return err
+		}
+	}
+	if err := st.InitGenerations(root); err != nil {
+		return err
+	}
 
 	tmpDir := filepath.Join(root, "roimg", "tmp")
 
-	// Remove stale work directories of previously interrupted/crashed processes.
+	// Remove stale work directories of previously interrupted/crashed
+	// processes. Holding the store lock, no other process is using them.
 	if err := os.RemoveAll(tmpDir); err != nil {
 		return err
 	}
@@ -496,6 +813,10 @@ func (c *Ctx) Packages(args []string, root, repo string, update bool) error {
 			if _, ok := err.(*errPackageNotFound); ok && update {
 				return nil // ignore package not found
 			}
+			if _, ok := err.(*errUnsatisfiable); ok && update {
+				log.Printf("not updating: %v", err)
+				return nil // keep the installed version
+			}
 			return err
 		})
 	}
@@ -522,6 +843,30 @@ func (c *Ctx) Packages(args []string, root, repo string, update bool) error {
 		return err
 	}
 
+	if c.Modify != nil {
+		if err := c.Modify(st); err != nil {
+			return err
+		}
+	}
+
+	if st.Modified() && !c.SkipGeneration {
+		operation := c.Operation
+		if operation == "" {
+			operation = "install"
+		}
+		gen := &pb.Generation{Operation: proto.String(operation)}
+		if c.Pkgset != "" {
+			gen.Pkgset = proto.String(c.Pkgset)
+		}
+		if err := st.RecordGeneration(root, gen); err != nil {
+			return err
+		}
+	}
+
+	if err := st.Unlock(); err != nil {
+		return err
+	}
+
 	if cl != nil {
 		if _, err := cl.ScanPackages(ctx, &pb.ScanPackagesRequest{}); err != nil {
 			return err
@@ -2,14 +2,24 @@ package install_test
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/distr1/distri"
 	"github.com/distr1/distri/internal/env"
 	"github.com/distr1/distri/internal/install"
+	"github.com/distr1/distri/internal/repo"
+	"github.com/distr1/distri/internal/roimg"
+	"github.com/distr1/distri/internal/squashfs"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -31,6 +41,7 @@ func TestHooks(t *testing.T) {
 	var buf bytes.Buffer
 	c := &install.Ctx{
 		HookDryRun: &buf,
+		Insecure:   true,
 	}
 	if err := c.Packages([]string{"linux"}, tmpdir, env.DefaultRepo, false /* update */); err != nil {
 		t.Fatal(err)
@@ -44,3 +55,417 @@ func TestHooks(t *testing.T) {
 		t.Fatalf("hooks: unexpected commands: diff (-want +got):\n%s", diff)
 	}
 }
+
+func writePackage(t *testing.T, dir, pkg string, runtimeDeps ...string) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(dir, pkg+".squashfs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := squashfs.NewWriter(f, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pv := distri.ParseVersion(pkg)
+	meta := []byte(fmt.Sprintf("source_pkg: %q\nversion: \"%s-%d\"\n", pv.Pkg, pv.Upstream, pv.DistriRevision))
+	for _, dep := range runtimeDeps {
+		meta = append(meta, fmt.Sprintf("runtime_dep: %q\n", dep)...)
+	}
+	for _, fn := range []string{pkg, pv.Pkg + "-" + pv.Arch} {
+		if err := ioutil.WriteFile(filepath.Join(dir, fn+".meta.textproto"), meta, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "distritest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	repoDir := filepath.Join(tmpdir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePackage(t, repoDir, "hello-amd64-1.0-1")
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.WriteIndex(repoDir, priv); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := filepath.Join(tmpdir, "cfg")
+	if err := os.MkdirAll(filepath.Join(cfg, "keys.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg, "keys.d", "test.pub"), []byte(base64.StdEncoding.EncodeToString(pub)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	var insecure bool
+	install := func(root string) error {
+		c := &install.Ctx{Insecure: insecure}
+		return c.Packages([]string{"hello"}, filepath.Join(tmpdir, root), repoDir, false /* update */)
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		if err := install("valid"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(tmpdir, "valid", "roimg", "hello-amd64-1.0-1.squashfs")); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		f, err := os.OpenFile(filepath.Join(repoDir, "hello-amd64-1.0-1.squashfs"), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte{0}); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := install("tampered"); err == nil {
+			t.Fatal("installing tampered package unexpectedly succeeded")
+		}
+		if _, err := os.Stat(filepath.Join(tmpdir, "tampered", "roimg", "hello-amd64-1.0-1.squashfs")); !os.IsNotExist(err) {
+			t.Fatalf("tampered package unexpectedly installed (stat: %v)", err)
+		}
+		staging, err := ioutil.ReadDir(filepath.Join(tmpdir, "tampered", "roimg", "tmp"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(staging) > 0 {
+			t.Errorf("tampered package left behind in staging directory: %v", staging[0].Name())
+		}
+	})
+
+	t.Run("UntrustedKey", func(t *testing.T) {
+		_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.WriteIndex(repoDir, otherPriv); err != nil {
+			t.Fatal(err)
+		}
+		if err := install("untrusted"); err == nil {
+			t.Fatal("installing from repository with untrusted signature unexpectedly succeeded")
+		}
+	})
+
+	t.Run("NoTrustedKeys", func(t *testing.T) {
+		env.DistriConfig = filepath.Join(tmpdir, "empty-cfg")
+		defer func() { env.DistriConfig = cfg }()
+		if err := install("unsigned"); err == nil {
+			t.Fatal("installing without trusted keys unexpectedly succeeded")
+		}
+		insecure = true
+		defer func() { insecure = false }()
+		if err := install("insecure"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestPins(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "distritest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Two repositories offering different versions of the same package:
+	for _, pkg := range []string{"hello-amd64-1.0-1", "hello-amd64-2.0-1"} {
+		repoDir := filepath.Join(tmpdir, pkg, "pkg")
+		if err := os.MkdirAll(repoDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writePackage(t, repoDir, pkg)
+	}
+
+	cfg := filepath.Join(tmpdir, "cfg")
+	for _, dir := range []string{"repos.d", "pins.d"} {
+		if err := os.MkdirAll(filepath.Join(cfg, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repos := filepath.Join(tmpdir, "hello-amd64-1.0-1") + "\n" +
+		filepath.Join(tmpdir, "hello-amd64-2.0-1") + "\n"
+	if err := ioutil.WriteFile(filepath.Join(cfg, "repos.d", "test.repo"), []byte(repos), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	root := filepath.Join(tmpdir, "root")
+	pin := func(pins string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(cfg, "pins.d", "test.pins"), []byte(pins), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	installed := func(pkg string) bool {
+		_, err := os.Stat(filepath.Join(root, "roimg", pkg+".squashfs"))
+		return err == nil
+	}
+
+	pin("hello 1.* # stay on the stable branch\n")
+	c := &install.Ctx{Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", false /* update */); err != nil {
+		t.Fatal(err)
+	}
+	if !installed("hello-amd64-1.0-1") || installed("hello-amd64-2.0-1") {
+		t.Fatalf("pin not honored: want only hello-amd64-1.0-1 installed")
+	}
+
+	pin("hello hold\n")
+	c = &install.Ctx{Operation: "update", Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", true /* update */); err != nil {
+		t.Fatal(err)
+	}
+	if installed("hello-amd64-2.0-1") {
+		t.Fatalf("held package hello unexpectedly updated")
+	}
+
+	pin("hello 3.*\n")
+	c = &install.Ctx{Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", false /* update */); err == nil {
+		t.Fatalf("install unexpectedly succeeded despite no version matching the pin")
+	}
+	// An unsatisfiable pin must not abort the update of other packages:
+	c = &install.Ctx{Operation: "update", Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", true /* update */); err != nil {
+		t.Fatal(err)
+	}
+	if installed("hello-amd64-2.0-1") {
+		t.Fatalf("hello unexpectedly updated despite no version matching the pin")
+	}
+
+	pin("")
+	c = &install.Ctx{Operation: "update", Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", true /* update */); err != nil {
+		t.Fatal(err)
+	}
+	if !installed("hello-amd64-2.0-1") {
+		t.Fatalf("hello not updated to hello-amd64-2.0-1 without pin")
+	}
+
+	// Restoring a generation (distri reset) installs the recorded versions
+	// regardless of pins, and removes packages while holding the same lock:
+	pin("hello 2.*\n")
+	root = filepath.Join(tmpdir, "reset")
+	c = &install.Ctx{Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", false /* update */); err != nil {
+		t.Fatal(err)
+	}
+	c = &install.Ctx{
+		Operation:  "reset",
+		IgnorePins: true,
+		Insecure:   true,
+		Modify: func(st *roimg.Store) error {
+			if !installed("hello-amd64-1.0-1") {
+				t.Errorf("Modify called before installing hello-amd64-1.0-1")
+			}
+			return st.Remove("hello-amd64-2.0-1")
+		},
+	}
+	if err := c.Packages([]string{"hello-amd64-1.0-1"}, root, "", false /* update */); err != nil {
+		t.Fatal(err)
+	}
+	if !installed("hello-amd64-1.0-1") || installed("hello-amd64-2.0-1") {
+		t.Fatalf("generation not restored: want only hello-amd64-1.0-1 installed")
+	}
+}
+
+func TestPinnedRuntimeDeps(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "distritest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Version 2 of app requires version 2 of libfoo:
+	for _, version := range []string{"1-1", "2-1"} {
+		repoDir := filepath.Join(tmpdir, version, "pkg")
+		if err := os.MkdirAll(repoDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writePackage(t, repoDir, "libfoo-amd64-"+version)
+		writePackage(t, repoDir, "app-amd64-"+version, "libfoo-amd64-"+version)
+	}
+
+	cfg := filepath.Join(tmpdir, "cfg")
+	for _, dir := range []string{"repos.d", "pins.d"} {
+		if err := os.MkdirAll(filepath.Join(cfg, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repos := filepath.Join(tmpdir, "1-1") + "\n" +
+		filepath.Join(tmpdir, "2-1") + "\n"
+	if err := ioutil.WriteFile(filepath.Join(cfg, "repos.d", "test.repo"), []byte(repos), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	root := filepath.Join(tmpdir, "root")
+	pin := func(pins string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(cfg, "pins.d", "test.pins"), []byte(pins), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	installed := func(pkg string) bool {
+		_, err := os.Stat(filepath.Join(root, "roimg", pkg+".squashfs"))
+		return err == nil
+	}
+
+	// The newest app does not satisfy the pin of its runtime dependency, so the
+	// previous version must be installed:
+	pin("libfoo 1-*\n")
+	c := &install.Ctx{Insecure: true}
+	if err := c.Packages([]string{"app"}, root, "", false /* update */); err != nil {
+		t.Fatal(err)
+	}
+	for pkg, want := range map[string]bool{
+		"app-amd64-1-1":    true,
+		"libfoo-amd64-1-1": true,
+		"app-amd64-2-1":    false,
+		"libfoo-amd64-2-1": false,
+	} {
+		if got := installed(pkg); got != want {
+			t.Errorf("installed(%s) = %v, want %v", pkg, got, want)
+		}
+	}
+
+	pin("libfoo 3-*\n")
+	c = &install.Ctx{Insecure: true}
+	if err := c.Packages([]string{"app"}, filepath.Join(tmpdir, "other"), "", false /* update */); err == nil {
+		t.Fatalf("install unexpectedly succeeded despite no version of app satisfying the pin of libfoo")
+	}
+}
+
+func TestPinOlderVersion(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "distritest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// One repository offering two versions of the same package. The
+	// unversioned meta file refers to the newest version:
+	repoDir := filepath.Join(tmpdir, "repo", "pkg")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var mm pb.MirrorMeta
+	for _, pkg := range []string{"hello-amd64-1.0-1", "hello-amd64-2.0-1"} {
+		writePackage(t, repoDir, pkg)
+		mm.Package = append(mm.Package, &pb.MirrorMeta_Package{
+			Name: proto.String(pkg),
+		})
+	}
+	b, err := proto.Marshal(&mm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "repo", "pkg", "meta.binaryproto"), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := filepath.Join(tmpdir, "cfg")
+	for _, dir := range []string{"repos.d", "pins.d"} {
+		if err := os.MkdirAll(filepath.Join(cfg, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg, "repos.d", "test.repo"), []byte(filepath.Join(tmpdir, "repo")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(cfg, "pins.d", "test.pins"), []byte("hello 1.*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	root := filepath.Join(tmpdir, "root")
+	c := &install.Ctx{Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", false /* update */); err != nil {
+		t.Fatal(err)
+	}
+	for pkg, want := range map[string]bool{
+		"hello-amd64-1.0-1": true,
+		"hello-amd64-2.0-1": false,
+	} {
+		_, err := os.Stat(filepath.Join(root, "roimg", pkg+".squashfs"))
+		if got := err == nil; got != want {
+			t.Errorf("installed(%s) = %v, want %v", pkg, got, want)
+		}
+	}
+}
+
+func TestRepoPriority(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "distritest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	for _, pkg := range []string{"hello-amd64-1.0-1", "hello-amd64-2.0-1"} {
+		repoDir := filepath.Join(tmpdir, pkg, "pkg")
+		if err := os.MkdirAll(repoDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writePackage(t, repoDir, pkg)
+	}
+
+	cfg := filepath.Join(tmpdir, "cfg")
+	if err := os.MkdirAll(filepath.Join(cfg, "repos.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The repository offering the older version has the higher priority:
+	repos := filepath.Join(tmpdir, "hello-amd64-2.0-1") + "\n" +
+		filepath.Join(tmpdir, "hello-amd64-1.0-1") + " priority=1\n"
+	if err := ioutil.WriteFile(filepath.Join(cfg, "repos.d", "test.repo"), []byte(repos), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := env.DistriConfig
+	env.DistriConfig = cfg
+	defer func() { env.DistriConfig = oldConfig }()
+
+	root := filepath.Join(tmpdir, "root")
+	c := &install.Ctx{Insecure: true}
+	if err := c.Packages([]string{"hello"}, root, "", false /* update */); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "roimg", "hello-amd64-1.0-1.squashfs")); err != nil {
+		t.Fatalf("package from higher-priority repository not installed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "roimg", "hello-amd64-2.0-1.squashfs")); err == nil {
+		t.Fatalf("package from lower-priority repository unexpectedly installed")
+	}
+}
@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/distr1/distri"
+	"github.com/google/renameio"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// IndexFile is the file name of the repository index within the pkg/
+	// directory of a repository. Its format matches the output of
+	// sha256sum(1), i.e. one “<hex digest>  <file name>” line per file.
+	IndexFile = "SHA256SUMS"
+
+	// IndexSignatureFile contains the ed25519 signature of IndexFile.
+	IndexSignatureFile = IndexFile + ".sig"
+)
+
+// ErrDigestMismatch is returned by Index.Verify if a file’s contents do not
+// match the digest recorded in the repository index.
+type ErrDigestMismatch struct {
+	Fn   string
+	Got  string
+	Want string
+}
+
+func (e *ErrDigestMismatch) Error() string {
+	return fmt.Sprintf("%s: SHA-256 digest mismatch: got %s, want %s", e.Fn, e.Got, e.Want)
+}
+
+// Index is a verified repository index, mapping file names (e.g.
+// zsh-amd64-5.6.2-3.squashfs) to their SHA-256 digest.
+type Index struct {
+	digests map[string]string
+}
+
+// ParseIndex parses the IndexFile contents b. It does not verify any
+// signatures, see FetchIndex for that.
+func ParseIndex(b []byte) (*Index, error) {
+	idx := &Index{digests: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			return nil, xerrors.Errorf("malformed index line %q", line)
+		}
+		if _, err := hex.DecodeString(parts[0]); err != nil || len(parts[0]) != 2*sha256.Size {
+			return nil, xerrors.Errorf("malformed digest in index line %q", line)
+		}
+		idx.digests[parts[1]] = parts[0]
+	}
+	return idx, scanner.Err()
+}
+
+// Verify returns an error unless digest (as returned by sha256.Sum) is the
+// digest which the index records for fn.
+func (i *Index) Verify(fn string, digest []byte) error {
+	want, ok := i.digests[fn]
+	if !ok {
+		return xerrors.Errorf("%s: not listed in repository index", fn)
+	}
+	if got := hex.EncodeToString(digest); got != want {
+		return &ErrDigestMismatch{Fn: fn, Got: got, Want: want}
+	}
+	return nil
+}
+
+func readAll(ctx context.Context, r distri.Repo, fn string) ([]byte, error) {
+	rd, err := Reader(ctx, r, fn, false)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	b, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	return b, rd.Close()
+}
+
+// FetchIndex downloads the index of repository r and returns it if it carries
+// a valid signature by any of keys.
+func FetchIndex(ctx context.Context, r distri.Repo, keys []ed25519.PublicKey) (*Index, error) {
+	b, err := readAll(ctx, r, IndexFile)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := readAll(ctx, r, IndexSignatureFile)
+	if err != nil {
+		return nil, err
+	}
+	var verified bool
+	for _, key := range keys {
+		if ed25519.Verify(key, b, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, xerrors.Errorf("%s/%s: signature not made by any trusted key", r.PkgPath, IndexFile)
+	}
+	return ParseIndex(b)
+}
+
+// WriteIndex computes the SHA-256 digest of all package images and meta files
+// in dir and writes them to IndexFile, signed with key.
+func WriteIndex(dir string, key ed25519.PrivateKey) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), ".squashfs") &&
+			!strings.HasSuffix(fi.Name(), ".meta.textproto") &&
+			fi.Name() != "meta.binaryproto" {
+			continue
+		}
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "%x  %s\n", h.Sum(nil), name)
+	}
+	if err := renameio.WriteFile(filepath.Join(dir, IndexFile), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	sig := ed25519.Sign(key, buf.Bytes())
+	return renameio.WriteFile(filepath.Join(dir, IndexSignatureFile), sig, 0644)
+}
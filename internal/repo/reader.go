@@ -91,6 +91,32 @@ func cacheFn(cache bool, repo distri.Repo, fn string) string {
 	return cacheFn
 }
 
+// NewRequest returns an HTTP request for url (located within repository r),
+// carrying the authentication token of r, if any. The token is only sent to
+// the host of r.Path: sections (see distri.Repo.Sections) might be located on
+// third-party mirrors.
+func NewRequest(ctx context.Context, r distri.Repo, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.AuthToken != "" && sameOrigin(r.Path, req.URL) {
+		req.Header.Set("Authorization", "Bearer "+r.AuthToken)
+	}
+	return req, nil
+}
+
+// sameOrigin returns whether u has the same scheme and host as the URL base.
+func sameOrigin(base string, u *url.URL) bool {
+	b, err := url.Parse(base)
+	if err != nil {
+		return false
+	}
+	return b.Host != "" &&
+		strings.EqualFold(b.Scheme, u.Scheme) &&
+		strings.EqualFold(b.Host, u.Host)
+}
+
 func Reader(ctx context.Context, repo distri.Repo, fn string, cache bool) (io.ReadCloser, error) {
 	if !strings.HasPrefix(repo.PkgPath, "http://") &&
 		!strings.HasPrefix(repo.PkgPath, "https://") {
@@ -105,7 +131,7 @@ func Reader(ctx context.Context, repo distri.Repo, fn string, cache bool) (io.Re
 		}
 	}
 
-	req, err := http.NewRequest("GET", repo.PkgPath+"/"+fn, nil) // TODO: sanitize slashes
+	req, err := NewRequest(ctx, repo, "GET", repo.PkgPath+"/"+fn) // TODO: sanitize slashes
 	if err != nil {
 		return nil, err
 	}
@@ -118,7 +144,7 @@ func Reader(ctx context.Context, repo distri.Repo, fn string, cache bool) (io.Re
 	// good for typical links (≤ gigabit)
 	// performance bottleneck for faster links (10 gbit/s+)
 	req.Header.Set("Accept-Encoding", "zstd, gzip")
-	resp, err := httpClient.Do(req.WithContext(ctx))
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
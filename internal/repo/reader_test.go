@@ -0,0 +1,35 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/distr1/distri"
+)
+
+func TestNewRequestAuthToken(t *testing.T) {
+	r := distri.Repo{
+		Path:      "https://repo.example.com/distri/jackherer",
+		AuthToken: "secret",
+		Sections: map[string]string{
+			"src": "https://mirror.example.net/distri/jackherer/src",
+		},
+	}
+	for _, tt := range []struct {
+		url  string
+		want string
+	}{
+		{"https://repo.example.com/distri/jackherer/pkg/meta.binaryproto", "Bearer secret"},
+		{"https://mirror.example.net/distri/jackherer/src/hello-amd64-2.10-3.squashfs", ""},
+		{"http://repo.example.com/distri/jackherer/pkg/meta.binaryproto", ""},
+		{"https://repo.example.com:8443/distri/jackherer/pkg/meta.binaryproto", ""},
+	} {
+		req, err := NewRequest(context.Background(), r, "GET", tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != tt.want {
+			t.Errorf("NewRequest(%s): Authorization = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package roimg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distr1/distri"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/renameio"
+	"google.golang.org/protobuf/encoding/prototext"
+)
+
+// GenerationsDir returns the directory in which the generations of the package
+// store of root are recorded.
+func GenerationsDir(root string) string {
+	return filepath.Join(root, "var", "lib", "distri", "generations")
+}
+
+// Packages returns the (sorted) names of all packages in the store, e.g.
+// glibc-amd64-2.31-4.
+func (s *Store) Packages() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.squashfs"))
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make([]string, 0, len(matches))
+	for _, m := range matches {
+		pkg := strings.TrimSuffix(filepath.Base(m), ".squashfs")
+		if !exists(filepath.Join(s.dir, pkg+".meta.textproto")) {
+			continue // incomplete
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	return pkgs, nil
+}
+
+// Modified reports whether packages were installed or removed since the store
+// was locked.
+func (s *Store) Modified() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal != nil
+}
+
+// kernel returns the most recent linux package of pkgs, if any.
+func kernel(pkgs []string) string {
+	var newest distri.PackageVersion
+	for _, pkg := range pkgs {
+		pv := distri.ParseVersion(pkg)
+		if pv.Pkg != "linux" {
+			continue
+		}
+		if newest.Pkg == "" || pv.Compare(newest) > 0 {
+			newest = pv
+		}
+	}
+	if newest.Pkg == "" {
+		return ""
+	}
+	return newest.String()
+}
+
+// InitGenerations records the current contents of the store as the first
+// generation (operation “initial”) of root, unless generations were already
+// recorded or the store is empty. Call InitGenerations before modifying the
+// store so that the state before the first recorded operation can be
+// restored.
+func (s *Store) InitGenerations(root string) error {
+	gens, err := Generations(root)
+	if err != nil {
+		return err
+	}
+	if len(gens) > 0 {
+		return nil
+	}
+	pkgs, err := s.Packages()
+	if err != nil {
+		return err
+	}
+	if len(pkgs) == 0 {
+		return nil
+	}
+	return s.RecordGeneration(root, &pb.Generation{
+		Operation: proto.String("initial"),
+	})
+}
+
+// RecordGeneration records the current contents of the store as a new
+// generation of root. The caller is expected to fill in the operation (and
+// pkgset, if applicable) of gen, all other fields are filled in by
+// RecordGeneration.
+func (s *Store) RecordGeneration(root string, gen *pb.Generation) error {
+	gens, err := Generations(root)
+	if err != nil {
+		return err
+	}
+	id := int64(1)
+	if len(gens) > 0 {
+		id = gens[len(gens)-1].GetId() + 1
+	}
+	pkgs, err := s.Packages()
+	if err != nil {
+		return err
+	}
+	gen.Id = proto.Int64(id)
+	gen.Timestamp = proto.Int64(time.Now().Unix())
+	gen.Package = pkgs
+	if k := kernel(pkgs); k != "" {
+		gen.Kernel = proto.String(k)
+	}
+	dir := GenerationsDir(root)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fn := filepath.Join(dir, strconv.FormatInt(id, 10)+".textproto")
+	return renameio.WriteFile(fn, []byte(proto.MarshalTextString(gen)), 0644)
+}
+
+// Changed reports whether the contents of the store differ from the most
+// recently recorded generation of root, e.g. because they were modified by
+// multiple install contexts, each of which did not record a generation.
+func (s *Store) Changed(root string) (bool, error) {
+	gens, err := Generations(root)
+	if err != nil {
+		return false, err
+	}
+	pkgs, err := s.Packages()
+	if err != nil {
+		return false, err
+	}
+	if len(gens) == 0 {
+		return len(pkgs) > 0, nil
+	}
+	recorded := gens[len(gens)-1].GetPackage()
+	if len(recorded) != len(pkgs) {
+		return true, nil
+	}
+	for idx, pkg := range pkgs {
+		if recorded[idx] != pkg {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Generations returns all recorded generations of root, sorted by id.
+func Generations(root string) ([]*pb.Generation, error) {
+	dir := GenerationsDir(root)
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // no generations recorded yet
+		}
+		return nil, err
+	}
+	var gens []*pb.Generation
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), ".textproto") {
+			continue
+		}
+		gen, err := readGeneration(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		gens = append(gens, gen)
+	}
+	sort.Slice(gens, func(i, j int) bool {
+		return gens[i].GetId() < gens[j].GetId()
+	})
+	return gens, nil
+}
+
+// Generation returns generation id of root.
+func Generation(root string, id int64) (*pb.Generation, error) {
+	fn := filepath.Join(GenerationsDir(root), strconv.FormatInt(id, 10)+".textproto")
+	gen, err := readGeneration(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("generation %d not found in %s", id, GenerationsDir(root))
+		}
+		return nil, err
+	}
+	return gen, nil
+}
+
+func readGeneration(fn string) (*pb.Generation, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var gen pb.Generation
+	if err := (prototext.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(b, &gen); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return &gen, nil
+}
@@ -0,0 +1,277 @@
+// Package roimg serializes and journals modifications of a distri package
+// store (e.g. /roimg), which are made by distri install, update, gc and reset.
+//
+// Modifying operations must hold the store lock, an flock(2) on the store
+// directory. Before modifying the store, each operation is recorded in a
+// journal, so that an interrupted operation can be rolled forward (or back)
+// when the lock is next acquired, instead of leaving e.g. a .squashfs file
+// without its .meta.textproto file. Once all recorded operations completed, the
+// journal is discarded.
+package roimg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// JournalFile is the name of the journal within the store directory.
+const JournalFile = "journal"
+
+// Store is a locked package store.
+type Store struct {
+	dir  string
+	lock *os.File // the store directory, locked using flock(2)
+
+	mu      sync.Mutex // protects journal and pending
+	journal *os.File   // opened lazily
+	// pending is the number of operations which were recorded in the journal,
+	// but did not complete (yet). Operations run concurrently (e.g. the
+	// installations of distri install), so the journal can only be truncated
+	// once none are pending.
+	pending int
+}
+
+// Lock acquires the lock for the package store in dir, blocking until other
+// processes release it, and recovers from interrupted operations, if any.
+func Lock(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if err != unix.EWOULDBLOCK {
+			f.Close()
+			return nil, xerrors.Errorf("flock(%s): %v", dir, err)
+		}
+		log.Printf("waiting for another distri process to release the lock on %s", dir)
+		if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+			f.Close()
+			return nil, xerrors.Errorf("flock(%s): %v", dir, err)
+		}
+	}
+	s := &Store{
+		dir:  dir,
+		lock: f,
+	}
+	if st, err := os.Stat(filepath.Join(dir, JournalFile)); err == nil && st.Size() > 0 {
+		log.Printf("recovering interrupted operations in package store %s", dir)
+	}
+	if err := s.recover(); err != nil {
+		f.Close()
+		return nil, xerrors.Errorf("recovering package store %s: %w", dir, err)
+	}
+	return s, nil
+}
+
+// Dir returns the store directory.
+func (s *Store) Dir() string { return s.dir }
+
+// Unlock discards the journal and releases the lock. An operation which failed
+// half-way is rolled forward or back first, just like when recovering from an
+// interrupted process.
+func (s *Store) Unlock() error {
+	// Closing the file descriptor releases the lock.
+	defer s.lock.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journal == nil {
+		return nil // no modifications
+	}
+	if err := s.journal.Close(); err != nil {
+		return err
+	}
+	s.journal = nil
+	if s.pending > 0 {
+		return s.recover()
+	}
+	if err := os.Remove(filepath.Join(s.dir, JournalFile)); err != nil {
+		return err
+	}
+	return s.syncDir()
+}
+
+// syncDir makes renames and removals within the store directory durable.
+func (s *Store) syncDir() error {
+	// s.lock is the store directory:
+	if err := s.lock.Sync(); err != nil {
+		return xerrors.Errorf("fsync(%s): %v", s.dir, err)
+	}
+	return nil
+}
+
+// record durably appends the operation line to the journal.
+func (s *Store) record(line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journal == nil {
+		f, err := os.OpenFile(filepath.Join(s.dir, JournalFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.journal = f
+		// Make the journal itself (not just its contents) survive a crash:
+		if err := s.syncDir(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.journal.WriteString(line + "\n"); err != nil {
+		return err
+	}
+	if err := s.journal.Sync(); err != nil {
+		return err
+	}
+	s.pending++
+	return nil
+}
+
+// done durably completes a recorded operation: the store directory is synced
+// and, unless other operations are still pending, the journal is truncated, so
+// that completed operations are not replayed. Replaying a completed operation
+// alongside pending ones is harmless.
+func (s *Store) done() error {
+	if err := s.syncDir(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+	if s.pending > 0 {
+		return nil
+	}
+	if err := s.journal.Truncate(0); err != nil {
+		return err
+	}
+	return s.journal.Sync()
+}
+
+// Install moves the files of package pkg (.meta.textproto and .squashfs) from
+// stagingDir into the store.
+func (s *Store) Install(pkg, stagingDir string) error {
+	if strings.ContainsAny(pkg, " \n") || strings.ContainsAny(stagingDir, "\n") {
+		return fmt.Errorf("BUG: invalid package name %q or staging directory %q", pkg, stagingDir)
+	}
+	if err := s.record("install " + pkg + " " + stagingDir); err != nil {
+		return err
+	}
+	if err := s.install(pkg, stagingDir); err != nil {
+		return err
+	}
+	return s.done()
+}
+
+func (s *Store) install(pkg, stagingDir string) error {
+	// First meta, then image: the fuse daemon considers the image canonical, so
+	// it must go last.
+	for _, fn := range []string{pkg + ".meta.textproto", pkg + ".squashfs"} {
+		if err := os.Rename(filepath.Join(stagingDir, fn), filepath.Join(s.dir, fn)); err != nil {
+			return err
+		}
+	}
+	return os.Remove(stagingDir)
+}
+
+// Remove deletes the files of package pkg from the store.
+func (s *Store) Remove(pkg string) error {
+	if strings.ContainsAny(pkg, " \n") {
+		return fmt.Errorf("BUG: invalid package name %q", pkg)
+	}
+	if err := s.record("remove " + pkg); err != nil {
+		return err
+	}
+	if err := s.remove(pkg); err != nil {
+		return err
+	}
+	return s.done()
+}
+
+func (s *Store) remove(pkg string) error {
+	for _, suffix := range []string{".meta.textproto", ".squashfs"} {
+		if err := os.Remove(filepath.Join(s.dir, pkg+suffix)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// recoverInstall rolls an interrupted installation forward if the staging
+// directory still contains the package, and back otherwise.
+func (s *Store) recoverInstall(pkg, stagingDir string) error {
+	for _, fn := range []string{pkg + ".meta.textproto", pkg + ".squashfs"} {
+		src := filepath.Join(stagingDir, fn)
+		if !exists(src) {
+			continue
+		}
+		log.Printf("recovery: completing installation of %s", fn)
+		if err := os.Rename(src, filepath.Join(s.dir, fn)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(stagingDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	meta := exists(filepath.Join(s.dir, pkg+".meta.textproto"))
+	image := exists(filepath.Join(s.dir, pkg+".squashfs"))
+	if meta != image {
+		log.Printf("recovery: rolling back incomplete installation of %s", pkg)
+		return s.remove(pkg)
+	}
+	return nil
+}
+
+// recover replays the journal of an interrupted process, if any.
+func (s *Store) recover() error {
+	fn := filepath.Join(s.dir, JournalFile)
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // clean shutdown
+		}
+		return err
+	}
+	lines := strings.Split(string(b), "\n")
+	// The last line is incomplete (or empty) if the process was interrupted
+	// while recording, in which case the operation was not started.
+	lines = lines[:len(lines)-1]
+	for _, line := range lines {
+		parts := strings.SplitN(line, " ", 3)
+		switch {
+		case len(parts) == 3 && parts[0] == "install":
+			if err := s.recoverInstall(parts[1], parts[2]); err != nil {
+				return err
+			}
+
+		case len(parts) == 2 && parts[0] == "remove":
+			log.Printf("recovery: completing removal of %s", parts[1])
+			if err := s.remove(parts[1]); err != nil {
+				return err
+			}
+
+		default:
+			log.Printf("recovery: skipping invalid journal line %q", line)
+		}
+	}
+	if err := s.syncDir(); err != nil {
+		return err
+	}
+	if err := os.Remove(fn); err != nil {
+		return err
+	}
+	s.pending = 0
+	return s.syncDir()
+}
@@ -0,0 +1,340 @@
+package roimg_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distr1/distri/internal/distritest"
+	"github.com/distr1/distri/internal/roimg"
+	"github.com/distr1/distri/pb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/sync/errgroup"
+)
+
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestInstallRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-roimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer distritest.RemoveAll(t, dir)
+
+	st, err := roimg.Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staging := filepath.Join(dir, "tmp", ".hello-amd64-1")
+	writeFiles(t, staging, "hello-amd64-1.meta.textproto", "hello-amd64-1.squashfs")
+	if err := st.Install("hello-amd64-1", staging); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []string{"hello-amd64-1.meta.textproto", "hello-amd64-1.squashfs"} {
+		if !exists(filepath.Join(dir, fn)) {
+			t.Errorf("%s not installed", fn)
+		}
+	}
+	if exists(staging) {
+		t.Errorf("staging directory %s not removed", staging)
+	}
+	// Completed operations must not be replayed when unlocking:
+	if st, err := os.Stat(filepath.Join(dir, roimg.JournalFile)); err != nil {
+		t.Fatal(err)
+	} else if st.Size() != 0 {
+		t.Errorf("journal unexpectedly not truncated after Install")
+	}
+	if err := st.Remove("hello-amd64-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []string{"hello-amd64-1.meta.textproto", "hello-amd64-1.squashfs", roimg.JournalFile} {
+		if exists(filepath.Join(dir, fn)) {
+			t.Errorf("%s unexpectedly exists", fn)
+		}
+	}
+}
+
+func TestInstallConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-roimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer distritest.RemoveAll(t, dir)
+
+	st, err := roimg.Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Unlock()
+	var eg errgroup.Group
+	for i := 0; i < 10; i++ {
+		pkg := fmt.Sprintf("hello%d-amd64-1", i)
+		staging := filepath.Join(dir, "tmp", "."+pkg)
+		writeFiles(t, staging, pkg+".meta.textproto", pkg+".squashfs")
+		eg.Go(func() error { return st.Install(pkg, staging) })
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := os.Stat(filepath.Join(dir, roimg.JournalFile)); err != nil {
+		t.Fatal(err)
+	} else if st.Size() != 0 {
+		t.Errorf("journal unexpectedly not truncated after all installations completed")
+	}
+}
+
+func TestInstallConcurrentFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-roimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer distritest.RemoveAll(t, dir)
+
+	st, err := roimg.Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The installation of broken-amd64-1 fails half-way (its staging directory
+	// lacks the image), like when the process crashes. Completing the
+	// installation of hello-amd64-1, which could run concurrently (like in
+	// distri install), must not discard the journal entry of broken-amd64-1.
+	hello := filepath.Join(dir, "tmp", ".hello-amd64-1")
+	writeFiles(t, hello, "hello-amd64-1.meta.textproto", "hello-amd64-1.squashfs")
+	broken := filepath.Join(dir, "tmp", ".broken-amd64-1")
+	writeFiles(t, broken, "broken-amd64-1.meta.textproto")
+	if err := st.Install("broken-amd64-1", broken); err == nil {
+		t.Fatalf("Install(broken-amd64-1) unexpectedly succeeded")
+	}
+	if err := st.Install("hello-amd64-1", hello); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := os.Stat(filepath.Join(dir, roimg.JournalFile)); err != nil {
+		t.Fatal(err)
+	} else if st.Size() == 0 {
+		t.Fatalf("journal unexpectedly truncated while an operation is pending")
+	}
+	if err := st.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []struct {
+		fn   string
+		want bool
+	}{
+		{"hello-amd64-1.meta.textproto", true},
+		{"hello-amd64-1.squashfs", true},
+		{"broken-amd64-1.meta.textproto", false},
+		{roimg.JournalFile, false},
+	} {
+		if got := exists(filepath.Join(dir, entry.fn)); got != entry.want {
+			t.Errorf("exists(%s) = %v, want %v", entry.fn, got, entry.want)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-roimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer distritest.RemoveAll(t, dir)
+
+	// Simulate a process which was interrupted:
+	//
+	// 1. while installing rollforward-amd64-1 (meta already moved, image still
+	//    in the staging directory),
+	// 2. after its staging directory of rollback-amd64-1 was lost (only the
+	//    meta was moved),
+	// 3. while removing gc-amd64-1 (meta already removed),
+	// 4. while recording the installation of incomplete-amd64-1.
+	forward := filepath.Join(dir, "tmp", ".rollforward-amd64-1")
+	writeFiles(t, forward, "rollforward-amd64-1.squashfs")
+	writeFiles(t, dir,
+		"rollforward-amd64-1.meta.textproto",
+		"rollback-amd64-1.meta.textproto",
+		"gc-amd64-1.squashfs",
+		"keep-amd64-1.meta.textproto",
+		"keep-amd64-1.squashfs")
+	journal := "install rollforward-amd64-1 " + forward + "\n" +
+		"install rollback-amd64-1 " + filepath.Join(dir, "tmp", ".rollback-amd64-1") + "\n" +
+		"remove gc-amd64-1\n" +
+		"install incomplete-amd64-1 " + dir
+	if err := ioutil.WriteFile(filepath.Join(dir, roimg.JournalFile), []byte(journal), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := roimg.Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Unlock()
+
+	for _, entry := range []struct {
+		fn   string
+		want bool
+	}{
+		{"rollforward-amd64-1.meta.textproto", true},
+		{"rollforward-amd64-1.squashfs", true},
+		{"tmp/.rollforward-amd64-1", false},
+		{"rollback-amd64-1.meta.textproto", false},
+		{"gc-amd64-1.squashfs", false},
+		{"keep-amd64-1.meta.textproto", true},
+		{"keep-amd64-1.squashfs", true},
+		{roimg.JournalFile, false},
+	} {
+		if got := exists(filepath.Join(dir, entry.fn)); got != entry.want {
+			t.Errorf("exists(%s) = %v, want %v", entry.fn, got, entry.want)
+		}
+	}
+	// The incomplete journal entry must not have touched the store directory.
+	if !exists(dir) {
+		t.Fatalf("store directory %s removed", dir)
+	}
+}
+
+func TestLockExclusive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "distri-roimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer distritest.RemoveAll(t, dir)
+
+	st, err := roimg.Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan *roimg.Store)
+	go func() {
+		st, err := roimg.Lock(dir)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- st
+	}()
+	select {
+	case <-locked:
+		t.Fatalf("second Lock unexpectedly succeeded while the lock is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := st.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case st := <-locked:
+		if st != nil {
+			st.Unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second Lock did not succeed after Unlock")
+	}
+}
+
+func TestGenerations(t *testing.T) {
+	root, err := ioutil.TempDir("", "distri-roimg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer distritest.RemoveAll(t, root)
+
+	st, err := roimg.Lock(filepath.Join(root, "roimg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Unlock()
+
+	// An empty store does not result in an initial generation.
+	if err := st.InitGenerations(root); err != nil {
+		t.Fatal(err)
+	}
+	gens, err := roimg.Generations(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gens) != 0 {
+		t.Fatalf("unexpected generations for empty store: %v", gens)
+	}
+
+	for _, pkg := range []string{"linux-amd64-5.4.6-10", "linux-amd64-5.5.2-12", "glibc-amd64-2.31-4"} {
+		staging := filepath.Join(root, "roimg", "tmp", "."+pkg)
+		writeFiles(t, staging, pkg+".meta.textproto", pkg+".squashfs")
+		if err := st.Install(pkg, staging); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !st.Modified() {
+		t.Fatalf("store unexpectedly not modified after Install")
+	}
+	if err := st.RecordGeneration(root, &pb.Generation{
+		Operation: proto.String("install"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := st.Changed(root); err != nil {
+		t.Fatal(err)
+	} else if changed {
+		t.Errorf("store unexpectedly changed after RecordGeneration")
+	}
+	if err := st.Remove("linux-amd64-5.4.6-10"); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := st.Changed(root); err != nil {
+		t.Fatal(err)
+	} else if !changed {
+		t.Errorf("store unexpectedly not changed after Remove")
+	}
+	if err := st.RecordGeneration(root, &pb.Generation{
+		Operation: proto.String("gc"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	gens, err = roimg.Generations(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(gens), 2; got != want {
+		t.Fatalf("unexpected number of generations: got %d, want %d", got, want)
+	}
+	want := &pb.Generation{
+		Id:        proto.Int64(1),
+		Timestamp: gens[0].Timestamp,
+		Operation: proto.String("install"),
+		Package:   []string{"glibc-amd64-2.31-4", "linux-amd64-5.4.6-10", "linux-amd64-5.5.2-12"},
+		Kernel:    proto.String("linux-amd64-5.5.2-12"),
+	}
+	if !proto.Equal(gens[0], want) {
+		t.Errorf("unexpected generation: got %v, want %v", gens[0], want)
+	}
+
+	gen, err := roimg.Generation(root, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := gen.GetPackage(), []string{"glibc-amd64-2.31-4", "linux-amd64-5.5.2-12"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("generation 2: unexpected packages: got %v, want %v", got, want)
+	}
+	if _, err := roimg.Generation(root, 3); err == nil {
+		t.Errorf("Generation(3) unexpectedly succeeded")
+	}
+}
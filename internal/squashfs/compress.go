@@ -0,0 +1,156 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm used for compressing data blocks.
+type Compression uint16
+
+// Compression algorithms supported by this package.
+const (
+	ZlibCompression Compression = zlibCompression
+	ZstdCompression Compression = zstdCompression
+)
+
+func (c Compression) String() string {
+	switch c {
+	case zlibCompression:
+		return "zlib"
+	case lzmaCompression:
+		return "lzma"
+	case lzoCompression:
+		return "lzo"
+	case xzCompression:
+		return "xz"
+	case lz4Compression:
+		return "lz4"
+	case zstdCompression:
+		return "zstd"
+	}
+	return fmt.Sprintf("unknown compression %d", uint16(c))
+}
+
+// ParseCompression returns the Compression corresponding to name (e.g. zstd).
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "zlib":
+		return ZlibCompression, nil
+	case "zstd":
+		return ZstdCompression, nil
+	}
+	return 0, fmt.Errorf("unsupported compression %q (supported: zlib, zstd)", name)
+}
+
+// compressor compresses data blocks. Implementations are not safe for
+// concurrent use, which matches the Writer.
+type compressor interface {
+	compress(dst *bytes.Buffer, block []byte) error
+}
+
+type zlibCompressor struct {
+	zw *zlib.Writer
+}
+
+func (c *zlibCompressor) compress(dst *bytes.Buffer, block []byte) error {
+	c.zw.Reset(dst)
+	if _, err := c.zw.Write(block); err != nil {
+		return err
+	}
+	return c.zw.Close()
+}
+
+type zstdCompressor struct {
+	enc *zstd.Encoder
+	buf []byte // re-used across blocks to avoid allocations
+}
+
+func (c *zstdCompressor) compress(dst *bytes.Buffer, block []byte) error {
+	c.buf = c.enc.EncodeAll(block, c.buf[:0])
+	_, err := dst.Write(c.buf)
+	return err
+}
+
+func newCompressor(c Compression) (compressor, error) {
+	switch c {
+	case ZlibCompression:
+		// zlib.BestSpeed results in only a 2x slow-down over no compression
+		// (compared to >4x slow-down with DefaultCompression), but generates
+		// results which are in the same ball park (10% larger).
+		zw, err := zlib.NewWriterLevel(nil, zlib.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		return &zlibCompressor{zw: zw}, nil
+
+	case ZstdCompression:
+		enc, err := zstd.NewWriter(nil,
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithEncoderCRC(false))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdCompressor{enc: enc}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression %v", c)
+}
+
+// decompressor decompresses data and metadata blocks. Implementations must be
+// safe for concurrent use, as the FUSE daemon reads concurrently.
+type decompressor interface {
+	// decompress appends the decompressed contents of block to dst.
+	decompress(dst, block []byte) ([]byte, error)
+}
+
+type zlibDecompressor struct{}
+
+func (zlibDecompressor) decompress(dst, block []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	buf := bytes.NewBuffer(dst)
+	if _, err := io.Copy(buf, zr); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type zstdDecompressor struct {
+	dec *zstd.Decoder
+}
+
+func (d *zstdDecompressor) decompress(dst, block []byte) ([]byte, error) {
+	return d.dec.DecodeAll(block, dst)
+}
+
+type unsupportedDecompressor struct {
+	c Compression
+}
+
+func (d *unsupportedDecompressor) decompress(dst, block []byte) ([]byte, error) {
+	return nil, fmt.Errorf("reading %v compressed blocks is not supported", d.c)
+}
+
+func newDecompressor(c Compression) (decompressor, error) {
+	switch c {
+	case ZlibCompression:
+		return zlibDecompressor{}, nil
+
+	case ZstdCompression:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		return &zstdDecompressor{dec: dec}, nil
+	}
+	// Images using other compression algorithms can still be read as long as
+	// they do not contain compressed blocks.
+	return &unsupportedDecompressor{c: c}, nil
+}
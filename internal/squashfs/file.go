@@ -0,0 +1,269 @@
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// fileInode contains the information required to read the contents of a
+// regular file (fileType or lregType inode).
+type fileInode struct {
+	startBlock int64
+	fileSize   int64
+	fragment   uint32
+	offset     uint32
+
+	// blocksizes contains the on-disk size of each data block, possibly with
+	// the uncompressedBlock bit set. A size of 0 denotes a sparse block.
+	blocksizes []uint32
+}
+
+func (r *Reader) readFileInode(i Inode) (*fileInode, error) {
+	blockoffset, offset := r.inode(i)
+	br, err := r.blockReader(r.super.InodeTableStart+blockoffset, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer br.Close()
+
+	// We need the inode type before we know which type to pass to binary.Read,
+	// so we need to read it twice:
+	var inodeType uint16
+	typeBuf := bytes.NewBuffer(make([]byte, 0, binary.Size(inodeType)))
+	if err := binary.Read(io.TeeReader(br, typeBuf), binary.LittleEndian, &inodeType); err != nil {
+		return nil, err
+	}
+	rd := io.MultiReader(typeBuf, br)
+
+	var fi fileInode
+	switch inodeType {
+	case fileType:
+		var ri regInodeHeader
+		if err := binary.Read(rd, binary.LittleEndian, &ri); err != nil {
+			return nil, err
+		}
+		fi = fileInode{
+			startBlock: int64(ri.StartBlock),
+			fileSize:   int64(ri.FileSize),
+			fragment:   ri.Fragment,
+			offset:     ri.Offset,
+		}
+
+	case lregType:
+		var ri lregInodeHeader
+		if err := binary.Read(rd, binary.LittleEndian, &ri); err != nil {
+			return nil, err
+		}
+		fi = fileInode{
+			startBlock: int64(ri.StartBlock),
+			fileSize:   int64(ri.FileSize),
+			fragment:   ri.Fragment,
+			offset:     ri.Offset,
+		}
+
+	default:
+		return nil, fmt.Errorf("BUG: non-file inode type")
+	}
+
+	blockSize := int64(r.super.BlockSize)
+	blocks := fi.fileSize / blockSize
+	if fi.fragment == invalidFragment && fi.fileSize%blockSize > 0 {
+		blocks++ // the tail end of the file is stored in a partial block
+	}
+	fi.blocksizes = make([]uint32, blocks)
+	if err := binary.Read(rd, binary.LittleEndian, fi.blocksizes); err != nil {
+		return nil, err
+	}
+	return &fi, nil
+}
+
+// readFragmentEntry returns the fragment table entry for fragment idx.
+func (r *Reader) readFragmentEntry(idx uint32) (*fragmentEntry, error) {
+	if idx >= r.super.Fragments {
+		return nil, fmt.Errorf("fragment %d out of range [0, %d)", idx, r.super.Fragments)
+	}
+	var fe fragmentEntry
+	if err := r.readLookupTableEntry(r.super.FragmentTableStart, idx, &fe); err != nil {
+		return nil, err
+	}
+	return &fe, nil
+}
+
+// File provides access to the contents of a regular file, transparently
+// decompressing data blocks. It is safe for concurrent use via ReadAt, but not
+// via Read and Seek.
+type File struct {
+	r         *Reader
+	size      int64
+	blockSize int64
+
+	// blockOffsets contains the offset of each data block within the image.
+	blockOffsets []int64
+	blocksizes   []uint32
+
+	// fragment is non-nil if the tail end of the file is packed into a
+	// fragment block, at fragmentOffset.
+	fragment       *fragmentEntry
+	fragmentOffset int64
+
+	// section is non-nil if the file is stored in uncompressed contiguous
+	// blocks, in which case data can be read directly from the image.
+	section *io.SectionReader
+
+	off int64 // for Read and Seek
+
+	mu          sync.Mutex
+	cachedBlock int    // index of the block in cache (len(blocksizes) for the fragment block), or -1
+	cache       []byte // decompressed contents of cachedBlock
+	compBuf     []byte // compressed block data, re-used to avoid allocations
+}
+
+func (r *Reader) newFile(fi *fileInode, fragment *fragmentEntry) *File {
+	f := &File{
+		r:              r,
+		size:           fi.fileSize,
+		blockSize:      int64(r.super.BlockSize),
+		blockOffsets:   make([]int64, len(fi.blocksizes)),
+		blocksizes:     fi.blocksizes,
+		fragment:       fragment,
+		fragmentOffset: int64(fi.offset),
+		cachedBlock:    -1,
+	}
+	contiguous := fragment == nil
+	off := fi.startBlock
+	for idx, size := range fi.blocksizes {
+		f.blockOffsets[idx] = off
+		if size&uncompressedBlock == 0 {
+			contiguous = false // compressed or sparse block
+		}
+		off += int64(size &^ uncompressedBlock)
+	}
+	if contiguous {
+		f.section = io.NewSectionReader(r.r, fi.startBlock, fi.fileSize)
+	}
+	return f
+}
+
+// Size returns the (uncompressed) size of the file in bytes.
+func (f *File) Size() int64 { return f.size }
+
+// readBlock copies the contents of block idx, starting at off, into p. Block
+// idx == len(f.blocksizes) refers to the tail end of the file, which is stored
+// in a fragment block.
+func (f *File) readBlock(p []byte, idx int, off int64) (int, error) {
+	blockLen := f.blockSize
+	if rest := f.size - int64(idx)*f.blockSize; rest < blockLen {
+		blockLen = rest
+	}
+	if int64(len(p)) > blockLen-off {
+		p = p[:blockLen-off]
+	}
+	var (
+		size    uint32
+		diskOff int64
+		start   int64 // offset of the file data within the decompressed block
+	)
+	if idx < len(f.blocksizes) {
+		size = f.blocksizes[idx]
+		diskOff = f.blockOffsets[idx]
+	} else {
+		if f.fragment == nil {
+			return 0, fmt.Errorf("BUG: block %d out of range, but no fragment", idx)
+		}
+		size = f.fragment.Size
+		diskOff = int64(f.fragment.StartBlock)
+		start = f.fragmentOffset
+	}
+	switch {
+	case size == 0: // sparse block
+		for i := range p {
+			p[i] = 0
+		}
+		return len(p), nil
+
+	case size&uncompressedBlock != 0:
+		return f.r.r.ReadAt(p, diskOff+start+off)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cachedBlock != idx {
+		if int(size) > cap(f.compBuf) {
+			f.compBuf = make([]byte, int(size))
+		}
+		f.compBuf = f.compBuf[:size]
+		if _, err := f.r.r.ReadAt(f.compBuf, diskOff); err != nil {
+			return 0, err
+		}
+		var err error
+		f.cachedBlock = -1
+		f.cache, err = f.r.decomp.decompress(f.cache[:0], f.compBuf)
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(f.cache)) < start+blockLen {
+			return 0, fmt.Errorf("corrupt data block: decompressed to %d bytes, want at least %d", len(f.cache), start+blockLen)
+		}
+		f.cachedBlock = idx
+	}
+	return copy(p, f.cache[start+off:start+blockLen]), nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.section != nil {
+		return f.section.ReadAt(p, off)
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	for n < len(p) && off < f.size {
+		idx := off / f.blockSize
+		nn, err := f.readBlock(p[n:], int(idx), off-idx*f.blockSize)
+		n += nn
+		off += int64(nn)
+		if err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (f *File) Read(p []byte) (n int, err error) {
+	n, err = f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil // return io.EOF in the next call, like io.SectionReader
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, fmt.Errorf("Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("Seek: invalid offset")
+	}
+	f.off = offset
+	return offset, nil
+}
+
+var (
+	_ io.ReadSeeker = (*File)(nil)
+	_ io.ReaderAt   = (*File)(nil)
+)
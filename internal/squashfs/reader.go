@@ -18,8 +18,9 @@ import (
 )
 
 type Reader struct {
-	r     io.ReaderAt
-	super superblock
+	r      io.ReaderAt
+	super  superblock
+	decomp decompressor
 }
 
 func NewReader(r io.ReaderAt) (*Reader, error) {
@@ -33,13 +34,26 @@ func NewReader(r io.ReaderAt) (*Reader, error) {
 		return nil, fmt.Errorf("invalid magic (not a SquashFS image?): got %x, want %x", got, want)
 	}
 
+	decomp, err := newDecompressor(Compression(sb.Compression))
+	if err != nil {
+		return nil, err
+	}
+
 	//log.Printf("superblock: %+v", sb)
 	return &Reader{
-		r:     r,
-		super: sb,
+		r:      r,
+		super:  sb,
+		decomp: decomp,
 	}, nil
 }
 
+// MetadataRange returns the byte range [start, end) of the image which holds its
+// metadata (inode, directory and lookup tables), as opposed to file contents.
+// Readers of remote images can prefetch this range.
+func (r *Reader) MetadataRange() (start, end int64) {
+	return r.super.InodeTableStart, r.super.BytesUsed
+}
+
 // TODO: maybe mmap instead of seeking?
 
 func (r *Reader) inode(i Inode) (blockoffset int64, offset int64) {
@@ -48,10 +62,14 @@ func (r *Reader) inode(i Inode) (blockoffset int64, offset int64) {
 
 type blockReader struct {
 	r      io.ReadSeeker
+	decomp decompressor
 	lenBuf [2]byte
 	buf    []byte
 	i      int64
 
+	// compBuf holds a compressed metadata block before decompression.
+	compBuf []byte
+
 	off int64 // TODO: remove this once using mmap
 }
 
@@ -62,15 +80,29 @@ func (br *blockReader) Read(p []byte) (n int, err error) {
 			return 0, err
 		}
 		l := binary.LittleEndian.Uint16(br.lenBuf[:])
-		//uncompressed := l&0x8000 > 0
+		uncompressed := l&0x8000 > 0
 		l &= 0x7FFF
 		//log.Printf("block of len %d, uncompressed: %v", l, uncompressed)
-		if int(l) > cap(br.buf) {
-			br.buf = make([]byte, int(l))
-		}
-		br.buf = br.buf[:l]
-		if _, err := io.ReadFull(br.r, br.buf); err != nil {
-			return 0, err
+		if uncompressed {
+			if int(l) > cap(br.buf) {
+				br.buf = make([]byte, int(l))
+			}
+			br.buf = br.buf[:l]
+			if _, err := io.ReadFull(br.r, br.buf); err != nil {
+				return 0, err
+			}
+		} else {
+			if int(l) > cap(br.compBuf) {
+				br.compBuf = make([]byte, int(l))
+			}
+			br.compBuf = br.compBuf[:l]
+			if _, err := io.ReadFull(br.r, br.compBuf); err != nil {
+				return 0, err
+			}
+			br.buf, err = br.decomp.decompress(br.buf[:0], br.compBuf)
+			if err != nil {
+				return 0, err
+			}
 		}
 		//log.Printf("(retry) n = %v, err = %v", n, err)
 	}
@@ -97,6 +129,7 @@ func (r *Reader) blockReader(blockoffset, offset int64) (io.ReadCloser, error) {
 	br := blockReaderPool.Get().(*blockReader)
 	br.buf = br.buf[:0]
 	br.r = io.NewSectionReader(r.r, blockoffset, 5500*1024*1024) // TODO: correct limit? can we use IntMax
+	br.decomp = r.decomp
 	br.off = blockoffset
 	br.i = 0
 	//log.Printf("discarding %d bytes", offset)
@@ -175,23 +208,63 @@ func (r *Reader) readInode(i Inode) (interface{}, error) {
 		}
 		return di, nil
 
+	case blkdevType, chrdevType, lblkdevType, lchrdevType:
+		// The larger types only add an xattr field at the end, which is
+		// ignored.
+		var di devInodeHeader
+		if err := binary.Read(br, binary.LittleEndian, &di); err != nil {
+			return nil, err
+		}
+		return di, nil
+
+	case fifoType, socketType, lfifoType, lsocketType:
+		var ii ipcInodeHeader
+		if err := binary.Read(br, binary.LittleEndian, &ii); err != nil {
+			return nil, err
+		}
+		return ii, nil
+
 		// TODO:
-		// blkdevType
-		// chrdevType
-		// fifoType
-		// socketType
-		// // The larger types are used for e.g. sparse files, xattrs, etc.
-		// ldirType
 		// lsymlinkType
-		// lblkdevType
-		// lchrdevType
-		// lfifoType
-		// lsocketType
 
 	}
 	return nil, fmt.Errorf("unknown inode type %d", inodeType)
 }
 
+// readLookupTableEntry reads entry idx of the lookup table (e.g. the fragment
+// or export table) whose index starts at tableStart into v.
+func (r *Reader) readLookupTableEntry(tableStart int64, idx uint32, v interface{}) error {
+	entriesPerBlock := uint32(metadataBlockSize / binary.Size(v))
+	var blockoffset uint64
+	indexOff := tableStart + int64(idx/entriesPerBlock)*8 /* sizeof(uint64) */
+	if err := binary.Read(io.NewSectionReader(r.r, indexOff, 8), binary.LittleEndian, &blockoffset); err != nil {
+		return err
+	}
+	br, err := r.blockReader(int64(blockoffset), int64(idx%entriesPerBlock)*int64(binary.Size(v)))
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+	return binary.Read(br, binary.LittleEndian, v)
+}
+
+// InodeByNumber returns the inode with the specified inode number (starting at
+// 1), which requires the image to contain an export table (see
+// WithExportTable).
+func (r *Reader) InodeByNumber(num uint32) (Inode, error) {
+	if r.super.LookupTableStart == -1 {
+		return 0, fmt.Errorf("image does not contain an export table")
+	}
+	if num == 0 || num > r.super.Inodes {
+		return 0, fmt.Errorf("inode number %d out of range [1, %d]", num, r.super.Inodes)
+	}
+	var i Inode
+	if err := r.readLookupTableEntry(r.super.LookupTableStart, num-1, &i); err != nil {
+		return 0, err
+	}
+	return i, nil
+}
+
 func (r *Reader) RootInode() Inode {
 	return r.super.RootInode
 }
@@ -255,6 +328,31 @@ func (r *Reader) Stat(name string, i Inode) (os.FileInfo, error) {
 			modTime: time.Unix(int64(x.Mtime), 0),
 			Inode:   i,
 		}, nil
+
+	case devInodeHeader:
+		mode := os.ModeDevice | os.FileMode(x.Mode&0777)
+		if x.InodeType == chrdevType || x.InodeType == lchrdevType {
+			mode |= os.ModeCharDevice
+		}
+		return &FileInfo{
+			name:    name,
+			mode:    mode,
+			modTime: time.Unix(int64(x.Mtime), 0),
+			rdev:    x.Rdev,
+			Inode:   i,
+		}, nil
+
+	case ipcInodeHeader:
+		mode := os.ModeNamedPipe
+		if x.InodeType == socketType || x.InodeType == lsocketType {
+			mode = os.ModeSocket
+		}
+		return &FileInfo{
+			name:    name,
+			mode:    mode | os.FileMode(x.Mode&0777),
+			modTime: time.Unix(int64(x.Mtime), 0),
+			Inode:   i,
+		}, nil
 	}
 
 	return nil, fmt.Errorf("unknown inode type %T", inode)
@@ -294,24 +392,22 @@ func (r *Reader) ReadLink(i Inode) (string, error) {
 	return string(buf), nil
 }
 
-func (r *Reader) FileReader(inode Inode) (*io.SectionReader, error) {
+// FileReader returns a File providing access to the contents of the regular
+// file at inode.
+func (r *Reader) FileReader(inode Inode) (*File, error) {
 	//log.Printf("Readfile(%v)", inode)
-	i, err := r.readInode(inode)
+	fi, err := r.readFileInode(inode)
 	if err != nil {
 		return nil, err
 	}
-	//log.Printf("i: %+v", i)
-	// TODO(compression): read the blocksizes to read compressed blocks
-	switch ri := i.(type) {
-	case regInodeHeader:
-		off := int64(ri.StartBlock) + int64(ri.Offset)
-		return io.NewSectionReader(r.r, off, int64(ri.FileSize)), nil
-	case lregInodeHeader:
-		off := int64(ri.StartBlock) + int64(ri.Offset)
-		return io.NewSectionReader(r.r, off, int64(ri.FileSize)), nil
-	default:
-		return nil, fmt.Errorf("BUG: non-file inode type")
+	var fragment *fragmentEntry
+	if fi.fragment != invalidFragment {
+		fragment, err = r.readFragmentEntry(fi.fragment)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return r.newFile(fi, fragment), nil
 }
 
 type FileNotFoundError struct {
@@ -486,6 +582,14 @@ func (r *Reader) readdir(dirInode Inode, stat bool) ([]os.FileInfo, error) {
 					ffi.mode |= os.ModeDir
 				case symlinkType, lsymlinkType:
 					ffi.mode |= os.ModeSymlink
+				case blkdevType, lblkdevType:
+					ffi.mode |= os.ModeDevice
+				case chrdevType, lchrdevType:
+					ffi.mode |= os.ModeDevice | os.ModeCharDevice
+				case fifoType, lfifoType:
+					ffi.mode |= os.ModeNamedPipe
+				case socketType, lsocketType:
+					ffi.mode |= os.ModeSocket
 				}
 				fi = ffi
 			}
@@ -501,6 +605,7 @@ type FileInfo struct {
 	size    int64
 	mode    os.FileMode
 	modTime time.Time
+	rdev    uint32 // device numbers, encoded as per encodeDev
 	Inode   Inode
 }
 
@@ -511,6 +616,9 @@ func (fi *FileInfo) IsDir() bool        { return fi.mode.IsDir() }
 func (fi *FileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *FileInfo) Sys() interface{}   { return fi }
 
+// Rdev returns the major and minor device numbers of a device file.
+func (fi *FileInfo) Rdev() (major, minor uint32) { return decodeDev(fi.rdev) }
+
 func (r *Reader) readXattr(tableHeader xattrTableHeader, id xattrId) (*Xattr, error) {
 	blockoffset, offset := r.inode(Inode(id.Xattr))
 	br, err := r.blockReader(int64(tableHeader.XattrTableStart)+blockoffset, offset)
@@ -1,19 +1,20 @@
-// Package squashfs implements writing SquashFS file system images using zlib
-// compression for data blocks (inodes and directory entries are written
-// uncompressed for simplicity).
+// Package squashfs implements writing SquashFS file system images, optionally
+// using zlib or zstd compression for data blocks (inodes and directory entries
+// are written uncompressed for simplicity).
 //
 // Note that SquashFS requires directory entries to be sorted, i.e. files and
 // directories need to be added in the correct order.
 //
 // This package intentionally only implements a subset of SquashFS. Notably,
-// block devices, character devices, FIFOs, sockets and xattrs are not
-// supported.
+// only one xattr per file is supported.
 package squashfs
 
 import (
 	"bytes"
-	"compress/zlib"
+	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -32,6 +33,7 @@ const (
 	lzoCompression
 	xzCompression
 	lz4Compression
+	zstdCompression
 )
 
 const (
@@ -264,6 +266,36 @@ func writeIdTable(w io.WriteSeeker, ids []uint32) (start int64, err error) {
 	return off, binary.Write(w, binary.LittleEndian, metaOff)
 }
 
+// fragmentEntry describes one fragment block in the fragment table.
+type fragmentEntry struct {
+	StartBlock uint64
+	Size       uint32 // on-disk size, possibly with uncompressedBlock set
+	Unused     uint32
+}
+
+// fileData describes where the contents of a regular file are stored, so that
+// files with identical contents can share them.
+type fileData struct {
+	size       uint32
+	startBlock uint64
+	blocksizes []uint32
+	fragment   uint32
+	offset     uint32
+}
+
+// inodeRef describes a previously written inode, which can be referred to by
+// hard links.
+type inodeRef struct {
+	startBlock  uint32
+	offset      uint16
+	inodeNumber uint32
+	entryType   uint16
+
+	// nlinkOffset is the offset of the Nlink field within inodeBuf.
+	nlinkOffset int
+	nlink       uint32
+}
+
 type fullDirEntry struct {
 	startBlock  uint32
 	offset      uint16
@@ -278,6 +310,10 @@ const (
 	metadataBlockSize = 8192
 	majorVersion      = 4
 	minorVersion      = 0
+
+	// uncompressedBlock is set in the size of data blocks which are stored
+	// uncompressed (SQUASHFS_COMPRESSED_BIT_BLOCK).
+	uncompressedBlock = 1 << 24
 )
 
 type Writer struct {
@@ -294,7 +330,58 @@ type Writer struct {
 	inodeBuf bytes.Buffer
 	dirBuf   bytes.Buffer
 
+	// fragBuf accumulates file tails (and small files), which are packed into
+	// fragment blocks instead of occupying a data block of their own.
+	fragBuf   bytes.Buffer
+	fragments []fragmentEntry
+
+	// compressor is nil if data blocks are stored uncompressed.
+	compressor compressor
+	// compBuf is used for holding a block during compression to avoid memory
+	// allocations.
+	compBuf bytes.Buffer
+
 	writeInodeNumTo map[string][]int64
+
+	// dataBySum maps the SHA-256 sum of file contents to the location of the
+	// contents, for de-duplication.
+	dataBySum map[[sha256.Size]byte]*fileData
+
+	// inodeByPath maps the path of files and symlinks (relative to the file
+	// system root) to their inodes, for hard links.
+	inodeByPath map[string]*inodeRef
+
+	// inodes contains the reference of each inode, indexed by inode number - 1.
+	inodes []Inode
+	// exportTable is true if an export table should be written.
+	exportTable bool
+}
+
+// WriterOption configures optional behavior of a Writer, see NewWriter.
+type WriterOption func(*Writer) error
+
+// WithCompression configures the Writer to compress data blocks using c. By
+// default, data blocks are stored uncompressed.
+func WithCompression(c Compression) WriterOption {
+	return func(w *Writer) error {
+		comp, err := newCompressor(c)
+		if err != nil {
+			return err
+		}
+		w.compressor = comp
+		w.sb.Compression = uint16(c)
+		return nil
+	}
+}
+
+// WithExportTable configures the Writer to write an export table, which maps
+// inode numbers to inodes. The export table is required for exporting the file
+// system via NFS, and enables Reader.InodeByNumber.
+func WithExportTable() WriterOption {
+	return func(w *Writer) error {
+		w.exportTable = true
+		return nil
+	}
 }
 
 // TODO: document what this is doing and what it is used for
@@ -309,7 +396,7 @@ func slog(block uint32) uint16 {
 
 // filesystemFlags returns flags for a SquashFS file system created by this
 // package (disabling most features for now).
-func filesystemFlags() uint16 {
+func (w *Writer) filesystemFlags() uint16 {
 	const (
 		noI = 1 << iota // uncompressed metadata
 		noD             // uncompressed data
@@ -323,7 +410,14 @@ func filesystemFlags() uint16 {
 		noXattr           // no xattrs
 		compopt           // compressor-specific options present?
 	)
-	return noI | noF | noFrag | noX | noXattr
+	flags := uint16(noI | noX | noXattr | duplicateChecking)
+	if w.compressor == nil {
+		flags |= noF
+	}
+	if w.exportTable {
+		flags |= exportable
+	}
+	return flags
 }
 
 // NewWriter returns a Writer which will write a SquashFS file system image to w
@@ -333,7 +427,10 @@ func filesystemFlags() uint16 {
 // directory of the Writer.
 //
 // File data is written to w even before Flush is called.
-func NewWriter(w io.WriteSeeker, mkfsTime time.Time) (*Writer, error) {
+//
+// Optional behavior (e.g. data block compression) can be enabled by passing
+// WriterOptions.
+func NewWriter(w io.WriteSeeker, mkfsTime time.Time, opts ...WriterOption) (*Writer, error) {
 	// Skip over superblock to the data area, we come back to the superblock
 	// when flushing.
 	if _, err := w.Seek(96, io.SeekStart); err != nil {
@@ -348,7 +445,6 @@ func NewWriter(w io.WriteSeeker, mkfsTime time.Time) (*Writer, error) {
 			Fragments:         0,
 			Compression:       zlibCompression,
 			BlockLog:          slog(dataBlockSize),
-			Flags:             filesystemFlags(),
 			NoIds:             1, // just one uid/gid mapping (for root)
 			Major:             majorVersion,
 			Minor:             minorVersion,
@@ -356,6 +452,13 @@ func NewWriter(w io.WriteSeeker, mkfsTime time.Time) (*Writer, error) {
 			LookupTableStart:  -1, // not present
 		},
 		writeInodeNumTo: make(map[string][]int64),
+		dataBySum:       make(map[[sha256.Size]byte]*fileData),
+		inodeByPath:     make(map[string]*inodeRef),
+	}
+	for _, opt := range opts {
+		if err := opt(wr); err != nil {
+			return nil, err
+		}
 	}
 	wr.Root = &Directory{
 		w:       wr,
@@ -398,11 +501,8 @@ type file struct {
 	// the number of bytes the block compressed down to.
 	blocksizes []uint32
 
-	// compBuf is used for holding a block during compression to avoid memory
-	// allocations.
-	compBuf *bytes.Buffer
-	// zlibWriter is re-used for each compressed block
-	zlibWriter *zlib.Writer
+	// hash is fed all file contents for de-duplication.
+	hash hash.Hash
 
 	xattrRef uint32
 }
@@ -425,14 +525,6 @@ func (d *Directory) File(name string, modTime time.Time, mode uint16, xattrs []X
 		return nil, err
 	}
 
-	// zlib.BestSpeed results in only a 2x slow-down over no compression
-	// (compared to >4x slow-down with DefaultCompression), but generates
-	// results which are in the same ball park (10% larger).
-	zw, err := zlib.NewWriterLevel(nil, zlib.BestSpeed)
-	if err != nil {
-		return nil, err
-	}
-
 	xattrRef := uint32(invalidXattr)
 	if len(xattrs) > 0 {
 		xattrRef = uint32(len(d.w.xattrs))
@@ -445,15 +537,14 @@ func (d *Directory) File(name string, modTime time.Time, mode uint16, xattrs []X
 		})
 	}
 	return &file{
-		w:          d.w,
-		d:          d,
-		off:        off,
-		name:       name,
-		modTime:    modTime,
-		mode:       mode,
-		compBuf:    bytes.NewBuffer(make([]byte, dataBlockSize)),
-		zlibWriter: zw,
-		xattrRef:   xattrRef,
+		w:        d.w,
+		d:        d,
+		off:      off,
+		name:     name,
+		modTime:  modTime,
+		mode:     mode,
+		hash:     sha256.New(),
+		xattrRef: xattrRef,
 	}, nil
 }
 
@@ -462,6 +553,7 @@ func (d *Directory) File(name string, modTime time.Time, mode uint16, xattrs []X
 func (d *Directory) Symlink(oldname, newname string, modTime time.Time, mode os.FileMode) error {
 	startBlock := d.w.inodeBuf.Len() / metadataBlockSize
 	offset := d.w.inodeBuf.Len() - startBlock*metadataBlockSize
+	inodeBufOffset := d.w.inodeBuf.Len()
 
 	if err := binary.Write(&d.w.inodeBuf, binary.LittleEndian, symlinkInodeHeader{
 		inodeHeader: inodeHeader{
@@ -472,7 +564,7 @@ func (d *Directory) Symlink(oldname, newname string, modTime time.Time, mode os.
 			Mtime:       int32(modTime.Unix()),
 			InodeNumber: d.w.sb.Inodes + 1,
 		},
-		Nlink:       1, // TODO(later): when is this not 1?
+		Nlink:       1, // incremented by Hardlink
 		SymlinkSize: uint32(len(oldname)),
 	}); err != nil {
 		return err
@@ -488,31 +580,186 @@ func (d *Directory) Symlink(oldname, newname string, modTime time.Time, mode os.
 		entryType:   symlinkType,
 		name:        newname,
 	})
+	d.w.inodeByPath[filepath.Join(d.path(), newname)] = &inodeRef{
+		startBlock:  uint32(startBlock),
+		offset:      uint16(offset),
+		inodeNumber: d.w.sb.Inodes + 1,
+		entryType:   symlinkType,
+		nlinkOffset: inodeBufOffset + binary.Size(inodeHeader{}),
+		nlink:       1,
+	}
+
+	d.w.addInode(startBlock, offset)
+	return nil
+}
+
+// Device creates a block device (or a character device, if mode has
+// os.ModeCharDevice set) with the specified name, modTime, mode and device
+// numbers.
+func (d *Directory) Device(name string, modTime time.Time, mode os.FileMode, major, minor uint32) error {
+	if mode&os.ModeDevice == 0 {
+		return fmt.Errorf("device %s: mode %v is not a device", name, mode)
+	}
+	typ := uint16(blkdevType)
+	if mode&os.ModeCharDevice != 0 {
+		typ = chrdevType
+	}
+	return d.special(name, devInodeHeader{
+		inodeHeader: d.w.inodeHeader(typ, modTime, mode),
+		Nlink:       1, // incremented by Hardlink
+		Rdev:        encodeDev(major, minor),
+	})
+}
+
+// Fifo creates a named pipe with the specified name, modTime and mode.
+func (d *Directory) Fifo(name string, modTime time.Time, mode os.FileMode) error {
+	return d.special(name, ipcInodeHeader{
+		inodeHeader: d.w.inodeHeader(fifoType, modTime, mode),
+		Nlink:       1, // incremented by Hardlink
+	})
+}
+
+// Socket creates a unix domain socket with the specified name, modTime and
+// mode.
+func (d *Directory) Socket(name string, modTime time.Time, mode os.FileMode) error {
+	return d.special(name, ipcInodeHeader{
+		inodeHeader: d.w.inodeHeader(socketType, modTime, mode),
+		Nlink:       1, // incremented by Hardlink
+	})
+}
 
-	d.w.sb.Inodes++
+// encodeDev encodes device numbers like the Linux kernel’s new_encode_dev,
+// which is what SquashFS stores.
+func encodeDev(major, minor uint32) uint32 {
+	return (minor & 0xff) | (major&0xfff)<<8 | (minor&^0xff)<<12
+}
+
+// decodeDev is the inverse of encodeDev.
+func decodeDev(rdev uint32) (major, minor uint32) {
+	return (rdev & 0xfff00) >> 8, (rdev & 0xff) | (rdev>>12)&0xfff00
+}
+
+func (w *Writer) inodeHeader(typ uint16, modTime time.Time, mode os.FileMode) inodeHeader {
+	return inodeHeader{
+		InodeType:   typ,
+		Mode:        uint16(mode.Perm()),
+		Uid:         0,
+		Gid:         0,
+		Mtime:       int32(modTime.Unix()),
+		InodeNumber: w.sb.Inodes + 1,
+	}
+}
+
+// special writes the inode of a device, FIFO or socket. hdr must be a
+// devInodeHeader or ipcInodeHeader, both of which start with Nlink.
+func (d *Directory) special(name string, hdr interface{}) error {
+	startBlock := d.w.inodeBuf.Len() / metadataBlockSize
+	offset := d.w.inodeBuf.Len() - startBlock*metadataBlockSize
+	inodeBufOffset := d.w.inodeBuf.Len()
+
+	var ih inodeHeader
+	switch x := hdr.(type) {
+	case devInodeHeader:
+		ih = x.inodeHeader
+	case ipcInodeHeader:
+		ih = x.inodeHeader
+	default:
+		return fmt.Errorf("BUG: unexpected inode header type %T", hdr)
+	}
+	if err := binary.Write(&d.w.inodeBuf, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+
+	d.dirEntries = append(d.dirEntries, fullDirEntry{
+		startBlock:  uint32(startBlock),
+		offset:      uint16(offset),
+		inodeNumber: ih.InodeNumber,
+		entryType:   ih.InodeType,
+		name:        name,
+	})
+	d.w.inodeByPath[filepath.Join(d.path(), name)] = &inodeRef{
+		startBlock:  uint32(startBlock),
+		offset:      uint16(offset),
+		inodeNumber: ih.InodeNumber,
+		entryType:   ih.InodeType,
+		nlinkOffset: inodeBufOffset + binary.Size(inodeHeader{}),
+		nlink:       1,
+	}
+
+	d.w.addInode(startBlock, offset)
+	return nil
+}
+
+// Hardlink creates a directory entry newname referring to the inode of the
+// non-directory at oldpath, which must have been written before. oldpath is
+// relative to the file system root.
+func (d *Directory) Hardlink(oldpath, newname string) error {
+	ref, ok := d.w.inodeByPath[filepath.Clean(oldpath)]
+	if !ok {
+		return fmt.Errorf("hardlink %s: %q not found (not yet written?)", newname, oldpath)
+	}
+	ref.nlink++
+	// Directly manipulating unread data in bytes.Buffer via Bytes(), as per
+	// https://groups.google.com/d/msg/golang-nuts/1ON9XVQ1jXE/8j9RaeSYxuEJ
+	b := d.w.inodeBuf.Bytes()
+	binary.LittleEndian.PutUint32(b[ref.nlinkOffset:ref.nlinkOffset+4], ref.nlink)
+	d.dirEntries = append(d.dirEntries, fullDirEntry{
+		startBlock:  ref.startBlock,
+		offset:      ref.offset,
+		inodeNumber: ref.inodeNumber,
+		entryType:   ref.entryType,
+		name:        newname,
+	})
 	return nil
 }
 
+// makeInode returns the reference to the inode at offset within the metadata
+// block with index startBlock of the inode table.
+func makeInode(startBlock, offset int) Inode {
+	return Inode((startBlock*(metadataBlockSize+2))<<16 | offset)
+}
+
+// addInode records the reference of the inode which was just written and
+// assigns the next inode number.
+func (w *Writer) addInode(startBlock, offset int) {
+	w.inodes = append(w.inodes, makeInode(startBlock, offset))
+	w.sb.Inodes++
+}
+
+func fitsInt16(n int64) bool {
+	return n >= -1<<15 && n < 1<<15
+}
+
 // Flush writes directory entries and creates inodes for the directory.
 func (d *Directory) Flush() error {
-	countByStartBlock := make(map[uint32]uint32)
-	for _, de := range d.dirEntries {
-		countByStartBlock[de.startBlock]++
+	// Each directory header covers a run of up to 256 entries whose inodes are
+	// in the same metadata block and whose inode numbers differ from the
+	// header by no more than an int16 can represent (hard links can refer to
+	// much older inodes).
+	countByRun := make(map[int]uint32)
+	run := -1
+	for idx, de := range d.dirEntries {
+		if idx == 0 ||
+			de.startBlock != d.dirEntries[run].startBlock ||
+			countByRun[run] == 256 ||
+			!fitsInt16(int64(de.inodeNumber)-int64(d.dirEntries[run].inodeNumber)) {
+			run = idx
+		}
+		countByRun[run]++
 	}
 
 	dirBufStartBlock := d.w.dirBuf.Len() / metadataBlockSize
 	dirBufOffset := d.w.dirBuf.Len()
 
-	currentBlock := int64(-1)
 	currentInodeOffset := int64(-1)
 	var subdirs int
-	for _, de := range d.dirEntries {
+	for idx, de := range d.dirEntries {
 		if de.entryType == dirType {
 			subdirs++
 		}
-		if int64(de.startBlock) != currentBlock {
+		if count, ok := countByRun[idx]; ok {
 			dh := dirHeader{
-				Count:       countByStartBlock[de.startBlock] - 1,
+				Count:       count - 1,
 				StartBlock:  de.startBlock * (metadataBlockSize + 2),
 				InodeOffset: de.inodeNumber,
 			}
@@ -520,7 +767,6 @@ func (d *Directory) Flush() error {
 				return err
 			}
 
-			currentBlock = int64(de.startBlock)
 			currentInodeOffset = int64(de.inodeNumber)
 		}
 		if err := binary.Write(&d.w.dirBuf, binary.LittleEndian, &dirEntry{
@@ -614,10 +860,10 @@ func (d *Directory) Flush() error {
 			name:        d.name,
 		})
 	} else { // root
-		d.w.sb.RootInode = Inode((startBlock*(metadataBlockSize+2))<<16 | offset)
+		d.w.sb.RootInode = makeInode(startBlock, offset)
 	}
 
-	d.w.sb.Inodes++
+	d.w.addInode(startBlock, offset)
 
 	return nil
 }
@@ -626,6 +872,7 @@ func (d *Directory) Flush() error {
 func (f *file) Write(p []byte) (n int, err error) {
 	n, err = f.buf.Write(p)
 	if n > 0 {
+		f.hash.Write(p[:n])
 		// Keep track of the uncompressed file size.
 		f.size += uint32(n)
 		for f.buf.Len() >= dataBlockSize {
@@ -646,40 +893,12 @@ func (f *file) writeBlock() error {
 	b := f.buf.Bytes()
 	block := b[:n]
 	rest := b[n:]
-	/*
-		f.compBuf.Reset()
-		f.zlibWriter.Reset(f.compBuf)
-		if _, err := f.zlibWriter.Write(block); err != nil {
-			return err
-		}
-		if err := f.zlibWriter.Close(); err != nil {
-			return err
-		}
 
-		size := f.compBuf.Len()
-		if size > len(block) {
-			// Copy uncompressed data: Linux returns i/o errors when it encounters a
-			// compressed block which is larger than the uncompressed data:
-			// https://github.com/torvalds/linux/blob/3ca24ce9ff764bc27bceb9b2fd8ece74846c3fd3/fs/squashfs/block.c#L150
-			size = len(block) | (1 << 24) // SQUASHFS_COMPRESSED_BIT_BLOCK
-			if _, err := f.w.w.Write(block); err != nil {
-				return err
-			}
-		} else {
-			if _, err := io.Copy(f.w.w, f.compBuf); err != nil {
-				return err
-			}
-		}
-	*/
-	// Copy uncompressed data: Linux returns i/o errors when it encounters a
-	// compressed block which is larger than the uncompressed data:
-	// https://github.com/torvalds/linux/blob/3ca24ce9ff764bc27bceb9b2fd8ece74846c3fd3/fs/squashfs/block.c#L150
-	size := len(block) | (1 << 24) // SQUASHFS_COMPRESSED_BIT_BLOCK
-	if _, err := f.w.w.Write(block); err != nil {
+	size, err := f.w.writeDataBlock(block)
+	if err != nil {
 		return err
 	}
-
-	f.blocksizes = append(f.blocksizes, uint32(size))
+	f.blocksizes = append(f.blocksizes, size)
 
 	// Keep the rest in f.buf for the next write
 	copy(b, rest)
@@ -687,16 +906,129 @@ func (f *file) writeBlock() error {
 	return nil
 }
 
+// writeDataBlock writes block (compressed, if enabled and beneficial) and
+// returns its on-disk size as stored in block lists and the fragment table.
+func (w *Writer) writeDataBlock(block []byte) (uint32, error) {
+	// Copy uncompressed data unless compression reduces the size: Linux
+	// returns i/o errors when it encounters a compressed block which is larger
+	// than the uncompressed data:
+	// https://github.com/torvalds/linux/blob/3ca24ce9ff764bc27bceb9b2fd8ece74846c3fd3/fs/squashfs/block.c#L150
+	size := len(block) | uncompressedBlock
+	data := block
+	if w.compressor != nil {
+		w.compBuf.Reset()
+		if err := w.compressor.compress(&w.compBuf, block); err != nil {
+			return 0, err
+		}
+		if w.compBuf.Len() < len(block) {
+			size = w.compBuf.Len()
+			data = w.compBuf.Bytes()
+		}
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return 0, err
+	}
+	return uint32(size), nil
+}
+
+// addFragment packs tail into the current fragment block and returns the
+// fragment index and offset within the (uncompressed) fragment block.
+func (w *Writer) addFragment(tail []byte) (index uint32, offset uint32, _ error) {
+	if w.fragBuf.Len()+len(tail) > dataBlockSize {
+		if err := w.flushFragment(); err != nil {
+			return 0, 0, err
+		}
+	}
+	index = uint32(len(w.fragments))
+	offset = uint32(w.fragBuf.Len())
+	w.fragBuf.Write(tail)
+	return index, offset, nil
+}
+
+// flushFragment writes the current fragment block, if any.
+func (w *Writer) flushFragment() error {
+	if w.fragBuf.Len() == 0 {
+		return nil
+	}
+	off, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	size, err := w.writeDataBlock(w.fragBuf.Bytes())
+	if err != nil {
+		return err
+	}
+	w.fragments = append(w.fragments, fragmentEntry{
+		StartBlock: uint64(off),
+		Size:       size,
+	})
+	w.fragBuf.Reset()
+	return nil
+}
+
+// dedup returns the location of identical, previously written file contents,
+// if any. In that case, the data blocks of f are discarded.
+func (f *file) dedup() (*fileData, error) {
+	if f.size == 0 {
+		return nil, nil // nothing to share
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], f.hash.Sum(nil))
+	existing, ok := f.w.dataBySum[sum]
+	if !ok || existing.size != f.size {
+		return nil, nil
+	}
+	// Only discard the data blocks of f if no other data was written
+	// afterwards.
+	end := f.off
+	for _, size := range f.blocksizes {
+		end += int64(size &^ uncompressedBlock)
+	}
+	off, err := f.w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if off != end {
+		return nil, nil
+	}
+	if _, err := f.w.w.Seek(f.off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
 // Close implements io.Closer
 func (f *file) Close() error {
-	for f.buf.Len() > 0 {
-		if err := f.writeBlock(); err != nil {
-			return err
+	data, err := f.dedup()
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = &fileData{
+			size:       f.size,
+			startBlock: uint64(f.off),
+			blocksizes: f.blocksizes,
+			fragment:   invalidFragment,
+		}
+		// Write never leaves more than a partial block in f.buf. This tail end
+		// of the file is packed into a fragment block.
+		if f.buf.Len() > 0 {
+			data.fragment, data.offset, err = f.w.addFragment(f.buf.Bytes())
+			if err != nil {
+				return err
+			}
+		}
+		if f.size > 0 {
+			var sum [sha256.Size]byte
+			copy(sum[:], f.hash.Sum(nil))
+			f.w.dataBySum[sum] = data
 		}
 	}
+	f.buf.Reset()
 
 	startBlock := f.w.inodeBuf.Len() / metadataBlockSize
 	offset := f.w.inodeBuf.Len() - startBlock*metadataBlockSize
+	inodeBufOffset := f.w.inodeBuf.Len()
 
 	if err := binary.Write(&f.w.inodeBuf, binary.LittleEndian, lregInodeHeader{
 		inodeHeader: inodeHeader{
@@ -707,17 +1039,17 @@ func (f *file) Close() error {
 			Mtime:       int32(f.modTime.Unix()),
 			InodeNumber: f.w.sb.Inodes + 1,
 		},
-		StartBlock: uint64(f.off),
+		StartBlock: data.startBlock,
 		FileSize:   uint64(f.size),
-		Nlink:      1,
-		Fragment:   invalidFragment,
-		Offset:     0,
+		Nlink:      1, // incremented by Hardlink
+		Fragment:   data.fragment,
+		Offset:     data.offset,
 		Xattr:      f.xattrRef,
 	}); err != nil {
 		return err
 	}
 
-	if err := binary.Write(&f.w.inodeBuf, binary.LittleEndian, f.blocksizes); err != nil {
+	if err := binary.Write(&f.w.inodeBuf, binary.LittleEndian, data.blocksizes); err != nil {
 		return err
 	}
 
@@ -728,8 +1060,18 @@ func (f *file) Close() error {
 		entryType:   fileType,
 		name:        f.name,
 	})
+	f.w.inodeByPath[filepath.Join(f.d.path(), f.name)] = &inodeRef{
+		startBlock:  uint32(startBlock),
+		offset:      uint16(offset),
+		inodeNumber: f.w.sb.Inodes + 1,
+		entryType:   fileType,
+		// Nlink follows the inodeHeader and the StartBlock, FileSize and Sparse
+		// fields (8 bytes each).
+		nlinkOffset: inodeBufOffset + binary.Size(inodeHeader{}) + 3*8,
+		nlink:       1,
+	}
 
-	f.w.sb.Inodes++
+	f.w.addInode(startBlock, offset)
 
 	return nil
 }
@@ -833,6 +1175,51 @@ func (w *Writer) writeXattrTables() (int64, error) {
 	return off, nil
 }
 
+// writeFragmentTable writes the fragment table, returning the offset of its
+// index.
+func (w *Writer) writeFragmentTable() (int64, error) {
+	return w.writeLookupTable(w.fragments, len(w.fragments))
+}
+
+// writeExportTable writes the export table, returning the offset of its index.
+func (w *Writer) writeExportTable() (int64, error) {
+	if !w.exportTable {
+		return -1, nil // not present
+	}
+	return w.writeLookupTable(w.inodes, len(w.inodes))
+}
+
+// writeLookupTable writes the n entries of table (in metadata blocks),
+// followed by an index of the metadata blocks, whose offset is returned.
+func (w *Writer) writeLookupTable(table interface{}, n int) (int64, error) {
+	off, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return off, nil
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, table); err != nil {
+		return 0, err
+	}
+	blocks := (buf.Len() + (metadataBlockSize - 1)) / metadataBlockSize
+	if err := w.writeMetadataChunks(&buf); err != nil {
+		return 0, err
+	}
+	indexOff, err := w.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < blocks; i++ {
+		blockOff := uint64(off) + uint64(i)*(metadataBlockSize+2 /* sizeof(uint16) */)
+		if err := binary.Write(w.w, binary.LittleEndian, blockOff); err != nil {
+			return 0, err
+		}
+	}
+	return indexOff, nil
+}
+
 // writeMetadataChunks copies from r to w in blocks of metadataBlockSize bytes
 // each, prefixing each block with a uint16 length header, setting the
 // uncompressed bit.
@@ -864,7 +1251,10 @@ func (w *Writer) Flush() error {
 
 	// (2) compressor-specific options omitted
 
-	// (3) data has already been written
+	// (3) data has already been written, except for the last fragment block
+	if err := w.flushFragment(); err != nil {
+		return err
+	}
 
 	// (4) write inode table
 	off, err := w.w.Seek(0, io.SeekCurrent)
@@ -888,14 +1278,20 @@ func (w *Writer) Flush() error {
 		return err
 	}
 
-	// (6) fragment table omitted
-	off, err = w.w.Seek(0, io.SeekCurrent)
+	// (6) write fragment table
+	off, err = w.writeFragmentTable()
 	if err != nil {
 		return err
 	}
 	w.sb.FragmentTableStart = off
+	w.sb.Fragments = uint32(len(w.fragments))
 
-	// (7) export table omitted
+	// (7) write export table
+	off, err = w.writeExportTable()
+	if err != nil {
+		return err
+	}
+	w.sb.LookupTableStart = off
 
 	// (8) write uid/gid lookup table
 	idTableStart, err := writeIdTable(w.w, []uint32{0})
@@ -916,6 +1312,7 @@ func (w *Writer) Flush() error {
 		return err
 	}
 	w.sb.BytesUsed = off
+	w.sb.Flags = w.filesystemFlags()
 
 	// Pad to 4096, required for the kernel to be able to access all pages
 	if pad := off % 4096; pad > 0 {
@@ -925,6 +1322,18 @@ func (w *Writer) Flush() error {
 		}
 	}
 
+	// Discarded data blocks of de-duplicated files may have been written past
+	// the end of the file system, so truncate if possible.
+	if t, ok := w.w.(interface{ Truncate(int64) error }); ok {
+		end, err := w.w.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if err := t.Truncate(end); err != nil {
+			return err
+		}
+	}
+
 	// (1) Write superblock
 	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
 		return err
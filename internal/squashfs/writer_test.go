@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -308,3 +309,453 @@ func TestReader(t *testing.T) {
 		})
 	}
 }
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	// compressible spans multiple data blocks and ends in a partial block.
+	compressible := bytes.Repeat([]byte("distri squashfs compression test\n"), 3*dataBlockSize/32+17)
+	for _, c := range []Compression{ZlibCompression, ZstdCompression} {
+		c := c // copy
+		t.Run(c.String(), func(t *testing.T) {
+			t.Parallel()
+			buf := &writerseeker.WriterSeeker{}
+			w, err := NewWriter(buf, time.Now(), WithCompression(c))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range []struct {
+				name     string
+				contents []byte
+			}{
+				{"compressible", compressible},
+				{"empty", nil},
+				{"small", []byte("hello world!")},
+			} {
+				ff, err := w.Root.File(entry.name, time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := ff.Write(entry.contents); err != nil {
+					t.Fatal(err)
+				}
+				if err := ff.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Root.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			img, err := ioutil.ReadAll(buf.Reader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, limit := len(img), len(compressible)/4; got > limit {
+				t.Errorf("compressed image unexpectedly large: got %d bytes, want <= %d bytes", got, limit)
+			}
+
+			rd, err := NewReader(bytes.NewReader(img))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range []struct {
+				name     string
+				contents []byte
+			}{
+				{"compressible", compressible},
+				{"empty", nil},
+				{"small", []byte("hello world!")},
+			} {
+				inode, err := rd.LookupPath(entry.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fr, err := rd.FileReader(inode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ioutil.ReadAll(fr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, entry.contents) {
+					t.Fatalf("%s: contents differ", entry.name)
+				}
+			}
+
+			// Verify random access across a block boundary.
+			inode, err := rd.LookupPath("compressible")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fr, err := rd.FileReader(inode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := make([]byte, 100)
+			off := int64(dataBlockSize - 50)
+			if _, err := fr.ReadAt(p, off); err != nil {
+				t.Fatal(err)
+			}
+			if want := compressible[off : off+100]; !bytes.Equal(p, want) {
+				t.Fatalf("ReadAt(%d): got %q, want %q", off, p, want)
+			}
+		})
+	}
+}
+
+func TestFragments(t *testing.T) {
+	t.Parallel()
+
+	// Enough small files to fill more than one fragment block, plus files whose
+	// tail end is packed into a fragment after full data blocks.
+	contents := make(map[string][]byte)
+	for i := 0; i < 2000; i++ {
+		contents[fmt.Sprintf("small%d", i)] = bytes.Repeat([]byte{byte(i)}, 100+i%50)
+	}
+	contents["tail"] = bytes.Repeat([]byte("distri fragment test\n"), 2*dataBlockSize/21+3)
+	contents["exact"] = bytes.Repeat([]byte{'x'}, dataBlockSize)
+	// SquashFS requires directory entries to be sorted by name:
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, opts := range []struct {
+		name string
+		opts []WriterOption
+	}{
+		{"uncompressed", nil},
+		{"zstd", []WriterOption{WithCompression(ZstdCompression)}},
+	} {
+		opts := opts // copy
+		t.Run(opts.name, func(t *testing.T) {
+			t.Parallel()
+			buf := &writerseeker.WriterSeeker{}
+			w, err := NewWriter(buf, time.Now(), opts.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range names {
+				ff, err := w.Root.File(name, time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := ff.Write(contents[name]); err != nil {
+					t.Fatal(err)
+				}
+				if err := ff.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Root.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := w.sb.Fragments, uint32(2); got < want {
+				t.Errorf("unexpected number of fragment blocks: got %d, want >= %d", got, want)
+			}
+
+			rd, err := NewReader(buf.BytesReader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range contents {
+				inode, err := rd.LookupPath(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fr, err := rd.FileReader(inode)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := ioutil.ReadAll(fr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("%s: contents differ", name)
+				}
+			}
+		})
+	}
+}
+
+func TestDedupHardlink(t *testing.T) {
+	t.Parallel()
+
+	contents := bytes.Repeat([]byte("distri dedup test\n"), 2*dataBlockSize/18+5)
+	buf := &writerseeker.WriterSeeker{}
+	w, err := NewWriter(buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		ff, err := w.Root.File(name, time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ff.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+		if err := ff.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subdir := w.Root.Directory("subdir", time.Now())
+	if err := subdir.Hardlink("a", "link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := subdir.Hardlink("nonexistant", "broken"); err == nil {
+		t.Errorf("Hardlink(nonexistant) unexpectedly succeeded")
+	}
+	if err := subdir.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := ioutil.ReadAll(buf.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, limit := w.sb.BytesUsed, int64(len(contents)+64*1024); got > limit {
+		t.Errorf("image unexpectedly large (contents not de-duplicated?): got %d bytes, want <= %d bytes", got, limit)
+	}
+
+	rd, err := NewReader(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"a", "b", "subdir/link"} {
+		inode, err := rd.LookupPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fr, err := rd.FileReader(inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(fr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, contents) {
+			t.Fatalf("%s: contents differ", path)
+		}
+	}
+
+	a, err := rd.LookupPath("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, err := rd.LookupPath("subdir/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != link {
+		t.Errorf("hard link refers to a different inode: got %v, want %v", link, a)
+	}
+	i, err := rd.readInode(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := i.(lregInodeHeader).Nlink, uint32(2); got != want {
+		t.Errorf("unexpected Nlink: got %d, want %d", got, want)
+	}
+}
+
+func TestSpecialFiles(t *testing.T) {
+	t.Parallel()
+
+	buf := &writerseeker.WriterSeeker{}
+	w, err := NewWriter(buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Device("null", time.Now(), os.ModeDevice|os.ModeCharDevice|0666, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Device("sdb12", time.Now(), os.ModeDevice|0660, 8, 300); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Device("notadevice", time.Now(), 0644, 1, 3); err == nil {
+		t.Errorf("Device(mode=0644) unexpectedly succeeded")
+	}
+	if err := w.Root.Fifo("initctl", time.Now(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Socket("log", time.Now(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Root.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := NewReader(buf.BytesReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]os.FileMode{
+		"null":    os.ModeDevice | os.ModeCharDevice | 0666,
+		"sdb12":   os.ModeDevice | 0660,
+		"initctl": os.ModeNamedPipe | 0600,
+		"log":     os.ModeSocket | 0666,
+	}
+
+	fis, err := rd.Readdir(rd.RootInode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]os.FileMode)
+	for _, fi := range fis {
+		got[fi.Name()] = fi.Mode()
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Readdir: unexpected modes: diff (-want +got):\n%s", diff)
+	}
+
+	fis, err = rd.ReaddirNoStat(rd.RootInode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = make(map[string]os.FileMode)
+	for _, fi := range fis {
+		got[fi.Name()] = fi.Mode()
+	}
+	for name, mode := range want {
+		want[name] = mode.Type() // ReaddirNoStat only knows the type
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReaddirNoStat: unexpected modes: diff (-want +got):\n%s", diff)
+	}
+
+	for _, entry := range []struct {
+		name         string
+		major, minor uint32
+	}{
+		{"null", 1, 3},
+		{"sdb12", 8, 300},
+	} {
+		inode, err := rd.LlookupPath(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := rd.Stat(entry.name, inode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		major, minor := fi.(*FileInfo).Rdev()
+		if major != entry.major || minor != entry.minor {
+			t.Errorf("%s: unexpected device numbers: got %d:%d, want %d:%d", entry.name, major, minor, entry.major, entry.minor)
+		}
+	}
+}
+
+func TestExportTable(t *testing.T) {
+	t.Parallel()
+
+	for _, export := range []bool{false, true} {
+		export := export // copy
+		t.Run(fmt.Sprintf("export %v", export), func(t *testing.T) {
+			t.Parallel()
+			var opts []WriterOption
+			if export {
+				opts = append(opts, WithExportTable())
+			}
+			buf := &writerseeker.WriterSeeker{}
+			w, err := NewWriter(buf, time.Now(), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// More inodes than fit into one metadata block of the export table.
+			subdir := w.Root.Directory("subdir", time.Now())
+			for i := 0; i < 1500; i++ {
+				ff, err := subdir.File(fmt.Sprintf("file%d", i), time.Now(), unix.S_IRUSR|unix.S_IRGRP|unix.S_IROTH, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := ff.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := subdir.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Root.Symlink("subdir/file0", "link", time.Now(), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Root.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			rd, err := NewReader(buf.BytesReader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !export {
+				if _, err := rd.InodeByNumber(1); err == nil {
+					t.Fatalf("InodeByNumber unexpectedly succeeded without export table")
+				}
+				return
+			}
+			inodes := rd.super.Inodes
+			if got, want := inodes, uint32(1500+3); got != want {
+				t.Fatalf("unexpected number of inodes: got %d, want %d", got, want)
+			}
+			for num := uint32(1); num <= inodes; num++ {
+				i, err := rd.InodeByNumber(num)
+				if err != nil {
+					t.Fatal(err)
+				}
+				hdr, err := rd.readInode(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got uint32
+				switch x := hdr.(type) {
+				case lregInodeHeader:
+					got = x.InodeNumber
+				case symlinkInodeHeader:
+					got = x.InodeNumber
+				case dirInodeHeader:
+					got = x.InodeNumber
+				case ldirInodeHeader:
+					got = x.InodeNumber
+				default:
+					t.Fatalf("unexpected inode type %T", hdr)
+				}
+				if got != num {
+					t.Fatalf("InodeByNumber(%d) returned inode number %d", num, got)
+				}
+			}
+			root, err := rd.InodeByNumber(inodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := root, rd.RootInode(); got != want {
+				t.Errorf("InodeByNumber(%d) = %v, want root inode %v", inodes, got, want)
+			}
+			if _, err := rd.InodeByNumber(inodes + 1); err == nil {
+				t.Errorf("InodeByNumber(%d) unexpectedly succeeded", inodes+1)
+			}
+		})
+	}
+}
@@ -958,6 +958,10 @@ type Build struct {
 	// for tight coupling situations, e.g. when a plugin mechanism does not
 	// guarantee ABI compatibility across versions.
 	RuntimeUnion []*Union `protobuf:"bytes,15,rep,name=runtime_union,json=runtimeUnion" json:"runtime_union,omitempty"`
+	// Additional global exchange directories (e.g. out/share/gettext-0.19.8),
+	// for software which can only be configured to look in a versioned
+	// directory. Prefer runtime_union for tight coupling situations.
+	ExchangeDir []string `protobuf:"bytes,23,rep,name=exchange_dir,json=exchangeDir" json:"exchange_dir,omitempty"`
 }
 
 func (x *Build) Reset() {
@@ -1153,6 +1157,13 @@ func (x *Build) GetRuntimeUnion() []*Union {
 	return nil
 }
 
+func (x *Build) GetExchangeDir() []string {
+	if x != nil {
+		return x.ExchangeDir
+	}
+	return nil
+}
+
 type isBuild_Builder interface {
 	isBuild_Builder()
 }
@@ -1593,7 +1604,7 @@ var file_build_proto_rawDesc = []byte{
 	0x72, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x41, 0x6c,
 	0x6c, 0x12, 0x21, 0x0a, 0x0c, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x5f, 0x73, 0x65, 0x6d, 0x76, 0x65,
 	0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x53, 0x65,
-	0x6d, 0x76, 0x65, 0x72, 0x22, 0x97, 0x07, 0x0a, 0x05, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x12, 0x16,
+	0x6d, 0x76, 0x65, 0x72, 0x22, 0xba, 0x07, 0x0a, 0x05, 0x42, 0x75, 0x69, 0x6c, 0x64, 0x12, 0x16,
 	0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
 	0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x1c, 0x0a, 0x04, 0x70, 0x75, 0x6c, 0x6c, 0x18, 0x13,
 	0x20, 0x01, 0x28, 0x0b, 0x32, 0x08, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x75, 0x6c, 0x6c, 0x52, 0x04,
@@ -1650,8 +1661,10 @@ var file_build_proto_rawDesc = []byte{
 	0x61, 0x67, 0x65, 0x12, 0x2e, 0x0a, 0x0d, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d, 0x65, 0x5f, 0x75,
 	0x6e, 0x69, 0x6f, 0x6e, 0x18, 0x0f, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x09, 0x2e, 0x70, 0x62, 0x2e,
 	0x55, 0x6e, 0x69, 0x6f, 0x6e, 0x52, 0x0c, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d, 0x65, 0x55, 0x6e,
-	0x69, 0x6f, 0x6e, 0x42, 0x09, 0x0a, 0x07, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x65, 0x72, 0x42, 0x06,
-	0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62,
+	0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x65, 0x78, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x5f,
+	0x64, 0x69, 0x72, 0x18, 0x17, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b, 0x65, 0x78, 0x63, 0x68, 0x61,
+	0x6e, 0x67, 0x65, 0x44, 0x69, 0x72, 0x42, 0x09, 0x0a, 0x07, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x65,
+	0x72, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62,
 }
 
 var (
@@ -266,6 +266,1019 @@ func (*ScanPackagesReply) Descriptor() ([]byte, []int) {
 	return file_fusectl_proto_rawDescGZIP(), []int{5}
 }
 
+type RemovePackagesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Full package names, e.g. less-amd64-530-3.
+	Package []string `protobuf:"bytes,1,rep,name=package" json:"package,omitempty"`
+}
+
+func (x *RemovePackagesRequest) Reset() {
+	*x = RemovePackagesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RemovePackagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemovePackagesRequest) ProtoMessage() {}
+
+func (x *RemovePackagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemovePackagesRequest.ProtoReflect.Descriptor instead.
+func (*RemovePackagesRequest) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RemovePackagesRequest) GetPackage() []string {
+	if x != nil {
+		return x.Package
+	}
+	return nil
+}
+
+type RemovePackagesReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *RemovePackagesReply) Reset() {
+	*x = RemovePackagesReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RemovePackagesReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemovePackagesReply) ProtoMessage() {}
+
+func (x *RemovePackagesReply) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemovePackagesReply.ProtoReflect.Descriptor instead.
+func (*RemovePackagesReply) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{7}
+}
+
+type StatusRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *StatusRequest) Reset() {
+	*x = StatusRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusRequest) ProtoMessage() {}
+
+func (x *StatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusRequest.ProtoReflect.Descriptor instead.
+func (*StatusRequest) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{8}
+}
+
+type StatusReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Repo         *string `protobuf:"bytes,1,opt,name=repo" json:"repo,omitempty"`       // e.g. /roimg
+	Section      *string `protobuf:"bytes,2,opt,name=section" json:"section,omitempty"` // e.g. pkg
+	Autodownload *bool   `protobuf:"varint,3,opt,name=autodownload" json:"autodownload,omitempty"`
+	Stream       *bool   `protobuf:"varint,4,opt,name=stream" json:"stream,omitempty"`
+	Packages     *uint64 `protobuf:"varint,5,opt,name=packages" json:"packages,omitempty"` // number of packages
+	Opened       *uint64 `protobuf:"varint,6,opt,name=opened" json:"opened,omitempty"`     // number of packages whose image is opened
+	// Totals of the corresponding ListPackagesReply.Package fields.
+	Reads          *uint64 `protobuf:"varint,7,opt,name=reads" json:"reads,omitempty"`
+	ReadBytes      *uint64 `protobuf:"varint,8,opt,name=read_bytes,json=readBytes" json:"read_bytes,omitempty"`
+	DircacheHits   *uint64 `protobuf:"varint,9,opt,name=dircache_hits,json=dircacheHits" json:"dircache_hits,omitempty"`
+	DircacheMisses *uint64 `protobuf:"varint,10,opt,name=dircache_misses,json=dircacheMisses" json:"dircache_misses,omitempty"`
+	StreamHits     *uint64 `protobuf:"varint,11,opt,name=stream_hits,json=streamHits" json:"stream_hits,omitempty"`
+	StreamMisses   *uint64 `protobuf:"varint,12,opt,name=stream_misses,json=streamMisses" json:"stream_misses,omitempty"`
+	// Disk usage and size budget (in bytes) of the -stream block cache.
+	StreamCacheUsed   *uint64 `protobuf:"varint,13,opt,name=stream_cache_used,json=streamCacheUsed" json:"stream_cache_used,omitempty"`
+	StreamCacheBudget *uint64 `protobuf:"varint,14,opt,name=stream_cache_budget,json=streamCacheBudget" json:"stream_cache_budget,omitempty"`
+}
+
+func (x *StatusReply) Reset() {
+	*x = StatusReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatusReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusReply) ProtoMessage() {}
+
+func (x *StatusReply) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusReply.ProtoReflect.Descriptor instead.
+func (*StatusReply) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StatusReply) GetRepo() string {
+	if x != nil && x.Repo != nil {
+		return *x.Repo
+	}
+	return ""
+}
+
+func (x *StatusReply) GetSection() string {
+	if x != nil && x.Section != nil {
+		return *x.Section
+	}
+	return ""
+}
+
+func (x *StatusReply) GetAutodownload() bool {
+	if x != nil && x.Autodownload != nil {
+		return *x.Autodownload
+	}
+	return false
+}
+
+func (x *StatusReply) GetStream() bool {
+	if x != nil && x.Stream != nil {
+		return *x.Stream
+	}
+	return false
+}
+
+func (x *StatusReply) GetPackages() uint64 {
+	if x != nil && x.Packages != nil {
+		return *x.Packages
+	}
+	return 0
+}
+
+func (x *StatusReply) GetOpened() uint64 {
+	if x != nil && x.Opened != nil {
+		return *x.Opened
+	}
+	return 0
+}
+
+func (x *StatusReply) GetReads() uint64 {
+	if x != nil && x.Reads != nil {
+		return *x.Reads
+	}
+	return 0
+}
+
+func (x *StatusReply) GetReadBytes() uint64 {
+	if x != nil && x.ReadBytes != nil {
+		return *x.ReadBytes
+	}
+	return 0
+}
+
+func (x *StatusReply) GetDircacheHits() uint64 {
+	if x != nil && x.DircacheHits != nil {
+		return *x.DircacheHits
+	}
+	return 0
+}
+
+func (x *StatusReply) GetDircacheMisses() uint64 {
+	if x != nil && x.DircacheMisses != nil {
+		return *x.DircacheMisses
+	}
+	return 0
+}
+
+func (x *StatusReply) GetStreamHits() uint64 {
+	if x != nil && x.StreamHits != nil {
+		return *x.StreamHits
+	}
+	return 0
+}
+
+func (x *StatusReply) GetStreamMisses() uint64 {
+	if x != nil && x.StreamMisses != nil {
+		return *x.StreamMisses
+	}
+	return 0
+}
+
+func (x *StatusReply) GetStreamCacheUsed() uint64 {
+	if x != nil && x.StreamCacheUsed != nil {
+		return *x.StreamCacheUsed
+	}
+	return 0
+}
+
+func (x *StatusReply) GetStreamCacheBudget() uint64 {
+	if x != nil && x.StreamCacheBudget != nil {
+		return *x.StreamCacheBudget
+	}
+	return 0
+}
+
+type ListPackagesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// If true, only packages whose image is opened are listed.
+	OpenedOnly *bool `protobuf:"varint,1,opt,name=opened_only,json=openedOnly" json:"opened_only,omitempty"`
+}
+
+func (x *ListPackagesRequest) Reset() {
+	*x = ListPackagesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListPackagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPackagesRequest) ProtoMessage() {}
+
+func (x *ListPackagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPackagesRequest.ProtoReflect.Descriptor instead.
+func (*ListPackagesRequest) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListPackagesRequest) GetOpenedOnly() bool {
+	if x != nil && x.OpenedOnly != nil {
+		return *x.OpenedOnly
+	}
+	return false
+}
+
+type ListPackagesReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Package []*ListPackagesReply_Package `protobuf:"bytes,1,rep,name=package" json:"package,omitempty"`
+}
+
+func (x *ListPackagesReply) Reset() {
+	*x = ListPackagesReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListPackagesReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPackagesReply) ProtoMessage() {}
+
+func (x *ListPackagesReply) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPackagesReply.ProtoReflect.Descriptor instead.
+func (*ListPackagesReply) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListPackagesReply) GetPackage() []*ListPackagesReply_Package {
+	if x != nil {
+		return x.Package
+	}
+	return nil
+}
+
+type ListConflictsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// If non-empty, only conflicts within this exchange directory (e.g. /bin)
+	// are listed.
+	Dir *string `protobuf:"bytes,1,opt,name=dir" json:"dir,omitempty"`
+}
+
+func (x *ListConflictsRequest) Reset() {
+	*x = ListConflictsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListConflictsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConflictsRequest) ProtoMessage() {}
+
+func (x *ListConflictsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConflictsRequest.ProtoReflect.Descriptor instead.
+func (*ListConflictsRequest) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ListConflictsRequest) GetDir() string {
+	if x != nil && x.Dir != nil {
+		return *x.Dir
+	}
+	return ""
+}
+
+type ListConflictsReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Conflict []*ListConflictsReply_Conflict `protobuf:"bytes,1,rep,name=conflict" json:"conflict,omitempty"`
+}
+
+func (x *ListConflictsReply) Reset() {
+	*x = ListConflictsReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListConflictsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConflictsReply) ProtoMessage() {}
+
+func (x *ListConflictsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConflictsReply.ProtoReflect.Descriptor instead.
+func (*ListConflictsReply) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListConflictsReply) GetConflict() []*ListConflictsReply_Conflict {
+	if x != nil {
+		return x.Conflict
+	}
+	return nil
+}
+
+type SetViewRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name *string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"` // e.g. dev
+	// Packages of the view: either package names (e.g. less), which include all
+	// versions, or full package names (e.g. less-amd64-530-3).
+	Package []string `protobuf:"bytes,2,rep,name=package" json:"package,omitempty"`
+}
+
+func (x *SetViewRequest) Reset() {
+	*x = SetViewRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetViewRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetViewRequest) ProtoMessage() {}
+
+func (x *SetViewRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetViewRequest.ProtoReflect.Descriptor instead.
+func (*SetViewRequest) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SetViewRequest) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+func (x *SetViewRequest) GetPackage() []string {
+	if x != nil {
+		return x.Package
+	}
+	return nil
+}
+
+type SetViewReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *SetViewReply) Reset() {
+	*x = SetViewReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SetViewReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetViewReply) ProtoMessage() {}
+
+func (x *SetViewReply) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetViewReply.ProtoReflect.Descriptor instead.
+func (*SetViewReply) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{15}
+}
+
+type DeleteViewRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name *string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+}
+
+func (x *DeleteViewRequest) Reset() {
+	*x = DeleteViewRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteViewRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteViewRequest) ProtoMessage() {}
+
+func (x *DeleteViewRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteViewRequest.ProtoReflect.Descriptor instead.
+func (*DeleteViewRequest) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *DeleteViewRequest) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+type DeleteViewReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DeleteViewReply) Reset() {
+	*x = DeleteViewReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteViewReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteViewReply) ProtoMessage() {}
+
+func (x *DeleteViewReply) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteViewReply.ProtoReflect.Descriptor instead.
+func (*DeleteViewReply) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{17}
+}
+
+type ListViewsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListViewsRequest) Reset() {
+	*x = ListViewsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListViewsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListViewsRequest) ProtoMessage() {}
+
+func (x *ListViewsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListViewsRequest.ProtoReflect.Descriptor instead.
+func (*ListViewsRequest) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{18}
+}
+
+type ListViewsReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	View []*ListViewsReply_View `protobuf:"bytes,1,rep,name=view" json:"view,omitempty"`
+}
+
+func (x *ListViewsReply) Reset() {
+	*x = ListViewsReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListViewsReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListViewsReply) ProtoMessage() {}
+
+func (x *ListViewsReply) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListViewsReply.ProtoReflect.Descriptor instead.
+func (*ListViewsReply) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ListViewsReply) GetView() []*ListViewsReply_View {
+	if x != nil {
+		return x.View
+	}
+	return nil
+}
+
+type ListPackagesReply_Package struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  *string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`   // e.g. less-amd64-530-3
+	Image *string `protobuf:"bytes,2,opt,name=image" json:"image,omitempty"` // e.g. /roimg/less-amd64-530-3.squashfs
+	// Size of the image in bytes. Zero if the image is not available
+	// locally (yet), e.g. with -autodownload.
+	Size     *uint64 `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+	Opened   *bool   `protobuf:"varint,4,opt,name=opened" json:"opened,omitempty"`
+	Streamed *bool   `protobuf:"varint,5,opt,name=streamed" json:"streamed,omitempty"`
+	// The following statistics are reset when the image is closed.
+	Reads          *uint64 `protobuf:"varint,6,opt,name=reads" json:"reads,omitempty"` // number of ReadFile requests
+	ReadBytes      *uint64 `protobuf:"varint,7,opt,name=read_bytes,json=readBytes" json:"read_bytes,omitempty"`
+	DircacheHits   *uint64 `protobuf:"varint,8,opt,name=dircache_hits,json=dircacheHits" json:"dircache_hits,omitempty"` // LookUpInode directory cache
+	DircacheMisses *uint64 `protobuf:"varint,9,opt,name=dircache_misses,json=dircacheMisses" json:"dircache_misses,omitempty"`
+	StreamHits     *uint64 `protobuf:"varint,10,opt,name=stream_hits,json=streamHits" json:"stream_hits,omitempty"`       // blocks served from the -stream cache
+	StreamMisses   *uint64 `protobuf:"varint,11,opt,name=stream_misses,json=streamMisses" json:"stream_misses,omitempty"` // blocks fetched from remotes
+}
+
+func (x *ListPackagesReply_Package) Reset() {
+	*x = ListPackagesReply_Package{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListPackagesReply_Package) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPackagesReply_Package) ProtoMessage() {}
+
+func (x *ListPackagesReply_Package) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPackagesReply_Package.ProtoReflect.Descriptor instead.
+func (*ListPackagesReply_Package) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{11, 0}
+}
+
+func (x *ListPackagesReply_Package) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+func (x *ListPackagesReply_Package) GetImage() string {
+	if x != nil && x.Image != nil {
+		return *x.Image
+	}
+	return ""
+}
+
+func (x *ListPackagesReply_Package) GetSize() uint64 {
+	if x != nil && x.Size != nil {
+		return *x.Size
+	}
+	return 0
+}
+
+func (x *ListPackagesReply_Package) GetOpened() bool {
+	if x != nil && x.Opened != nil {
+		return *x.Opened
+	}
+	return false
+}
+
+func (x *ListPackagesReply_Package) GetStreamed() bool {
+	if x != nil && x.Streamed != nil {
+		return *x.Streamed
+	}
+	return false
+}
+
+func (x *ListPackagesReply_Package) GetReads() uint64 {
+	if x != nil && x.Reads != nil {
+		return *x.Reads
+	}
+	return 0
+}
+
+func (x *ListPackagesReply_Package) GetReadBytes() uint64 {
+	if x != nil && x.ReadBytes != nil {
+		return *x.ReadBytes
+	}
+	return 0
+}
+
+func (x *ListPackagesReply_Package) GetDircacheHits() uint64 {
+	if x != nil && x.DircacheHits != nil {
+		return *x.DircacheHits
+	}
+	return 0
+}
+
+func (x *ListPackagesReply_Package) GetDircacheMisses() uint64 {
+	if x != nil && x.DircacheMisses != nil {
+		return *x.DircacheMisses
+	}
+	return 0
+}
+
+func (x *ListPackagesReply_Package) GetStreamHits() uint64 {
+	if x != nil && x.StreamHits != nil {
+		return *x.StreamHits
+	}
+	return 0
+}
+
+func (x *ListPackagesReply_Package) GetStreamMisses() uint64 {
+	if x != nil && x.StreamMisses != nil {
+		return *x.StreamMisses
+	}
+	return 0
+}
+
+type ListConflictsReply_Conflict struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path *string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"` // e.g. /bin/python3
+	// Link target which the file system serves, e.g.
+	// ../python3-amd64-3.7.0-4/out/bin/python3
+	Target *string `protobuf:"bytes,2,opt,name=target" json:"target,omitempty"`
+	// All packages providing path, e.g. python3-amd64-3.7.0-3,
+	// python3-amd64-3.7.0-4
+	Package []string `protobuf:"bytes,3,rep,name=package" json:"package,omitempty"`
+	// Package which provides target, e.g. python3-amd64-3.7.0-4
+	Provider *string `protobuf:"bytes,4,opt,name=provider" json:"provider,omitempty"`
+	// Why provider was chosen, e.g. “newest version”
+	Reason *string `protobuf:"bytes,5,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (x *ListConflictsReply_Conflict) Reset() {
+	*x = ListConflictsReply_Conflict{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListConflictsReply_Conflict) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConflictsReply_Conflict) ProtoMessage() {}
+
+func (x *ListConflictsReply_Conflict) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConflictsReply_Conflict.ProtoReflect.Descriptor instead.
+func (*ListConflictsReply_Conflict) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{13, 0}
+}
+
+func (x *ListConflictsReply_Conflict) GetPath() string {
+	if x != nil && x.Path != nil {
+		return *x.Path
+	}
+	return ""
+}
+
+func (x *ListConflictsReply_Conflict) GetTarget() string {
+	if x != nil && x.Target != nil {
+		return *x.Target
+	}
+	return ""
+}
+
+func (x *ListConflictsReply_Conflict) GetPackage() []string {
+	if x != nil {
+		return x.Package
+	}
+	return nil
+}
+
+func (x *ListConflictsReply_Conflict) GetProvider() string {
+	if x != nil && x.Provider != nil {
+		return *x.Provider
+	}
+	return ""
+}
+
+func (x *ListConflictsReply_Conflict) GetReason() string {
+	if x != nil && x.Reason != nil {
+		return *x.Reason
+	}
+	return ""
+}
+
+type ListViewsReply_View struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name    *string  `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Package []string `protobuf:"bytes,2,rep,name=package" json:"package,omitempty"`
+	// Whether the view is configured in /etc/distri/views.d (as opposed to
+	// created by SetView).
+	Configured *bool `protobuf:"varint,3,opt,name=configured" json:"configured,omitempty"`
+}
+
+func (x *ListViewsReply_View) Reset() {
+	*x = ListViewsReply_View{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fusectl_proto_msgTypes[22]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListViewsReply_View) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListViewsReply_View) ProtoMessage() {}
+
+func (x *ListViewsReply_View) ProtoReflect() protoreflect.Message {
+	mi := &file_fusectl_proto_msgTypes[22]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListViewsReply_View.ProtoReflect.Descriptor instead.
+func (*ListViewsReply_View) Descriptor() ([]byte, []int) {
+	return file_fusectl_proto_rawDescGZIP(), []int{19, 0}
+}
+
+func (x *ListViewsReply_View) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+func (x *ListViewsReply_View) GetPackage() []string {
+	if x != nil {
+		return x.Package
+	}
+	return nil
+}
+
+func (x *ListViewsReply_View) GetConfigured() bool {
+	if x != nil && x.Configured != nil {
+		return *x.Configured
+	}
+	return false
+}
+
 var File_fusectl_proto protoreflect.FileDescriptor
 
 var file_fusectl_proto_rawDesc = []byte{
@@ -278,18 +1291,144 @@ var file_fusectl_proto_rawDesc = []byte{
 	0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x15, 0x0a, 0x13, 0x53, 0x63, 0x61, 0x6e, 0x50, 0x61, 0x63,
 	0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x13, 0x0a, 0x11,
 	0x53, 0x63, 0x61, 0x6e, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c,
-	0x79, 0x32, 0xa8, 0x01, 0x0a, 0x04, 0x46, 0x55, 0x53, 0x45, 0x12, 0x28, 0x0a, 0x04, 0x50, 0x69,
-	0x6e, 0x67, 0x12, 0x0f, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70,
-	0x6c, 0x79, 0x22, 0x00, 0x12, 0x34, 0x0a, 0x08, 0x4d, 0x6b, 0x64, 0x69, 0x72, 0x41, 0x6c, 0x6c,
-	0x12, 0x13, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x6b, 0x64, 0x69, 0x72, 0x41, 0x6c, 0x6c, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x11, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x6b, 0x64, 0x69, 0x72,
-	0x41, 0x6c, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x40, 0x0a, 0x0c, 0x53, 0x63,
-	0x61, 0x6e, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x12, 0x17, 0x2e, 0x70, 0x62, 0x2e,
-	0x53, 0x63, 0x61, 0x6e, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x70, 0x62, 0x2e, 0x53, 0x63, 0x61, 0x6e, 0x50, 0x61, 0x63,
-	0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x06, 0x5a, 0x04,
-	0x2e, 0x3b, 0x70, 0x62,
+	0x79, 0x22, 0x31, 0x0a, 0x15, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x50, 0x61, 0x63, 0x6b, 0x61,
+	0x67, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61,
+	0x63, 0x6b, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x70, 0x61, 0x63,
+	0x6b, 0x61, 0x67, 0x65, 0x22, 0x15, 0x0a, 0x13, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x50, 0x61,
+	0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x0f, 0x0a, 0x0d, 0x53,
+	0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xd0, 0x03, 0x0a,
+	0x0b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x12, 0x0a, 0x04,
+	0x72, 0x65, 0x70, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x72, 0x65, 0x70, 0x6f,
+	0x12, 0x18, 0x0a, 0x07, 0x73, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x73, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x22, 0x0a, 0x0c, 0x61, 0x75,
+	0x74, 0x6f, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x0c, 0x61, 0x75, 0x74, 0x6f, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x16,
+	0x0a, 0x06, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06,
+	0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67,
+	0x65, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67,
+	0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6f, 0x70, 0x65, 0x6e, 0x65, 0x64, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x06, 0x6f, 0x70, 0x65, 0x6e, 0x65, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x65,
+	0x61, 0x64, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x72, 0x65, 0x61, 0x64, 0x73,
+	0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65, 0x61, 0x64, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x72, 0x65, 0x61, 0x64, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12,
+	0x23, 0x0a, 0x0d, 0x64, 0x69, 0x72, 0x63, 0x61, 0x63, 0x68, 0x65, 0x5f, 0x68, 0x69, 0x74, 0x73,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x64, 0x69, 0x72, 0x63, 0x61, 0x63, 0x68, 0x65,
+	0x48, 0x69, 0x74, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x69, 0x72, 0x63, 0x61, 0x63, 0x68, 0x65,
+	0x5f, 0x6d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0e, 0x64,
+	0x69, 0x72, 0x63, 0x61, 0x63, 0x68, 0x65, 0x4d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x12, 0x1f, 0x0a,
+	0x0b, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x68, 0x69, 0x74, 0x73, 0x18, 0x0b, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x0a, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x48, 0x69, 0x74, 0x73, 0x12, 0x23,
+	0x0a, 0x0d, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x6d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x18,
+	0x0c, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4d, 0x69, 0x73,
+	0x73, 0x65, 0x73, 0x12, 0x2a, 0x0a, 0x11, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x63, 0x61,
+	0x63, 0x68, 0x65, 0x5f, 0x75, 0x73, 0x65, 0x64, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0f,
+	0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x43, 0x61, 0x63, 0x68, 0x65, 0x55, 0x73, 0x65, 0x64, 0x12,
+	0x2e, 0x0a, 0x13, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x5f, 0x63, 0x61, 0x63, 0x68, 0x65, 0x5f,
+	0x62, 0x75, 0x64, 0x67, 0x65, 0x74, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x04, 0x52, 0x11, 0x73, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x43, 0x61, 0x63, 0x68, 0x65, 0x42, 0x75, 0x64, 0x67, 0x65, 0x74, 0x22,
+	0x36, 0x0a, 0x13, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x6f, 0x70, 0x65, 0x6e, 0x65, 0x64,
+	0x5f, 0x6f, 0x6e, 0x6c, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x6f, 0x70, 0x65,
+	0x6e, 0x65, 0x64, 0x4f, 0x6e, 0x6c, 0x79, 0x22, 0x93, 0x03, 0x0a, 0x11, 0x4c, 0x69, 0x73, 0x74,
+	0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x37, 0x0a,
+	0x07, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1d,
+	0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x52, 0x07, 0x70,
+	0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x1a, 0xc4, 0x02, 0x0a, 0x07, 0x50, 0x61, 0x63, 0x6b, 0x61,
+	0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04,
+	0x73, 0x69, 0x7a, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x6f, 0x70, 0x65, 0x6e, 0x65, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x06, 0x6f, 0x70, 0x65, 0x6e, 0x65, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x74, 0x72, 0x65,
+	0x61, 0x6d, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x73, 0x74, 0x72, 0x65,
+	0x61, 0x6d, 0x65, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x65, 0x61, 0x64, 0x73, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x05, 0x72, 0x65, 0x61, 0x64, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x72, 0x65,
+	0x61, 0x64, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09,
+	0x72, 0x65, 0x61, 0x64, 0x42, 0x79, 0x74, 0x65, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x64, 0x69, 0x72,
+	0x63, 0x61, 0x63, 0x68, 0x65, 0x5f, 0x68, 0x69, 0x74, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x0c, 0x64, 0x69, 0x72, 0x63, 0x61, 0x63, 0x68, 0x65, 0x48, 0x69, 0x74, 0x73, 0x12, 0x27,
+	0x0a, 0x0f, 0x64, 0x69, 0x72, 0x63, 0x61, 0x63, 0x68, 0x65, 0x5f, 0x6d, 0x69, 0x73, 0x73, 0x65,
+	0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0e, 0x64, 0x69, 0x72, 0x63, 0x61, 0x63, 0x68,
+	0x65, 0x4d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x5f, 0x68, 0x69, 0x74, 0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x73, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x48, 0x69, 0x74, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x73, 0x74, 0x72, 0x65,
+	0x61, 0x6d, 0x5f, 0x6d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x0c, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x22, 0x28, 0x0a,
+	0x14, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74, 0x73, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x64, 0x69, 0x72, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x64, 0x69, 0x72, 0x22, 0xd8, 0x01, 0x0a, 0x12, 0x4c, 0x69, 0x73, 0x74,
+	0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x3b,
+	0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x1f, 0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69,
+	0x63, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63,
+	0x74, 0x52, 0x08, 0x63, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74, 0x1a, 0x84, 0x01, 0x0a, 0x08,
+	0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06,
+	0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x18,
+	0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x12, 0x1a,
+	0x0a, 0x08, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65,
+	0x61, 0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73,
+	0x6f, 0x6e, 0x22, 0x3e, 0x0a, 0x0e, 0x53, 0x65, 0x74, 0x56, 0x69, 0x65, 0x77, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b,
+	0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x61,
+	0x67, 0x65, 0x22, 0x0e, 0x0a, 0x0c, 0x53, 0x65, 0x74, 0x56, 0x69, 0x65, 0x77, 0x52, 0x65, 0x70,
+	0x6c, 0x79, 0x22, 0x27, 0x0a, 0x11, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x56, 0x69, 0x65, 0x77,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x11, 0x0a, 0x0f, 0x44,
+	0x65, 0x6c, 0x65, 0x74, 0x65, 0x56, 0x69, 0x65, 0x77, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x12,
+	0x0a, 0x10, 0x4c, 0x69, 0x73, 0x74, 0x56, 0x69, 0x65, 0x77, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x22, 0x93, 0x01, 0x0a, 0x0e, 0x4c, 0x69, 0x73, 0x74, 0x56, 0x69, 0x65, 0x77, 0x73,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x2b, 0x0a, 0x04, 0x76, 0x69, 0x65, 0x77, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x56, 0x69, 0x65,
+	0x77, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x2e, 0x56, 0x69, 0x65, 0x77, 0x52, 0x04, 0x76, 0x69,
+	0x65, 0x77, 0x1a, 0x54, 0x0a, 0x04, 0x56, 0x69, 0x65, 0x77, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x18,
+	0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x07, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x63, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x75, 0x72, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x63, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x65, 0x64, 0x32, 0xcf, 0x04, 0x0a, 0x04, 0x46, 0x55, 0x53,
+	0x45, 0x12, 0x28, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x0f, 0x2e, 0x70, 0x62, 0x2e, 0x50,
+	0x69, 0x6e, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0d, 0x2e, 0x70, 0x62, 0x2e,
+	0x50, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x34, 0x0a, 0x08, 0x4d,
+	0x6b, 0x64, 0x69, 0x72, 0x41, 0x6c, 0x6c, 0x12, 0x13, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x6b, 0x64,
+	0x69, 0x72, 0x41, 0x6c, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x11, 0x2e, 0x70,
+	0x62, 0x2e, 0x4d, 0x6b, 0x64, 0x69, 0x72, 0x41, 0x6c, 0x6c, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
+	0x00, 0x12, 0x40, 0x0a, 0x0c, 0x53, 0x63, 0x61, 0x6e, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65,
+	0x73, 0x12, 0x17, 0x2e, 0x70, 0x62, 0x2e, 0x53, 0x63, 0x61, 0x6e, 0x50, 0x61, 0x63, 0x6b, 0x61,
+	0x67, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x70, 0x62, 0x2e,
+	0x53, 0x63, 0x61, 0x6e, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x22, 0x00, 0x12, 0x46, 0x0a, 0x0e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x50, 0x61, 0x63,
+	0x6b, 0x61, 0x67, 0x65, 0x73, 0x12, 0x19, 0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76,
+	0x65, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x17, 0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x50, 0x61, 0x63, 0x6b,
+	0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x2e, 0x0a, 0x06, 0x53,
+	0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x11, 0x2e, 0x70, 0x62, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x70, 0x62, 0x2e, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x40, 0x0a, 0x0c, 0x4c,
+	0x69, 0x73, 0x74, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x12, 0x17, 0x2e, 0x70, 0x62,
+	0x2e, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x61,
+	0x63, 0x6b, 0x61, 0x67, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x43, 0x0a,
+	0x0d, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74, 0x73, 0x12, 0x18,
+	0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69,
+	0x73, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x6c, 0x69, 0x63, 0x74, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x22, 0x00, 0x12, 0x31, 0x0a, 0x07, 0x53, 0x65, 0x74, 0x56, 0x69, 0x65, 0x77, 0x12, 0x12, 0x2e,
+	0x70, 0x62, 0x2e, 0x53, 0x65, 0x74, 0x56, 0x69, 0x65, 0x77, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x10, 0x2e, 0x70, 0x62, 0x2e, 0x53, 0x65, 0x74, 0x56, 0x69, 0x65, 0x77, 0x52, 0x65,
+	0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x3a, 0x0a, 0x0a, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x56,
+	0x69, 0x65, 0x77, 0x12, 0x15, 0x2e, 0x70, 0x62, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x56,
+	0x69, 0x65, 0x77, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x70, 0x62, 0x2e,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x56, 0x69, 0x65, 0x77, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
+	0x00, 0x12, 0x37, 0x0a, 0x09, 0x4c, 0x69, 0x73, 0x74, 0x56, 0x69, 0x65, 0x77, 0x73, 0x12, 0x14,
+	0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x56, 0x69, 0x65, 0x77, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x70, 0x62, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x56, 0x69,
+	0x65, 0x77, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b,
+	0x70, 0x62,
 }
 
 var (
@@ -304,27 +1443,61 @@ func file_fusectl_proto_rawDescGZIP() []byte {
 	return file_fusectl_proto_rawDescData
 }
 
-var file_fusectl_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_fusectl_proto_msgTypes = make([]protoimpl.MessageInfo, 23)
 var file_fusectl_proto_goTypes = []interface{}{
-	(*PingRequest)(nil),         // 0: pb.PingRequest
-	(*PingReply)(nil),           // 1: pb.PingReply
-	(*MkdirAllRequest)(nil),     // 2: pb.MkdirAllRequest
-	(*MkdirAllReply)(nil),       // 3: pb.MkdirAllReply
-	(*ScanPackagesRequest)(nil), // 4: pb.ScanPackagesRequest
-	(*ScanPackagesReply)(nil),   // 5: pb.ScanPackagesReply
+	(*PingRequest)(nil),                 // 0: pb.PingRequest
+	(*PingReply)(nil),                   // 1: pb.PingReply
+	(*MkdirAllRequest)(nil),             // 2: pb.MkdirAllRequest
+	(*MkdirAllReply)(nil),               // 3: pb.MkdirAllReply
+	(*ScanPackagesRequest)(nil),         // 4: pb.ScanPackagesRequest
+	(*ScanPackagesReply)(nil),           // 5: pb.ScanPackagesReply
+	(*RemovePackagesRequest)(nil),       // 6: pb.RemovePackagesRequest
+	(*RemovePackagesReply)(nil),         // 7: pb.RemovePackagesReply
+	(*StatusRequest)(nil),               // 8: pb.StatusRequest
+	(*StatusReply)(nil),                 // 9: pb.StatusReply
+	(*ListPackagesRequest)(nil),         // 10: pb.ListPackagesRequest
+	(*ListPackagesReply)(nil),           // 11: pb.ListPackagesReply
+	(*ListConflictsRequest)(nil),        // 12: pb.ListConflictsRequest
+	(*ListConflictsReply)(nil),          // 13: pb.ListConflictsReply
+	(*SetViewRequest)(nil),              // 14: pb.SetViewRequest
+	(*SetViewReply)(nil),                // 15: pb.SetViewReply
+	(*DeleteViewRequest)(nil),           // 16: pb.DeleteViewRequest
+	(*DeleteViewReply)(nil),             // 17: pb.DeleteViewReply
+	(*ListViewsRequest)(nil),            // 18: pb.ListViewsRequest
+	(*ListViewsReply)(nil),              // 19: pb.ListViewsReply
+	(*ListPackagesReply_Package)(nil),   // 20: pb.ListPackagesReply.Package
+	(*ListConflictsReply_Conflict)(nil), // 21: pb.ListConflictsReply.Conflict
+	(*ListViewsReply_View)(nil),         // 22: pb.ListViewsReply.View
 }
 var file_fusectl_proto_depIdxs = []int32{
-	0, // 0: pb.FUSE.Ping:input_type -> pb.PingRequest
-	2, // 1: pb.FUSE.MkdirAll:input_type -> pb.MkdirAllRequest
-	4, // 2: pb.FUSE.ScanPackages:input_type -> pb.ScanPackagesRequest
-	1, // 3: pb.FUSE.Ping:output_type -> pb.PingReply
-	3, // 4: pb.FUSE.MkdirAll:output_type -> pb.MkdirAllReply
-	5, // 5: pb.FUSE.ScanPackages:output_type -> pb.ScanPackagesReply
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	20, // 0: pb.ListPackagesReply.package:type_name -> pb.ListPackagesReply.Package
+	21, // 1: pb.ListConflictsReply.conflict:type_name -> pb.ListConflictsReply.Conflict
+	22, // 2: pb.ListViewsReply.view:type_name -> pb.ListViewsReply.View
+	0,  // 3: pb.FUSE.Ping:input_type -> pb.PingRequest
+	2,  // 4: pb.FUSE.MkdirAll:input_type -> pb.MkdirAllRequest
+	4,  // 5: pb.FUSE.ScanPackages:input_type -> pb.ScanPackagesRequest
+	6,  // 6: pb.FUSE.RemovePackages:input_type -> pb.RemovePackagesRequest
+	8,  // 7: pb.FUSE.Status:input_type -> pb.StatusRequest
+	10, // 8: pb.FUSE.ListPackages:input_type -> pb.ListPackagesRequest
+	12, // 9: pb.FUSE.ListConflicts:input_type -> pb.ListConflictsRequest
+	14, // 10: pb.FUSE.SetView:input_type -> pb.SetViewRequest
+	16, // 11: pb.FUSE.DeleteView:input_type -> pb.DeleteViewRequest
+	18, // 12: pb.FUSE.ListViews:input_type -> pb.ListViewsRequest
+	1,  // 13: pb.FUSE.Ping:output_type -> pb.PingReply
+	3,  // 14: pb.FUSE.MkdirAll:output_type -> pb.MkdirAllReply
+	5,  // 15: pb.FUSE.ScanPackages:output_type -> pb.ScanPackagesReply
+	7,  // 16: pb.FUSE.RemovePackages:output_type -> pb.RemovePackagesReply
+	9,  // 17: pb.FUSE.Status:output_type -> pb.StatusReply
+	11, // 18: pb.FUSE.ListPackages:output_type -> pb.ListPackagesReply
+	13, // 19: pb.FUSE.ListConflicts:output_type -> pb.ListConflictsReply
+	15, // 20: pb.FUSE.SetView:output_type -> pb.SetViewReply
+	17, // 21: pb.FUSE.DeleteView:output_type -> pb.DeleteViewReply
+	19, // 22: pb.FUSE.ListViews:output_type -> pb.ListViewsReply
+	13, // [13:23] is the sub-list for method output_type
+	3,  // [3:13] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_fusectl_proto_init() }
@@ -345,8 +1518,104 @@ func file_fusectl_proto_init() {
 				return nil
 			}
 		}
-		file_fusectl_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PingReply); i {
+		file_fusectl_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PingReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MkdirAllRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MkdirAllReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScanPackagesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScanPackagesReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RemovePackagesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RemovePackagesReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatusRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatusReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -357,8 +1626,8 @@ func file_fusectl_proto_init() {
 				return nil
 			}
 		}
-		file_fusectl_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*MkdirAllRequest); i {
+		file_fusectl_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListPackagesRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -369,8 +1638,8 @@ func file_fusectl_proto_init() {
 				return nil
 			}
 		}
-		file_fusectl_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*MkdirAllReply); i {
+		file_fusectl_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListPackagesReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -381,8 +1650,8 @@ func file_fusectl_proto_init() {
 				return nil
 			}
 		}
-		file_fusectl_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ScanPackagesRequest); i {
+		file_fusectl_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListConflictsRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -393,8 +1662,116 @@ func file_fusectl_proto_init() {
 				return nil
 			}
 		}
-		file_fusectl_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ScanPackagesReply); i {
+		file_fusectl_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListConflictsReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetViewRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetViewReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteViewRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteViewReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListViewsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListViewsReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListPackagesReply_Package); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListConflictsReply_Conflict); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fusectl_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListViewsReply_View); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -412,7 +1789,7 @@ func file_fusectl_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_fusectl_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   23,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -443,9 +1820,30 @@ type FUSEClient interface {
 	// (e.g. /ro/systemd-amd64-239). This is useful for bind-mounting
 	// DESTDIR/PREFIX to PREFIX when building packages.
 	MkdirAll(ctx context.Context, in *MkdirAllRequest, opts ...grpc.CallOption) (*MkdirAllReply, error)
-	// ScanPackages discovers new packages in the mounted repository. This is
-	// called by “distri install”.
+	// ScanPackages discovers new packages in the mounted repository and removes
+	// packages whose images vanished. This is called by “distri install”.
 	ScanPackages(ctx context.Context, in *ScanPackagesRequest, opts ...grpc.CallOption) (*ScanPackagesReply, error)
+	// RemovePackages removes the specified packages from the file system:
+	// their exchange directory symlinks are removed and their images are
+	// closed, releasing the disk space of deleted images. This is called by
+	// “distri gc”.
+	RemovePackages(ctx context.Context, in *RemovePackagesRequest, opts ...grpc.CallOption) (*RemovePackagesReply, error)
+	// Status returns the configuration of the file system and its aggregated
+	// statistics.
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error)
+	// ListPackages lists the packages of the file system with their images and
+	// per-package statistics.
+	ListPackages(ctx context.Context, in *ListPackagesRequest, opts ...grpc.CallOption) (*ListPackagesReply, error)
+	// ListConflicts lists the exchange directory entries which are provided by
+	// more than one package, along with the link target which is served (see
+	// the -conflict_policy flag of distri fuse).
+	ListConflicts(ctx context.Context, in *ListConflictsRequest, opts ...grpc.CallOption) (*ListConflictsReply, error)
+	// SetView creates or replaces a view: a package set whose exchange
+	// directories are provided underneath /.views/<name> of the mountpoint
+	// (e.g. /ro/.views/dev/bin).
+	SetView(ctx context.Context, in *SetViewRequest, opts ...grpc.CallOption) (*SetViewReply, error)
+	DeleteView(ctx context.Context, in *DeleteViewRequest, opts ...grpc.CallOption) (*DeleteViewReply, error)
+	ListViews(ctx context.Context, in *ListViewsRequest, opts ...grpc.CallOption) (*ListViewsReply, error)
 }
 
 type fUSEClient struct {
@@ -483,6 +1881,69 @@ func (c *fUSEClient) ScanPackages(ctx context.Context, in *ScanPackagesRequest,
 	return out, nil
 }
 
+func (c *fUSEClient) RemovePackages(ctx context.Context, in *RemovePackagesRequest, opts ...grpc.CallOption) (*RemovePackagesReply, error) {
+	out := new(RemovePackagesReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/RemovePackages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error) {
+	out := new(StatusReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) ListPackages(ctx context.Context, in *ListPackagesRequest, opts ...grpc.CallOption) (*ListPackagesReply, error) {
+	out := new(ListPackagesReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/ListPackages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) ListConflicts(ctx context.Context, in *ListConflictsRequest, opts ...grpc.CallOption) (*ListConflictsReply, error) {
+	out := new(ListConflictsReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/ListConflicts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) SetView(ctx context.Context, in *SetViewRequest, opts ...grpc.CallOption) (*SetViewReply, error) {
+	out := new(SetViewReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/SetView", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) DeleteView(ctx context.Context, in *DeleteViewRequest, opts ...grpc.CallOption) (*DeleteViewReply, error) {
+	out := new(DeleteViewReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/DeleteView", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fUSEClient) ListViews(ctx context.Context, in *ListViewsRequest, opts ...grpc.CallOption) (*ListViewsReply, error) {
+	out := new(ListViewsReply)
+	err := c.cc.Invoke(ctx, "/pb.FUSE/ListViews", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FUSEServer is the server API for FUSE service.
 type FUSEServer interface {
 	Ping(context.Context, *PingRequest) (*PingReply, error)
@@ -490,9 +1951,30 @@ type FUSEServer interface {
 	// (e.g. /ro/systemd-amd64-239). This is useful for bind-mounting
 	// DESTDIR/PREFIX to PREFIX when building packages.
 	MkdirAll(context.Context, *MkdirAllRequest) (*MkdirAllReply, error)
-	// ScanPackages discovers new packages in the mounted repository. This is
-	// called by “distri install”.
+	// ScanPackages discovers new packages in the mounted repository and removes
+	// packages whose images vanished. This is called by “distri install”.
 	ScanPackages(context.Context, *ScanPackagesRequest) (*ScanPackagesReply, error)
+	// RemovePackages removes the specified packages from the file system:
+	// their exchange directory symlinks are removed and their images are
+	// closed, releasing the disk space of deleted images. This is called by
+	// “distri gc”.
+	RemovePackages(context.Context, *RemovePackagesRequest) (*RemovePackagesReply, error)
+	// Status returns the configuration of the file system and its aggregated
+	// statistics.
+	Status(context.Context, *StatusRequest) (*StatusReply, error)
+	// ListPackages lists the packages of the file system with their images and
+	// per-package statistics.
+	ListPackages(context.Context, *ListPackagesRequest) (*ListPackagesReply, error)
+	// ListConflicts lists the exchange directory entries which are provided by
+	// more than one package, along with the link target which is served (see
+	// the -conflict_policy flag of distri fuse).
+	ListConflicts(context.Context, *ListConflictsRequest) (*ListConflictsReply, error)
+	// SetView creates or replaces a view: a package set whose exchange
+	// directories are provided underneath /.views/<name> of the mountpoint
+	// (e.g. /ro/.views/dev/bin).
+	SetView(context.Context, *SetViewRequest) (*SetViewReply, error)
+	DeleteView(context.Context, *DeleteViewRequest) (*DeleteViewReply, error)
+	ListViews(context.Context, *ListViewsRequest) (*ListViewsReply, error)
 }
 
 // UnimplementedFUSEServer can be embedded to have forward compatible implementations.
@@ -508,6 +1990,27 @@ func (*UnimplementedFUSEServer) MkdirAll(context.Context, *MkdirAllRequest) (*Mk
 func (*UnimplementedFUSEServer) ScanPackages(context.Context, *ScanPackagesRequest) (*ScanPackagesReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ScanPackages not implemented")
 }
+func (*UnimplementedFUSEServer) RemovePackages(context.Context, *RemovePackagesRequest) (*RemovePackagesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemovePackages not implemented")
+}
+func (*UnimplementedFUSEServer) Status(context.Context, *StatusRequest) (*StatusReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (*UnimplementedFUSEServer) ListPackages(context.Context, *ListPackagesRequest) (*ListPackagesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPackages not implemented")
+}
+func (*UnimplementedFUSEServer) ListConflicts(context.Context, *ListConflictsRequest) (*ListConflictsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConflicts not implemented")
+}
+func (*UnimplementedFUSEServer) SetView(context.Context, *SetViewRequest) (*SetViewReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetView not implemented")
+}
+func (*UnimplementedFUSEServer) DeleteView(context.Context, *DeleteViewRequest) (*DeleteViewReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteView not implemented")
+}
+func (*UnimplementedFUSEServer) ListViews(context.Context, *ListViewsRequest) (*ListViewsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListViews not implemented")
+}
 
 func RegisterFUSEServer(s *grpc.Server, srv FUSEServer) {
 	s.RegisterService(&_FUSE_serviceDesc, srv)
@@ -567,6 +2070,132 @@ func _FUSE_ScanPackages_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FUSE_RemovePackages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemovePackagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).RemovePackages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/RemovePackages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).RemovePackages(ctx, req.(*RemovePackagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_ListPackages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPackagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).ListPackages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/ListPackages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).ListPackages(ctx, req.(*ListPackagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_ListConflicts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConflictsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).ListConflicts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/ListConflicts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).ListConflicts(ctx, req.(*ListConflictsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_SetView_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetViewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).SetView(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/SetView",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).SetView(ctx, req.(*SetViewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_DeleteView_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteViewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).DeleteView(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/DeleteView",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).DeleteView(ctx, req.(*DeleteViewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FUSE_ListViews_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListViewsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FUSEServer).ListViews(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.FUSE/ListViews",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FUSEServer).ListViews(ctx, req.(*ListViewsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _FUSE_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.FUSE",
 	HandlerType: (*FUSEServer)(nil),
@@ -583,6 +2212,34 @@ var _FUSE_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ScanPackages",
 			Handler:    _FUSE_ScanPackages_Handler,
 		},
+		{
+			MethodName: "RemovePackages",
+			Handler:    _FUSE_RemovePackages_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _FUSE_Status_Handler,
+		},
+		{
+			MethodName: "ListPackages",
+			Handler:    _FUSE_ListPackages_Handler,
+		},
+		{
+			MethodName: "ListConflicts",
+			Handler:    _FUSE_ListConflicts_Handler,
+		},
+		{
+			MethodName: "SetView",
+			Handler:    _FUSE_SetView_Handler,
+		},
+		{
+			MethodName: "DeleteView",
+			Handler:    _FUSE_DeleteView_Handler,
+		},
+		{
+			MethodName: "ListViews",
+			Handler:    _FUSE_ListViews_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "fusectl.proto",
@@ -0,0 +1,203 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.20.1
+// 	protoc        v3.11.4
+// source: generation.proto
+
+package pb
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+// A Generation describes the contents of the package store after an operation
+// (e.g. distri install) modified it. distri reset can restore any generation.
+type Generation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Sequence number of this generation, starting at 1.
+	Id *int64 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	// Time of the operation, in seconds since the UNIX epoch.
+	Timestamp *int64 `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	// Operation which resulted in this generation, e.g. "install", "update",
+	// "gc" or "reset".
+	Operation *string `protobuf:"bytes,3,opt,name=operation" json:"operation,omitempty"`
+	// Packages in the package store, e.g. ["glibc-amd64-2.31-4", …].
+	Package []string `protobuf:"bytes,4,rep,name=package" json:"package,omitempty"`
+	// The package set which was updated, if any.
+	Pkgset *string `protobuf:"bytes,5,opt,name=pkgset" json:"pkgset,omitempty"`
+	// The most recent linux kernel package in the package store, if any.
+	Kernel *string `protobuf:"bytes,6,opt,name=kernel" json:"kernel,omitempty"`
+}
+
+func (x *Generation) Reset() {
+	*x = Generation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_generation_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Generation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Generation) ProtoMessage() {}
+
+func (x *Generation) ProtoReflect() protoreflect.Message {
+	mi := &file_generation_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Generation.ProtoReflect.Descriptor instead.
+func (*Generation) Descriptor() ([]byte, []int) {
+	return file_generation_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Generation) GetId() int64 {
+	if x != nil && x.Id != nil {
+		return *x.Id
+	}
+	return 0
+}
+
+func (x *Generation) GetTimestamp() int64 {
+	if x != nil && x.Timestamp != nil {
+		return *x.Timestamp
+	}
+	return 0
+}
+
+func (x *Generation) GetOperation() string {
+	if x != nil && x.Operation != nil {
+		return *x.Operation
+	}
+	return ""
+}
+
+func (x *Generation) GetPackage() []string {
+	if x != nil {
+		return x.Package
+	}
+	return nil
+}
+
+func (x *Generation) GetPkgset() string {
+	if x != nil && x.Pkgset != nil {
+		return *x.Pkgset
+	}
+	return ""
+}
+
+func (x *Generation) GetKernel() string {
+	if x != nil && x.Kernel != nil {
+		return *x.Kernel
+	}
+	return ""
+}
+
+var File_generation_proto protoreflect.FileDescriptor
+
+var file_generation_proto_rawDesc = []byte{
+	0x0a, 0x10, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x02, 0x70, 0x62, 0x22, 0xa2, 0x01, 0x0a, 0x0a, 0x47, 0x65, 0x6e, 0x65, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x12, 0x1c, 0x0a, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x18, 0x04, 0x20, 0x03,
+	0x28, 0x09, 0x52, 0x07, 0x70, 0x61, 0x63, 0x6b, 0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x70,
+	0x6b, 0x67, 0x73, 0x65, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6b, 0x67,
+	0x73, 0x65, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x6b, 0x65, 0x72, 0x6e, 0x65, 0x6c, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x6b, 0x65, 0x72, 0x6e, 0x65, 0x6c, 0x42, 0x06, 0x5a, 0x04, 0x2e,
+	0x3b, 0x70, 0x62,
+}
+
+var (
+	file_generation_proto_rawDescOnce sync.Once
+	file_generation_proto_rawDescData = file_generation_proto_rawDesc
+)
+
+func file_generation_proto_rawDescGZIP() []byte {
+	file_generation_proto_rawDescOnce.Do(func() {
+		file_generation_proto_rawDescData = protoimpl.X.CompressGZIP(file_generation_proto_rawDescData)
+	})
+	return file_generation_proto_rawDescData
+}
+
+var file_generation_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_generation_proto_goTypes = []interface{}{
+	(*Generation)(nil), // 0: pb.Generation
+}
+var file_generation_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_generation_proto_init() }
+func file_generation_proto_init() {
+	if File_generation_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_generation_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Generation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_generation_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_generation_proto_goTypes,
+		DependencyIndexes: file_generation_proto_depIdxs,
+		MessageInfos:      file_generation_proto_msgTypes,
+	}.Build()
+	File_generation_proto = out.File
+	file_generation_proto_rawDesc = nil
+	file_generation_proto_goTypes = nil
+	file_generation_proto_depIdxs = nil
+}
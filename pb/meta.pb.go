@@ -48,6 +48,9 @@ type Meta struct {
 	// Opaque (printable) digest of all inputs to this build. Used by e.g. distri
 	// batch to figure out what to rebuild.
 	InputDigest *string `protobuf:"bytes,5,opt,name=input_digest,json=inputDigest" json:"input_digest,omitempty"`
+	// Additional global exchange directories (e.g. /out/share/gettext-0.19.8)
+	// which the FUSE file system provides while this package is installed.
+	ExchangeDir []string `protobuf:"bytes,6,rep,name=exchange_dir,json=exchangeDir" json:"exchange_dir,omitempty"`
 }
 
 func (x *Meta) Reset() {
@@ -117,11 +120,18 @@ func (x *Meta) GetInputDigest() string {
 	return ""
 }
 
+func (x *Meta) GetExchangeDir() []string {
+	if x != nil {
+		return x.ExchangeDir
+	}
+	return nil
+}
+
 var File_meta_proto protoreflect.FileDescriptor
 
 var file_meta_proto_rawDesc = []byte{
 	0x0a, 0x0a, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x02, 0x70, 0x62,
-	0x1a, 0x0b, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xb3, 0x01,
+	0x1a, 0x0b, 0x62, 0x75, 0x69, 0x6c, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xd6, 0x01,
 	0x0a, 0x04, 0x4d, 0x65, 0x74, 0x61, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d,
 	0x65, 0x5f, 0x64, 0x65, 0x70, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0a, 0x72, 0x75, 0x6e,
 	0x74, 0x69, 0x6d, 0x65, 0x44, 0x65, 0x70, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x6f, 0x75, 0x72, 0x63,
@@ -133,7 +143,9 @@ var file_meta_proto_rawDesc = []byte{
 	0x6f, 0x6e, 0x52, 0x0c, 0x72, 0x75, 0x6e, 0x74, 0x69, 0x6d, 0x65, 0x55, 0x6e, 0x69, 0x6f, 0x6e,
 	0x12, 0x21, 0x0a, 0x0c, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x5f, 0x64, 0x69, 0x67, 0x65, 0x73, 0x74,
 	0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x44, 0x69, 0x67,
-	0x65, 0x73, 0x74, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62,
+	0x65, 0x73, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x65, 0x78, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x5f,
+	0x64, 0x69, 0x72, 0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b, 0x65, 0x78, 0x63, 0x68, 0x61,
+	0x6e, 0x67, 0x65, 0x44, 0x69, 0x72, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62,
 }
 
 var (
@@ -1,6 +1,7 @@
 package distri
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -11,8 +12,8 @@ type PackageVersion struct {
 	Pkg  string
 	Arch string
 
-	// Upstream is the upstream version number. It is never parsed or compared,
-	// and is meant for human consumption only.
+	// Upstream is the upstream version number. It is only compared (see
+	// Compare) between versions of the same DistriRevision.
 	Upstream string
 
 	// DistriRevision is an incrementing integer starting at 1. Every time the
@@ -122,11 +123,186 @@ func ParseVersion(filename string) PackageVersion {
 	}
 }
 
-// PackageRevisionLess returns true if the distri package revision extracted
-// from filenameA is less than those extracted from filenameB. This can be used
-// with sort.Sort.
+// PackageRevisionLess returns true if the distri package version extracted
+// from filenameA is less than the one extracted from filenameB (see
+// PackageVersion.Compare). This can be used with sort.Sort.
 func PackageRevisionLess(filenameA, filenameB string) bool {
-	versionA := ParseVersion(filenameA).DistriRevision
-	versionB := ParseVersion(filenameB).DistriRevision
-	return versionA < versionB
+	return ParseVersion(filenameA).Compare(ParseVersion(filenameB)) < 0
 }
+
+// Compare returns -1, 0 or +1 depending on whether pv is older than, equal to
+// or newer than other. The package name and architecture are not compared.
+//
+// Versions are ordered by DistriRevision first, as the revision is increased
+// with every change to the package. Upstream versions are used to break ties,
+// and are compared like dpkg(1) compares versions: non-digit segments
+// lexically (with ~ sorting before anything, even the end), digit segments
+// numerically.
+func (pv PackageVersion) Compare(other PackageVersion) int {
+	switch {
+	case pv.DistriRevision < other.DistriRevision:
+		return -1
+	case pv.DistriRevision > other.DistriRevision:
+		return 1
+	}
+	return compareUpstream(pv.Upstream, other.Upstream)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+// order returns the sort weight of character c of a non-digit version segment,
+// or of the end of the version string (c == 0).
+func order(c byte) int {
+	switch {
+	case c == 0, isDigit(c):
+		return 0
+	case isLetter(c):
+		return int(c)
+	case c == '~':
+		return -1
+	default:
+		return int(c) + 256
+	}
+}
+
+// compareUpstream compares upstream versions a and b like dpkg’s verrevcmp.
+func compareUpstream(a, b string) int {
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	var i, j int
+	for i < len(a) || j < len(b) {
+		// Compare the non-digit prefix character by character:
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := order(at(a, i)), order(at(b, j))
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+		// Compare the digit segment numerically:
+		for at(a, i) == '0' {
+			i++
+		}
+		for at(b, j) == '0' {
+			j++
+		}
+		var firstDiff int
+		for isDigit(at(a, i)) && isDigit(at(b, j)) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if isDigit(at(a, i)) {
+			return 1
+		}
+		if isDigit(at(b, j)) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return sign(firstDiff)
+		}
+	}
+	return 0
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+type constraintTerm struct {
+	op      string // one of >=, <=, >, <, =, ~
+	version PackageVersion
+}
+
+func (t constraintTerm) matches(pv PackageVersion) bool {
+	if t.op == "~" {
+		// Same upstream release series, e.g. ~5.4 matches 5.4 and 5.4.20,
+		// but not 5.40.
+		return pv.Upstream == t.version.Upstream ||
+			strings.HasPrefix(pv.Upstream, t.version.Upstream+".")
+	}
+	var cmp int
+	if t.version.DistriRevision == 0 {
+		// No revision specified: constrain the upstream version only.
+		cmp = compareUpstream(pv.Upstream, t.version.Upstream)
+	} else {
+		cmp = pv.Compare(t.version)
+	}
+	switch t.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	default: // =
+		return cmp == 0
+	}
+}
+
+// Constraint restricts the acceptable versions of a package, see
+// ParseConstraint.
+type Constraint struct {
+	terms []constraintTerm
+	text  string
+}
+
+// ParseConstraint parses a comma-separated list of version constraints, all of
+// which must be satisfied, e.g. “>=5.4, <5.6” or “~2.31”. Supported operators
+// are >=, <=, >, <, = and ~ (same release series). Versions without a distri
+// revision (e.g. 5.4) constrain the upstream version only, versions with a
+// revision (e.g. 5.4.6-10) are compared using PackageVersion.Compare.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: s}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var op string
+		for _, o := range []string{">=", "<=", ">", "<", "=", "~"} {
+			if strings.HasPrefix(term, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return Constraint{}, fmt.Errorf("version constraint %q: missing operator (one of >=, <=, >, <, =, ~)", term)
+		}
+		version := strings.TrimSpace(strings.TrimPrefix(term, op))
+		if version == "" {
+			return Constraint{}, fmt.Errorf("version constraint %q: missing version", term)
+		}
+		c.terms = append(c.terms, constraintTerm{
+			op:      op,
+			version: ParseVersion(version),
+		})
+	}
+	return c, nil
+}
+
+// Matches returns whether pv satisfies the constraint.
+func (c Constraint) Matches(pv PackageVersion) bool {
+	for _, t := range c.terms {
+		if !t.matches(pv) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) String() string { return c.text }
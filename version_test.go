@@ -112,3 +112,64 @@ func TestPackageRevisionLess(t *testing.T) {
 		})
 	}
 }
+
+func TestCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{a: "10.1-11", b: "9.0-10", want: 1},
+		{a: "9.0-10", b: "10.1-11", want: -1},
+		{a: "2.31-4", b: "2.31-4", want: 0},
+		{a: "8.3.0-3", b: "8.2.0-4", want: -1}, // revision takes precedence
+		{a: "1.10-3", b: "1.9-3", want: 1},
+		{a: "1.0~rc1-3", b: "1.0-3", want: -1},
+		{a: "1.0a-3", b: "1.0-3", want: 1},
+		{a: "1.0-3", b: "1.0.1-3", want: -1},
+		{a: "1.01-3", b: "1.1-3", want: 0},
+		{a: "1.0+git1-3", b: "1.0a-3", want: 1}, // non-letters sort after letters
+	} {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := ParseVersion(tt.a).Compare(ParseVersion(tt.b)); got != tt.want {
+				t.Errorf("Compare(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	for _, tt := range []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{constraint: ">=5.4", version: "5.4.6-10", want: true},
+		{constraint: ">=5.4", version: "5.10.1-20", want: true},
+		{constraint: ">=5.4", version: "5.3.18-30", want: false},
+		{constraint: ">=5.4, <5.6", version: "5.5.2-12", want: true},
+		{constraint: ">=5.4, <5.6", version: "5.6.5-15", want: false},
+		{constraint: "~5.4", version: "5.4-3", want: true},
+		{constraint: "~5.4", version: "5.4.20-3", want: true},
+		{constraint: "~5.4", version: "5.40-3", want: false},
+		{constraint: "=2.31-4", version: "2.31-4", want: true},
+		{constraint: "=2.31-4", version: "2.31-5", want: false},
+		{constraint: "<2.31-5", version: "2.32-4", want: true}, // revision first
+		{constraint: ">2.31", version: "2.31-9", want: false},
+	} {
+		t.Run(tt.constraint+"_"+tt.version, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Matches(ParseVersion(tt.version)); got != tt.want {
+				t.Errorf("ParseConstraint(%q).Matches(%s) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"5.4", ">=", ">=5.4,"} {
+		if _, err := ParseConstraint(invalid); err == nil {
+			t.Errorf("ParseConstraint(%q) unexpectedly succeeded", invalid)
+		}
+	}
+}